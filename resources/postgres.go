@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/albertwidi/pkg/postgres"
+	"github.com/albertwidi/pkg/srun"
+	"github.com/albertwidi/pkg/srun/healthcheck"
 )
 
 var (
@@ -99,6 +101,24 @@ func (sr *postgresResources) close() error {
 	return err
 }
 
+// checkers returns the health checkers of all PostgreSQL resources. The secondary database only degrades the resources when
+// it is not reachable, as the primary database can still serve the requests.
+func (sr *postgresResources) checkers() []srun.HealthChecker {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	var checkers []srun.HealthChecker
+	for name, db := range sr.db {
+		checkers = append(checkers, healthcheck.Named("postgres "+name+" primary", healthcheck.Postgres(db.Primary())))
+		if len(db) > 1 {
+			checkers = append(checkers, healthcheck.Degraded(
+				healthcheck.Named("postgres "+name+" secondary", healthcheck.Postgres(db.Secondary())),
+			))
+		}
+	}
+	return checkers
+}
+
 type PostgresOverrideableConfig struct {
 	ConnMaxLifetime Duration `yaml:"conn-max-lifetime"`
 	ConnMaxIdleTime Duration `yaml:"conn-max-idle-time"`
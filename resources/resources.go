@@ -5,11 +5,15 @@ import (
 	"sync"
 
 	"github.com/albertwidi/pkg/srun"
+	"github.com/albertwidi/pkg/srun/healthcheck"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var _ srun.ServiceRunnerAware = (*Resources)(nil)
+var (
+	_ srun.ServiceRunnerAware = (*Resources)(nil)
+	_ srun.Healthcheck        = (*Resources)(nil)
+)
 
 type Config struct {
 	Postgres *PostgresResourcesConfig `yaml:"postgres"`
@@ -64,7 +68,8 @@ func (r *Resources) init(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if r.postrgres != nil {
+	// The resources are connected once, either by New or by Init.
+	if r.config.Postgres != nil && r.postrgres == nil {
 		resources, err := r.config.Postgres.connect(ctx)
 		if err != nil {
 			return err
@@ -84,11 +89,32 @@ func (r *Resources) Ready(ctx context.Context) error {
 }
 
 func (r *Resources) Stop(ctx context.Context) error {
-	if r.postrgres != nil {
-		if err := r.postrgres.close(); err != nil {
+	r.mu.Lock()
+	postgresResources := r.postrgres
+	// Reset the closed connections, so the resources are connected again when they are initiated after stopped, for
+	// example when the runner restarts the resources.
+	r.postrgres = nil
+	r.mu.Unlock()
+
+	if postgresResources != nil {
+		if err := postgresResources.close(); err != nil {
 			return err
 		}
 	}
 	r.stopC <- struct{}{}
 	return nil
 }
+
+// Health checks the connections of the resources. The resources are unhealthy when one of the primary databases is not
+// reachable, and degraded when only the secondary databases are not reachable.
+func (r *Resources) Health(ctx context.Context) (srun.HealthStatus, error) {
+	r.mu.Lock()
+	postgresResources := r.postrgres
+	r.mu.Unlock()
+
+	var checkers []srun.HealthChecker
+	if postgresResources != nil {
+		checkers = append(checkers, postgresResources.checkers()...)
+	}
+	return healthcheck.All(checkers...).Health(ctx)
+}
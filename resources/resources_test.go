@@ -1,6 +1,47 @@
 package resources
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	"github.com/albertwidi/pkg/srun"
+)
 
 func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestResourcesInitAfterStop(t *testing.T) {
+	t.Parallel()
+
+	// The configuration without connections doesn't need a database, but still creates the PostgreSQL resources.
+	r, err := New(context.Background(), Config{Postgres: &PostgresResourcesConfig{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connected := r.postrgres
+	if connected == nil {
+		t.Fatal("expecting the postgres resources to be connected by New")
+	}
+	// The resources are connected once, so Init after New doesn't connect again.
+	if err := r.Init(srun.Context{Ctx: context.Background()}); err != nil {
+		t.Fatal(err)
+	}
+	if r.postrgres != connected {
+		t.Fatal("expecting the postgres resources to not be connected again")
+	}
+
+	if err := r.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r.postrgres != nil {
+		t.Fatal("expecting the closed postgres resources to be reset")
+	}
+	// The resources are initiated again after stopped, for example when the runner restarts them.
+	if err := r.Init(srun.Context{Ctx: context.Background()}); err != nil {
+		t.Fatal(err)
+	}
+	if r.postrgres == nil || r.postrgres == connected {
+		t.Fatal("expecting the postgres resources to be connected again")
+	}
 }
@@ -1,12 +1,18 @@
 package srun
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/pprof"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -14,7 +20,10 @@ import (
 
 const defaultAdminHTTPServerAddress = ":8778"
 
-var _ ServiceRunnerAware = (*adminHTTPServer)(nil)
+var (
+	_ ServiceRunnerAware    = (*adminHTTPServer)(nil)
+	_ ServiceListenersAware = (*adminHTTPServer)(nil)
+)
 
 // adminHTTPServerDefaultConfig is the admin server default configuration to ensure the admin
 // server to be able to serve endpoint without any additional configuration.
@@ -27,8 +36,8 @@ var adminHTTPServerDefaultConfig = AdminHTTPServerConfig{
 
 type AdminConfig struct {
 	// Disable disables administration http server. We don't recommend this to be turned off in non-testing mode.
-	Disable bool
-	AdminServerConfig
+	Disable           bool `yaml:"disable"`
+	AdminServerConfig `yaml:",inline"`
 }
 
 type AdminServerConfig struct {
@@ -36,17 +45,21 @@ type AdminServerConfig struct {
 	// or not. This configuration is affected by otel configuration.
 	prometheusHandlerDisabled bool
 
-	Address          string
-	HTTPServerConfig AdminHTTPServerConfig
-	ReadinessFunc    func() error
-	HealthcheckFunc  func() error
+	Address          string                `yaml:"address"`
+	HTTPServerConfig AdminHTTPServerConfig `yaml:"http-server-config"`
+	ReadinessFunc    func() error          `yaml:"-"`
+	HealthcheckFunc  func() error          `yaml:"-"`
+	// Token is the bearer token to authorize the requests that change the state of the program via PUT and DELETE /log/level,
+	// and POST /upgrade. The token is passed via the 'Authorization: Bearer <token>' header. The endpoints don't require
+	// authorization if the token is empty.
+	Token string `yaml:"token"`
 }
 
 type AdminHTTPServerConfig struct {
-	WriteTimeout      time.Duration
-	ReadTimeout       time.Duration
-	ReadHeaderTimeout time.Duration
-	IdleTimeout       time.Duration
+	WriteTimeout      time.Duration `yaml:"write-timeout"`
+	ReadTimeout       time.Duration `yaml:"read-timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read-header-timeout"`
+	IdleTimeout       time.Duration `yaml:"idle-timeout"`
 }
 
 func (c *AdminServerConfig) validate() error {
@@ -64,6 +77,31 @@ type adminHTTPServer struct {
 	server   *http.Server
 	config   AdminServerConfig
 	readyC   chan struct{}
+	// servicesFunc returns the snapshot of all services inside the runner. The function is set by the runner.
+	servicesFunc func() []ServiceSnapshot
+	// readinessReportFunc and livenessReportFunc are the default readiness and liveness of the program based on
+	// the state of all services inside the runner. The functions are used when the user doesn't set their own
+	// functions via SetReadinessFunc and SetHealthCheckFunc.
+	readinessReportFunc func() ProbeReport
+	livenessReportFunc  func() ProbeReport
+	// readinessGateFunc fails the readiness regardless of the readiness function set by the user, for example when the
+	// runner is draining. The function is set by the runner.
+	readinessGateFunc func() error
+	// logLevels controls the level of the default logger via /log/level endpoint. The controller is set by the runner.
+	logLevels *logLevelController
+	// upgrader triggers and observes the upgrade via /upgrade endpoints. The upgrader is set by the runner if the self-upgrade
+	// is enabled.
+	upgrader adminUpgrader
+	// healthHistoryFunc returns the latest health status transitions, filtered by the service name if it is not empty. The
+	// function is set by the runner if the healthcheck is enabled.
+	healthHistoryFunc func(serviceName string) []HealthTransition
+}
+
+// adminUpgrader is the upgrader that controlled by the admin server.
+type adminUpgrader interface {
+	// triggerUpgrade starts the upgrade in the background.
+	triggerUpgrade(trigger string) error
+	status() upgradeStatus
 }
 
 func newAdminServer(config AdminServerConfig) (*adminHTTPServer, error) {
@@ -81,7 +119,27 @@ func (a *adminHTTPServer) Name() string {
 	return "srun-http-admin-server"
 }
 
+// ShutdownPhase stops the admin server in the telemetry phase, so the metrics and profiles are still available when the
+// other services are shutting down.
+func (a *adminHTTPServer) ShutdownPhase() ShutdownPhase {
+	return ShutdownPhaseTelemetry
+}
+
+// RequiredListeners requests the listener of the admin server from the runner, so the listener is passed to the new process
+// when the program is upgraded.
+func (a *adminHTTPServer) RequiredListeners() []ListenerRequest {
+	return []ListenerRequest{{Network: "tcp", Address: a.config.Address}}
+}
+
+func (a *adminHTTPServer) RegisterListeners(listeners []ServiceListener) {
+	a.listener = listeners[0].Listener
+}
+
 func (a *adminHTTPServer) Init(Context) error {
+	// The listener is already created by the runner.
+	if a.listener != nil {
+		return nil
+	}
 	listener, err := net.Listen("tcp", a.config.Address)
 	if err != nil {
 		return err
@@ -128,9 +186,65 @@ func (a *adminHTTPServer) SetHealthCheckFunc(fn func() error) {
 	a.config.HealthcheckFunc = fn
 }
 
+func (a *adminHTTPServer) setServicesFunc(fn func() []ServiceSnapshot) {
+	a.servicesFunc = fn
+}
+
+func (a *adminHTTPServer) setProbeReportFuncs(readiness, liveness func() ProbeReport) {
+	a.readinessReportFunc = readiness
+	a.livenessReportFunc = liveness
+}
+
+func (a *adminHTTPServer) setReadinessGateFunc(fn func() error) {
+	a.readinessGateFunc = fn
+}
+
+func (a *adminHTTPServer) setLogLevelController(levels *logLevelController) {
+	a.logLevels = levels
+}
+
+func (a *adminHTTPServer) setUpgrader(upgrader adminUpgrader) {
+	a.upgrader = upgrader
+}
+
+func (a *adminHTTPServer) setHealthHistoryFunc(fn func(serviceName string) []HealthTransition) {
+	a.healthHistoryFunc = fn
+}
+
+// authorize checks the bearer token of the request if the token is set.
+func (a *adminHTTPServer) authorize(r *http.Request) bool {
+	if a.config.Token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Token)) == 1
+}
+
+// logLevelRequest is the request to change the log level via PUT /log/level.
+type logLevelRequest struct {
+	// Level is the new level of the logger, for example 'DEBUG' or 'INFO'.
+	Level string `json:"level"`
+	// TTL is the duration of the new level in time.Duration format, the level is reverted to the configured level once the
+	// TTL is passed. The level is not reverted if the TTL is empty.
+	TTL string `json:"ttl"`
+}
+
+// writeProbeReport writes the probe report as JSON. The status code is 503(Service Unavailable) if the probe is not OK.
+func writeProbeReport(w http.ResponseWriter, report ProbeReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
 func (a *adminHTTPServer) handler() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		if a.config.HealthcheckFunc == nil && a.livenessReportFunc != nil {
+			writeProbeReport(w, a.livenessReportFunc())
+			return
+		}
 		if a.config.HealthcheckFunc == nil {
 			w.WriteHeader(http.StatusNotImplemented)
 			w.Write([]byte("NOT IMPLEMENTED"))
@@ -144,12 +258,35 @@ func (a *adminHTTPServer) handler() *http.ServeMux {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	// Health history endpoint. The transitions of a specific service are returned by passing 'service' query parameter.
+	mux.HandleFunc("GET /health/history", func(w http.ResponseWriter, r *http.Request) {
+		if a.healthHistoryFunc == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("NOT IMPLEMENTED"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"transitions": a.healthHistoryFunc(r.URL.Query().Get("service"))})
+	})
 	mux.HandleFunc("GET /ready", func(w http.ResponseWriter, r *http.Request) {
+		if a.config.ReadinessFunc == nil && a.readinessReportFunc != nil {
+			writeProbeReport(w, a.readinessReportFunc())
+			return
+		}
 		if a.config.ReadinessFunc == nil {
 			w.WriteHeader(http.StatusNotImplemented)
 			w.Write([]byte("NOT IMPLEMENTED"))
 			return
 		}
+		// The default readiness report already includes the gate, but the readiness function set by the user doesn't know
+		// about the state of the runner.
+		if a.readinessGateFunc != nil {
+			if err := a.readinessGateFunc(); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, err.Error())
+				return
+			}
+		}
 		if err := a.config.ReadinessFunc(); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprint(w, err.Error())
@@ -158,6 +295,124 @@ func (a *adminHTTPServer) handler() *http.ServeMux {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	// Services state endpoint.
+	mux.HandleFunc("GET /services", func(w http.ResponseWriter, r *http.Request) {
+		if a.servicesFunc == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("NOT IMPLEMENTED"))
+			return
+		}
+		// Encode the snapshots before writing the response, so the status code can still be changed when the encoding fails.
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(map[string]any{"services": a.servicesFunc()}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf.Bytes())
+	})
+	// Log level endpoints. The level of a specific logger_scope is controlled by passing 'scope' query parameter.
+	mux.HandleFunc("GET /log/level", func(w http.ResponseWriter, r *http.Request) {
+		if a.logLevels == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("NOT IMPLEMENTED"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.logLevels.status(r.URL.Query().Get("scope")))
+	})
+	mux.HandleFunc("PUT /log/level", func(w http.ResponseWriter, r *http.Request) {
+		if a.logLevels == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("NOT IMPLEMENTED"))
+			return
+		}
+		if !a.authorize(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("UNAUTHORIZED"))
+			return
+		}
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			var err error
+			ttl, err = time.ParseDuration(req.TTL)
+			if err != nil || ttl < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "invalid ttl %q", req.TTL)
+				return
+			}
+		}
+		scope := r.URL.Query().Get("scope")
+		a.logLevels.set(scope, level, ttl)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.logLevels.status(scope))
+	})
+	mux.HandleFunc("DELETE /log/level", func(w http.ResponseWriter, r *http.Request) {
+		if a.logLevels == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("NOT IMPLEMENTED"))
+			return
+		}
+		if !a.authorize(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("UNAUTHORIZED"))
+			return
+		}
+		scope := r.URL.Query().Get("scope")
+		a.logLevels.reset(scope)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.logLevels.status(scope))
+	})
+	// Upgrade endpoints. The upgrade is started in the background, and the result is available via /upgrade/status.
+	mux.HandleFunc("POST /upgrade", func(w http.ResponseWriter, r *http.Request) {
+		if a.upgrader == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("NOT IMPLEMENTED"))
+			return
+		}
+		if !a.authorize(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("UNAUTHORIZED"))
+			return
+		}
+		if err := a.upgrader.triggerUpgrade("admin"); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, errUpgradeInProgress):
+				status = http.StatusConflict
+			case errors.Is(err, errUpgradeNotReady):
+				status = http.StatusServiceUnavailable
+			}
+			w.WriteHeader(status)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(a.upgrader.status())
+	})
+	mux.HandleFunc("GET /upgrade/status", func(w http.ResponseWriter, r *http.Request) {
+		if a.upgrader == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte("NOT IMPLEMENTED"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.upgrader.status())
+	})
 	// Prometheus metrics endpoint.
 	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
 		// If the metrics endpoint is disabled, we will return non 200(OK) status code.
@@ -2,8 +2,10 @@ package srun
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
@@ -257,3 +259,148 @@ func TestHealthcheckAndReadiness(t *testing.T) {
 		}
 	})
 }
+
+var _ adminUpgrader = (*testAdminUpgrader)(nil)
+
+// testAdminUpgrader is the upgrader for testing the admin upgrade endpoints, as the tableflip upgrader can only be created once.
+type testAdminUpgrader struct {
+	err      error
+	triggers int
+}
+
+func (u *testAdminUpgrader) triggerUpgrade(trigger string) error {
+	if u.err != nil {
+		return u.err
+	}
+	u.triggers++
+	return nil
+}
+
+func (u *testAdminUpgrader) status() upgradeStatus {
+	return upgradeStatus{
+		Generation: 1,
+		PID:        2,
+		ParentPID:  1,
+		Listeners:  []upgradeListener{{Network: "tcp", Address: ":8080", Inherited: true}},
+		InProgress: u.triggers > 0,
+	}
+}
+
+func TestAdminUpgrade(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		upgrader      *testAdminUpgrader
+		token         string
+		method        string
+		target        string
+		authorization string
+		expectCode    int
+		expectTrigger bool
+	}{
+		{
+			name:       "upgrader disabled",
+			method:     http.MethodPost,
+			target:     "/upgrade",
+			expectCode: http.StatusNotImplemented,
+		},
+		{
+			name:          "upgrade without token",
+			upgrader:      &testAdminUpgrader{},
+			method:        http.MethodPost,
+			target:        "/upgrade",
+			expectCode:    http.StatusAccepted,
+			expectTrigger: true,
+		},
+		{
+			name:          "upgrade with token",
+			upgrader:      &testAdminUpgrader{},
+			token:         "secret",
+			method:        http.MethodPost,
+			target:        "/upgrade",
+			authorization: "Bearer secret",
+			expectCode:    http.StatusAccepted,
+			expectTrigger: true,
+		},
+		{
+			name:       "missing token",
+			upgrader:   &testAdminUpgrader{},
+			token:      "secret",
+			method:     http.MethodPost,
+			target:     "/upgrade",
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "invalid token",
+			upgrader:      &testAdminUpgrader{},
+			token:         "secret",
+			method:        http.MethodPost,
+			target:        "/upgrade",
+			authorization: "Bearer invalid",
+			expectCode:    http.StatusUnauthorized,
+		},
+		{
+			name:       "upgrade in progress",
+			upgrader:   &testAdminUpgrader{err: errUpgradeInProgress},
+			method:     http.MethodPost,
+			target:     "/upgrade",
+			expectCode: http.StatusConflict,
+		},
+		{
+			name:       "program not ready",
+			upgrader:   &testAdminUpgrader{err: errUpgradeNotReady},
+			method:     http.MethodPost,
+			target:     "/upgrade",
+			expectCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "upgrade status",
+			upgrader:   &testAdminUpgrader{},
+			token:      "secret",
+			method:     http.MethodGet,
+			target:     "/upgrade/status",
+			expectCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			admin, err := newAdminServer(AdminServerConfig{Token: test.token})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.upgrader != nil {
+				admin.setUpgrader(test.upgrader)
+			}
+			req := httptest.NewRequest(test.method, test.target, nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			admin.handler().ServeHTTP(rec, req)
+
+			if rec.Code != test.expectCode {
+				t.Fatalf("expecting status code %d but got %d: %s", test.expectCode, rec.Code, rec.Body.String())
+			}
+			if test.upgrader == nil {
+				return
+			}
+			if triggered := test.upgrader.triggers > 0; triggered != test.expectTrigger {
+				t.Fatalf("expecting upgrade triggered %t but got %t", test.expectTrigger, triggered)
+			}
+			if rec.Code != http.StatusOK && rec.Code != http.StatusAccepted {
+				return
+			}
+			var status upgradeStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.upgrader.status(), status); diff != "" {
+				t.Fatalf("(-want/+got) upgrade status:\n%s", diff)
+			}
+		})
+	}
+}
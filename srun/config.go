@@ -8,16 +8,24 @@ import (
 
 type Config struct {
 	// Name defines the service name and the pid file name.
-	Name string
+	Name string `yaml:"name"`
 	// Version defines the version of the application.
-	Version     string
-	Upgrader    UpgraderConfig
-	Admin       AdminConfig
-	OtelTracer  OTelTracerConfig
-	OtelMetric  OtelMetricConfig
-	Logger      LoggerConfig
-	Healthcheck HealthcheckConfig
-	Timeout     TimeoutConfig
+	Version    string           `yaml:"version"`
+	Upgrader   UpgraderConfig   `yaml:"upgrader"`
+	Admin      AdminConfig      `yaml:"admin"`
+	OtelTracer OTelTracerConfig `yaml:"otel-tracer"`
+	OtelMetric OtelMetricConfig `yaml:"otel-metric"`
+	// RegisterOtelGlobal registers the open telemetry tracer and meter providers of the runner as the global providers, and sets
+	// the W3C trace context and baggage as the global propagator. This allows third-party instrumentation libraries that use the
+	// global providers, for example otelhttp, to send their telemetry data via the runner providers.
+	RegisterOtelGlobal bool              `yaml:"register-otel-global"`
+	Logger             LoggerConfig      `yaml:"logger"`
+	Healthcheck        HealthcheckConfig `yaml:"healthcheck"`
+	Timeout            TimeoutConfig     `yaml:"timeout"`
+	// Reload configures the reload of the application configuration without restarting the program.
+	Reload ReloadConfig `yaml:"reload"`
+	// Systemd configures the integration with systemd, the integration is enabled when the program is started by systemd.
+	Systemd SystemdConfig `yaml:"systemd"`
 	// deadlineDuration is the timeout duration for the runner to run. The program will exit with
 	// ErrRunDeadlineTimeout when deadline exceeded.
 	//
@@ -26,12 +34,40 @@ type Config struct {
 	// This feature is useful for several reasons:
 	//	1. We can use it to test our binary to check whether it really runs or not.
 	//	2. We can use it to limit the execution time in an environment like function as a service.
-	DeadlineDuration time.Duration
+	DeadlineDuration time.Duration `yaml:"deadline-duration"`
+	// legacyEnvLoaded is true when the legacy environment variables are loaded by the ConfigLoader.
+	legacyEnvLoaded bool
+}
+
+// loadLegacyEnv loads the legacy environment variables of the runner configuration. The variables are the aliases of the
+// SRUN_TIMEOUT_READY_TIMEOUT, SRUN_DEADLINE_DURATION and SRUN_TIMEOUT_SHUTDOWN_GRACEFUL_PERIOD environment variables.
+func (c *Config) loadLegacyEnv(lookupEnv func(string) (string, bool)) error {
+	legacyEnvs := []struct {
+		name  string
+		key   string
+		value *time.Duration
+	}{
+		{name: "SRUN_READY_TIMEOUT", key: "timeout.ready-timeout", value: &c.Timeout.ReadyTimeout},
+		{name: "SRUN_DEADLINE_TIMEOUT", key: "deadline-duration", value: &c.DeadlineDuration},
+		{name: "SRUN_GRACEFUL_TIMEOUT", key: "timeout.shutdown-graceful-period", value: &c.Timeout.ShutdownGracefulPeriod},
+	}
+	for _, env := range legacyEnvs {
+		value, ok := lookupEnv(env.name)
+		if !ok || value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return &ConfigKeyError{Key: joinConfigKey(srunConfigKey, env.key), Source: "env " + env.name, Err: err}
+		}
+		*env.value = d
+	}
+	return nil
 }
 
 func (c *Config) Validate() error {
 	if c.Name == "" {
-		return errors.New("service name cannot be empty")
+		return withConfigKey("name", errors.New("service name cannot be empty"))
 	}
 	if c.Timeout.InitTimeout == 0 {
 		c.Timeout.InitTimeout = serviceInitDefaultTimeout
@@ -42,37 +78,31 @@ func (c *Config) Validate() error {
 	if c.Timeout.ShutdownGracefulPeriod == 0 {
 		c.Timeout.ShutdownGracefulPeriod = gracefulShutdownDefaultTimeout
 	}
-	if c.Healthcheck.Interval == 0 {
-		c.Healthcheck.Interval = healthcheckDefaultInterval
+	if c.Timeout.TelemetryShutdownTimeout == 0 {
+		c.Timeout.TelemetryShutdownTimeout = telemetryShutdownDefaultTimeout
 	}
-	if c.Healthcheck.Timeout == 0 {
-		c.Healthcheck.Timeout = healthcheckDefaultTimeout
+	if c.Timeout.DrainTimeout == 0 {
+		c.Timeout.DrainTimeout = max(drainDefaultTimeout, c.Timeout.DrainPeriod)
 	}
-
-	// Respect the configuration from environment variable if available.
-	envReadyTimeout := os.Getenv("SRUN_READY_TIMEOUT")
-	if envReadyTimeout != "" {
-		readyTimeout, err := time.ParseDuration(envReadyTimeout)
-		if err != nil {
-			return err
-		}
-		c.Timeout.ReadyTimeout = readyTimeout
+	if err := c.Logger.validate(); err != nil {
+		return withConfigKey("logger", err)
 	}
-	envDeadlineTimeout := os.Getenv("SRUN_DEADLINE_TIMEOUT")
-	if envDeadlineTimeout != "" {
-		deadlineTimeout, err := time.ParseDuration(envDeadlineTimeout)
-		if err != nil {
-			return err
-		}
-		c.DeadlineDuration = deadlineTimeout
+	if c.Upgrader.Timeout == 0 {
+		c.Upgrader.Timeout = upgradeDefaultTimeout
 	}
-	envGracefulTimeout := os.Getenv("SRUN_GRACEFUL_TIMEOUT")
-	if envGracefulTimeout != "" {
-		gracefulTimeout, err := time.ParseDuration(envGracefulTimeout)
-		if err != nil {
+	if err := c.Reload.validate(); err != nil {
+		return withConfigKey("reload", err)
+	}
+	if err := c.Healthcheck.validate(); err != nil {
+		return withConfigKey("healthcheck", err)
+	}
+
+	// Respect the legacy environment variables if available, unless they are already loaded by the ConfigLoader. The loader
+	// loads them with the precedence of the environment variables, so they don't override the flags.
+	if !c.legacyEnvLoaded {
+		if err := c.loadLegacyEnv(os.LookupEnv); err != nil {
 			return err
 		}
-		c.Timeout.ShutdownGracefulPeriod = gracefulTimeout
 	}
 	return nil
 }
@@ -80,9 +110,20 @@ func (c *Config) Validate() error {
 // TimeoutConfig is timeout configuration for several configurable configurations.
 type TimeoutConfig struct {
 	// InitTimeout is the timeout to initiate a service. The timeout is per-service and not the total duration of initialization.
-	InitTimeout time.Duration
+	InitTimeout time.Duration `yaml:"init-timeout"`
 	// ReadyTimeout is the timeout to wait for a service to be ready. The timeout is per-service and not the total duration of ready wait.
-	ReadyTimeout time.Duration
-	// ShutdownGracefulPeriod is the timeout for runner waiting for all services to stop.
-	ShutdownGracefulPeriod time.Duration
+	ReadyTimeout time.Duration `yaml:"ready-timeout"`
+	// ShutdownGracefulPeriod is the timeout for runner waiting for all services to stop. The period is shared by the services
+	// in ShutdownPhaseIngress and ShutdownPhaseDefault.
+	ShutdownGracefulPeriod time.Duration `yaml:"shutdown-graceful-period"`
+	// TelemetryShutdownTimeout is the timeout for runner waiting for the services in ShutdownPhaseTelemetry to stop. The timeout
+	// is not a part of the graceful period, so the telemetry services always have the time to flush their data.
+	TelemetryShutdownTimeout time.Duration `yaml:"telemetry-shutdown-timeout"`
+	// DrainPeriod is the minimum duration of the drain phase before the runner stops the services. In the drain phase, the
+	// program is marked as not ready while the services are still serving. The drain phase is disabled if the period is zero
+	// and none of the services implements ServiceDrainAware.
+	DrainPeriod time.Duration `yaml:"drain-period"`
+	// DrainTimeout is the maximum duration of the drain phase, including the time to wait for the services that implement
+	// ServiceDrainAware to finish draining.
+	DrainTimeout time.Duration `yaml:"drain-timeout"`
 }
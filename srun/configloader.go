@@ -0,0 +1,643 @@
+package srun
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// srunConfigKey is the key of the runner configuration inside the configuration files.
+	srunConfigKey = "srun"
+	// srunConfigEnvPrefix is the prefix of the environment variables of the runner configuration.
+	srunConfigEnvPrefix = "SRUN"
+	// configFileFlag is the flag to add the configuration files, the flag can be repeated.
+	configFileFlag = "config"
+)
+
+var (
+	levelerType = reflect.TypeFor[slog.Leveler]()
+	// configInterpolationRegexp matches ${ENV} and ${ENV:-default} inside the configuration files, the '$${' is an escape of '${'.
+	configInterpolationRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+)
+
+// ConfigLoader loads the runner configuration and the application configuration from the files, environment variables and
+// command line flags. The sources are applied in the order below, so the later source overrides the earlier one:
+//
+//  1. The values that are already set in the configurations.
+//  2. The files, in the order of Files and then the -config flags.
+//  3. The environment variables.
+//  4. The command line flags.
+//
+// The key of a configuration is the path of the yaml tags, for example 'timeout.ready-timeout'. The runner configuration is
+// placed under the 'srun' key in the files, the 'SRUN_' prefix in the environment variables, for example
+// SRUN_TIMEOUT_READY_TIMEOUT, and the 'srun.' prefix in the flags, for example -srun.timeout.ready-timeout=10s. The application
+// configuration is placed at the root of the files, the EnvPrefix in the environment variables, and without prefix in the flags.
+//
+// Only the scalar values, the slices of scalar values and the maps of scalar values can be set via the environment variables
+// and the flags. The slices are comma separated, for example 'a,b,c', and the maps are comma separated key-value pairs, for
+// example 'key1=value1,key2=value2'.
+type ConfigLoader struct {
+	// Files is the list of YAML or JSON configuration files. The string values inside the files support ${ENV} and
+	// ${ENV:-default} interpolation from the environment variables.
+	Files []string
+	// EnvPrefix is the prefix of the environment variables of the application configuration, for example 'APP' loads
+	// 'database.dsn' from APP_DATABASE_DSN. The application configuration is not loaded from the environment variables if
+	// the prefix is empty.
+	EnvPrefix string
+	// Args is the command line arguments without the program name. The default is os.Args[1:].
+	Args []string
+	// FlagSet is the flag set to register the configuration flags, so the application can define its own flags in the same
+	// flag set. A new flag set is used if the flag set is nil.
+	FlagSet *flag.FlagSet
+	// lookupEnv looks up the environment variables, the default is os.LookupEnv.
+	lookupEnv func(string) (string, bool)
+
+	// loaded, files, flagValues and appConfigType are recorded by Load, so the configurations can be reloaded from the same
+	// sources without parsing the command line arguments again.
+	loaded        bool
+	files         []string
+	flagValues    []configFlagValue
+	appConfigType reflect.Type
+}
+
+// ConfigKeyError is the error of loading a configuration key.
+type ConfigKeyError struct {
+	// Key is the path of the key, for example 'srun.timeout.ready-timeout' or 'resources.postgres.connects[0].dsn'.
+	Key string
+	// Source is the source of the value, for example the file path, the environment variable or the flag.
+	Source string
+	Err    error
+}
+
+func (e *ConfigKeyError) Error() string {
+	return fmt.Sprintf("config %s (%s): %v", e.Key, e.Source, e.Err)
+}
+
+func (e *ConfigKeyError) Unwrap() error {
+	return e.Err
+}
+
+// configValidationError is the error of validating a configuration key. The key is the path of the key relative to the validated
+// configuration, so the loader can name the offending key path.
+type configValidationError struct {
+	key string
+	err error
+}
+
+func (e *configValidationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configValidationError) Unwrap() error {
+	return e.err
+}
+
+// withConfigKey prefixes the key of the validation error with the parent key. The error that is not a validation error is
+// reported as the error of the parent key.
+func withConfigKey(parent string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var validationErr *configValidationError
+	if errors.As(err, &validationErr) {
+		return &configValidationError{key: joinConfigKey(parent, validationErr.key), err: validationErr.err}
+	}
+	return &configValidationError{key: parent, err: err}
+}
+
+// configTarget is a configuration that is loaded by the loader.
+type configTarget struct {
+	key        string
+	envPrefix  string
+	flagPrefix string
+	value      reflect.Value
+}
+
+// configLeaf is a configuration key that can be set via the environment variables and the flags.
+type configLeaf struct {
+	path []string
+	typ  reflect.Type
+}
+
+// configFlagValue is the value of a configuration flag.
+type configFlagValue struct {
+	// target is the index of the configuration target of the flag.
+	target int
+	leaf   configLeaf
+	name   string
+	value  string
+}
+
+// Load loads the runner configuration and the application configuration. The application configuration must be a pointer to
+// a struct, and it is validated after loaded if it implements Validate() error. The application configuration is optional.
+func (l *ConfigLoader) Load(config *Config, appConfig any) error {
+	targets, err := l.targets(config, appConfig)
+	if err != nil {
+		return err
+	}
+
+	// Register the flags first as the files can be added via the flags. The flag values are applied last.
+	fs := l.FlagSet
+	if fs == nil {
+		fs = flag.NewFlagSet("srun", flag.ContinueOnError)
+	}
+	files := slices.Clone(l.Files)
+	fs.Func(configFileFlag, "path to the YAML or JSON configuration file, the flag can be repeated", func(s string) error {
+		files = append(files, s)
+		return nil
+	})
+	var flagValues []configFlagValue
+	for idx, target := range targets {
+		for _, leaf := range configLeaves(target.value.Type(), nil, nil) {
+			name := target.flagPrefix + strings.Join(leaf.path, ".")
+			record := func(s string) error {
+				flagValues = append(flagValues, configFlagValue{target: idx, leaf: leaf, name: name, value: s})
+				return nil
+			}
+			usage := leaf.typ.String()
+			if leaf.typ.Kind() == reflect.Bool {
+				fs.BoolFunc(name, usage, record)
+				continue
+			}
+			fs.Func(name, usage, record)
+		}
+	}
+	args := l.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	l.loaded = true
+	l.files = files
+	l.flagValues = flagValues
+	l.appConfigType = reflect.TypeOf(appConfig)
+	return l.load(config, targets, appConfig)
+}
+
+// Reload loads the configurations again from the same files, environment variables and flags of the last Load. The command line
+// arguments are not parsed again, so the flag values are the same with the last Load. The configurations should be new values
+// with the default values set, and the application configuration must have the same type with the one passed to Load.
+func (l *ConfigLoader) Reload(config *Config, appConfig any) error {
+	if !l.loaded {
+		return errors.New("config loader: reload is called before load")
+	}
+	if typ := reflect.TypeOf(appConfig); typ != l.appConfigType {
+		return fmt.Errorf("config loader: application config type %v is different with the loaded type %v", typ, l.appConfigType)
+	}
+	targets, err := l.targets(config, appConfig)
+	if err != nil {
+		return err
+	}
+	return l.load(config, targets, appConfig)
+}
+
+// LoadedFiles returns the configuration files of the last Load, including the files added via the -config flags.
+func (l *ConfigLoader) LoadedFiles() []string {
+	return slices.Clone(l.files)
+}
+
+// targets returns the configuration targets of the runner configuration and the application configuration.
+func (l *ConfigLoader) targets(config *Config, appConfig any) ([]*configTarget, error) {
+	if config == nil {
+		return nil, errors.New("config loader: srun config cannot be nil")
+	}
+	targets := []*configTarget{
+		{key: srunConfigKey, envPrefix: srunConfigEnvPrefix, flagPrefix: srunConfigKey + ".", value: reflect.ValueOf(config).Elem()},
+	}
+	if appConfig != nil {
+		v := reflect.ValueOf(appConfig)
+		if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return nil, errors.New("config loader: application config must be a non-nil pointer to a struct")
+		}
+		targets = append(targets, &configTarget{envPrefix: l.EnvPrefix, value: v.Elem()})
+	}
+	return targets, nil
+}
+
+// load applies the files, the environment variables and the recorded flag values to the targets.
+func (l *ConfigLoader) load(config *Config, targets []*configTarget, appConfig any) error {
+	lookupEnv := l.lookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	for _, file := range l.files {
+		if err := loadConfigFile(file, targets, lookupEnv); err != nil {
+			return err
+		}
+	}
+	// The legacy environment variables are loaded before the other environment variables as their aliases, and Validate
+	// doesn't load them again so they don't override the flags.
+	if err := config.loadLegacyEnv(lookupEnv); err != nil {
+		return err
+	}
+	config.legacyEnvLoaded = true
+	for _, target := range targets {
+		if target.envPrefix == "" {
+			continue
+		}
+		for _, leaf := range configLeaves(target.value.Type(), nil, nil) {
+			name := target.envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(strings.Join(leaf.path, "_"), "-", "_"))
+			value, ok := lookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := target.set(leaf, value, "env "+name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, fv := range l.flagValues {
+		if err := targets[fv.target].set(fv.leaf, fv.value, "flag -"+fv.name); err != nil {
+			return err
+		}
+	}
+
+	// Validate a copy of the runner configuration, so the defaults are set by the runner and not recorded as loaded values.
+	validated := *config
+	if err := validated.Validate(); err != nil {
+		var validationErr *configValidationError
+		if errors.As(err, &validationErr) {
+			return &ConfigKeyError{Key: joinConfigKey(srunConfigKey, validationErr.key), Source: "validation", Err: validationErr.err}
+		}
+		return err
+	}
+	if validator, ok := appConfig.(interface{ Validate() error }); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// set sets the value of the leaf from the environment variable or the flag.
+func (t *configTarget) set(leaf configLeaf, value, source string) error {
+	v := t.value
+	for _, name := range leaf.path {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v, _ = configStructField(v, name)
+	}
+
+	var node *yaml.Node
+	switch typ := derefType(leaf.typ); {
+	case typ.Kind() == reflect.Slice && !isConfigUnmarshaler(typ):
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		if value != "" {
+			for _, item := range strings.Split(value, ",") {
+				node.Content = append(node.Content, configScalarNode(strings.TrimSpace(item), typ.Elem()))
+			}
+		}
+	case typ.Kind() == reflect.Map && !isConfigUnmarshaler(typ):
+		node = &yaml.Node{Kind: yaml.MappingNode}
+		if value != "" {
+			for _, pair := range strings.Split(value, ",") {
+				k, v, ok := strings.Cut(pair, "=")
+				if !ok {
+					return &ConfigKeyError{Key: joinConfigKey(t.key, strings.Join(leaf.path, ".")), Source: source, Err: fmt.Errorf("invalid key-value pair %q", pair)}
+				}
+				node.Content = append(node.Content, configScalarNode(strings.TrimSpace(k), typ.Key()), configScalarNode(strings.TrimSpace(v), typ.Elem()))
+			}
+		}
+	default:
+		node = configScalarNode(value, typ)
+	}
+	return decodeConfigNode(node, v, joinConfigKey(t.key, strings.Join(leaf.path, ".")), source)
+}
+
+// loadConfigFile loads the configuration file into the targets. The 'srun' key is loaded into the runner configuration, and
+// the other keys are loaded into the application configuration.
+func loadConfigFile(path string, targets []*configTarget, lookupEnv func(string) (string, bool)) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("config file %s: unsupported file format, the supported formats are YAML and JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// JSON is a subset of YAML, so both formats are parsed with the YAML parser.
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	node := root.Content[0]
+	if err := interpolateConfigNode(node, "", path, lookupEnv); err != nil {
+		return err
+	}
+	if node.Kind != yaml.MappingNode {
+		return &ConfigKeyError{Source: path, Err: errors.New("expecting a mapping at the root of the file")}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if key == srunConfigKey {
+			if err := decodeConfigNode(value, targets[0].value, key, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(targets) == 1 {
+			return &ConfigKeyError{Key: key, Source: path, Err: errors.New("unknown key")}
+		}
+		field, ok := configStructField(targets[1].value, key)
+		if !ok {
+			return &ConfigKeyError{Key: key, Source: path, Err: errors.New("unknown key")}
+		}
+		if err := decodeConfigNode(value, field, key, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpolateConfigNode replaces ${ENV} and ${ENV:-default} inside the string values with the environment variables.
+func interpolateConfigNode(node *yaml.Node, key, source string, lookupEnv func(string) (string, bool)) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := interpolateConfigNode(node.Content[i+1], joinConfigKey(key, node.Content[i].Value), source, lookupEnv); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for idx, item := range node.Content {
+			if err := interpolateConfigNode(item, fmt.Sprintf("%s[%d]", key, idx), source, lookupEnv); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		var err error
+		node.Value = configInterpolationRegexp.ReplaceAllStringFunc(node.Value, func(s string) string {
+			if strings.HasPrefix(s, "$$") {
+				return s[1:]
+			}
+			match := configInterpolationRegexp.FindStringSubmatch(s)
+			if value, ok := lookupEnv(match[1]); ok {
+				return value
+			}
+			if match[2] != "" {
+				return match[3]
+			}
+			err = errors.Join(err, fmt.Errorf("environment variable %s is not set", match[1]))
+			return s
+		})
+		if err != nil {
+			return &ConfigKeyError{Key: key, Source: source, Err: err}
+		}
+		// Resolve the type of the plain value again, so the interpolated value can be a number or a boolean.
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0 {
+			node.Tag = ""
+		}
+	}
+	return nil
+}
+
+// decodeConfigNode decodes the node into the value. The struct fields that are not inside the node are kept as they are, so
+// the sources can be applied on top of each other.
+func decodeConfigNode(node *yaml.Node, v reflect.Value, key, source string) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	keyErr := func(err error) error {
+		if err == nil {
+			return nil
+		}
+		return &ConfigKeyError{Key: key, Source: source, Err: err}
+	}
+	if isConfigUnmarshaler(v.Type()) {
+		return keyErr(node.Decode(v.Addr().Interface()))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if node.ShortTag() == "!!null" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeConfigNode(node, v.Elem(), key, source)
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return keyErr(errors.New("expecting a mapping"))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i].Value
+			field, ok := configStructField(v, name)
+			if !ok {
+				return &ConfigKeyError{Key: joinConfigKey(key, name), Source: source, Err: errors.New("unknown key")}
+			}
+			if err := decodeConfigNode(node.Content[i+1], field, joinConfigKey(key, name), source); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		if node.ShortTag() == "!!null" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if node.Kind != yaml.SequenceNode {
+			return keyErr(errors.New("expecting a sequence"))
+		}
+		s := reflect.MakeSlice(v.Type(), len(node.Content), len(node.Content))
+		for idx, item := range node.Content {
+			if err := decodeConfigNode(item, s.Index(idx), fmt.Sprintf("%s[%d]", key, idx), source); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return keyErr(errors.New("expecting a mapping"))
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			mapKey := reflect.New(v.Type().Key())
+			if err := node.Content[i].Decode(mapKey.Interface()); err != nil {
+				return keyErr(err)
+			}
+			mapValue := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeConfigNode(node.Content[i+1], mapValue, joinConfigKey(key, node.Content[i].Value), source); err != nil {
+				return err
+			}
+			v.SetMapIndex(mapKey.Elem(), mapValue)
+		}
+	case reflect.Interface:
+		// slog.Leveler is the only interface that is supported, so the level of the log sinks can be configured.
+		if v.Type() != levelerType {
+			return keyErr(fmt.Errorf("unsupported type %s", v.Type()))
+		}
+		var level slog.Level
+		if err := node.Decode(&level); err != nil {
+			return keyErr(err)
+		}
+		v.Set(reflect.ValueOf(level))
+	default:
+		if node.Kind != yaml.ScalarNode {
+			return keyErr(errors.New("expecting a scalar value"))
+		}
+		return keyErr(node.Decode(v.Addr().Interface()))
+	}
+	return nil
+}
+
+// configLeaves returns the keys of the type that can be set via the environment variables and the flags.
+func configLeaves(typ reflect.Type, path []string, visited []reflect.Type) []configLeaf {
+	typ = derefType(typ)
+	if isConfigScalar(typ) {
+		return []configLeaf{{path: path, typ: typ}}
+	}
+	switch typ.Kind() {
+	case reflect.Slice:
+		if isConfigScalar(derefType(typ.Elem())) {
+			return []configLeaf{{path: path, typ: typ}}
+		}
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.String && isConfigScalar(derefType(typ.Elem())) {
+			return []configLeaf{{path: path, typ: typ}}
+		}
+	case reflect.Struct:
+		// Prevent infinite recursion of the recursive types.
+		if slices.Contains(visited, typ) {
+			return nil
+		}
+		visited = append(visited, typ)
+		var leaves []configLeaf
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, inline, ok := configFieldKey(field)
+			if !ok {
+				continue
+			}
+			if inline {
+				leaves = append(leaves, configLeaves(field.Type, path, visited)...)
+				continue
+			}
+			leaves = append(leaves, configLeaves(field.Type, append(slices.Clip(path), name), visited)...)
+		}
+		return leaves
+	}
+	return nil
+}
+
+// configStructField returns the field of the struct by its key, including the fields of the inlined structs.
+func configStructField(v reflect.Value, key string) (reflect.Value, bool) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name, inline, ok := configFieldKey(typ.Field(i))
+		if !ok {
+			continue
+		}
+		field := v.Field(i)
+		if !inline {
+			if name == key {
+				return field, true
+			}
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+		if f, ok := configStructField(field, key); ok {
+			return f, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// configFieldKey returns the key of the field based on the yaml tag. The key is the lowercase field name if the tag is not set,
+// the same as the yaml package.
+func configFieldKey(field reflect.StructField) (name string, inline, ok bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return "", false, false
+	}
+	if slices.Contains(strings.Split(opts, ","), "inline") {
+		return "", true, true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false, true
+}
+
+// isConfigScalar returns true if the type is decoded from a single value.
+func isConfigScalar(typ reflect.Type) bool {
+	if typ == levelerType || isConfigUnmarshaler(typ) {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isConfigUnmarshaler returns true if the type decodes itself from the yaml node.
+func isConfigUnmarshaler(typ reflect.Type) bool {
+	ptr := reflect.PointerTo(typ)
+	return ptr.Implements(reflect.TypeFor[yaml.Unmarshaler]()) ||
+		ptr.Implements(reflect.TypeFor[interface {
+			UnmarshalYAML(unmarshal func(any) error) error
+		}]()) ||
+		ptr.Implements(reflect.TypeFor[encoding.TextUnmarshaler]())
+}
+
+// configScalarNode creates a yaml node of the value from the environment variables and the flags. The value is always a
+// string if the type is a string, so values like 'true' and '123' are not resolved as other types.
+func configScalarNode(value string, typ reflect.Type) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if derefType(typ).Kind() == reflect.String && !isConfigUnmarshaler(derefType(typ)) {
+		node.Tag = "!!str"
+	}
+	return node
+}
+
+func derefType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+func joinConfigKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,221 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ServiceDependencyAware defines a service that aware of its dependencies to other services inside the runner. The runner
+// uses the dependencies to build a directed acyclic graph(DAG) of services, so services that don't depend on each other
+// can be started concurrently.
+//
+// The dependencies are declared by the name of the other services. For example:
+//
+//	func (s *HTTPServer) DependsOn() []string {
+//		return []string{"resources"}
+//	}
+//
+// Services that don't implement this interface depends on the service registered before them, so the default FIFO
+// order is still respected for them.
+type ServiceDependencyAware interface {
+	DependsOn() []string
+}
+
+// serviceGraph is the directed acyclic graph of the services inside the runner. The graph is used to start the services
+// in topological order and stop them in reverse-topological order.
+//
+// There are three kinds of dependency in the graph:
+//  1. Internal services depend on the internal service registered before them.
+//  2. Services that implement ServiceDependencyAware depend on their declared dependencies and on the internal services.
+//  3. Other services depend on the previous service that doesn't implement ServiceDependencyAware, or on the internal
+//     services if there are none.
+//
+// This way, the internal services are always at the bottom of the stack and the FIFO order is preserved for services that
+// don't declare their dependencies.
+type serviceGraph struct {
+	services []*ServiceStateTracker
+	// dependencies is the list of service index that the service at index depends on.
+	dependencies [][]int
+	// dependents is the list of service index that depend on the service at index.
+	dependents [][]int
+}
+
+// newServiceGraph builds the graph of services and returns an error if the graph contains cycle. When allowMissing is true,
+// the dependency that is not registered yet is ignored. This is needed because we check for cycles when the services are
+// registered, and the dependency might be registered later.
+func newServiceGraph(services []*ServiceStateTracker, allowMissing bool) (*serviceGraph, error) {
+	g := &serviceGraph{
+		services:     services,
+		dependencies: make([][]int, len(services)),
+		dependents:   make([][]int, len(services)),
+	}
+
+	names := make(map[string][]int)
+	for idx, svc := range services {
+		names[svc.Name()] = append(names[svc.Name()], idx)
+	}
+
+	lastInternal, lastImplicit := -1, -1
+	for idx, svc := range services {
+		var deps []int
+		dependsOn, declared := svc.dependsOn()
+		switch {
+		case svc.isType(serviceTypeInternal):
+			if lastInternal >= 0 {
+				deps = append(deps, lastInternal)
+			}
+			lastInternal = idx
+
+		case declared:
+			if lastInternal >= 0 {
+				deps = append(deps, lastInternal)
+			}
+			for _, name := range dependsOn {
+				if name == svc.Name() {
+					return nil, fmt.Errorf("%w: service %s depends on itself", errServiceDependencyCycle, name)
+				}
+				found := names[name]
+				switch len(found) {
+				case 0:
+					if allowMissing {
+						continue
+					}
+					return nil, fmt.Errorf("%w: service %s depends on %s", errServiceDependencyNotFound, svc.Name(), name)
+				case 1:
+					if !slices.Contains(deps, found[0]) {
+						deps = append(deps, found[0])
+					}
+				default:
+					return nil, fmt.Errorf("service %s depends on %s, but there are %d services with the same name", svc.Name(), name, len(found))
+				}
+			}
+
+		default:
+			if lastImplicit >= 0 {
+				deps = append(deps, lastImplicit)
+			} else if lastInternal >= 0 {
+				deps = append(deps, lastInternal)
+			}
+			lastImplicit = idx
+		}
+
+		g.dependencies[idx] = deps
+		for _, dep := range deps {
+			g.dependents[dep] = append(g.dependents[dep], idx)
+		}
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		path := make([]string, len(cycle))
+		for i, idx := range cycle {
+			path[i] = services[idx].Name()
+		}
+		return nil, fmt.Errorf("%w: %s", errServiceDependencyCycle, strings.Join(path, " -> "))
+	}
+	return g, nil
+}
+
+// findCycle returns the path of the cycle inside the graph using depth-first search, or nil if there are no cycle.
+func (g *serviceGraph) findCycle() []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make([]int, len(g.services))
+	var stack []int
+
+	var visit func(idx int) []int
+	visit = func(idx int) []int {
+		marks[idx] = visiting
+		stack = append(stack, idx)
+		for _, dep := range g.dependencies[idx] {
+			switch marks[dep] {
+			case visiting:
+				// Build the path from the first occurence of the dependency in the stack.
+				start := slices.Index(stack, dep)
+				return append(slices.Clone(stack[start:]), dep)
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[idx] = visited
+		return nil
+	}
+
+	for idx := range g.services {
+		if marks[idx] != unvisited {
+			continue
+		}
+		if cycle := visit(idx); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// walk invokes fn for all services in the graph. Each service is invoked in its own goroutine as soon as all the services
+// it waits for are done, so the independent branches of the graph are walked concurrently.
+//
+// In the forward direction a service waits for its dependencies, and in the reverse direction a service waits for its
+// dependents. When abortOnError is true, services that are not yet invoked will be skipped after the first error and
+// the function returns the first error. Otherwise all services are invoked and all errors are joined.
+func (g *serviceGraph) walk(ctx context.Context, reverse, abortOnError bool, fn func(context.Context, *ServiceStateTracker) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		err   error
+		doneC = make([]chan struct{}, len(g.services))
+	)
+	for idx := range doneC {
+		doneC[idx] = make(chan struct{})
+	}
+
+	for idx, svc := range g.services {
+		waitFor := g.dependencies[idx]
+		if reverse {
+			waitFor = g.dependents[idx]
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(doneC[idx])
+
+			for _, w := range waitFor {
+				select {
+				case <-ctx.Done():
+					return
+				case <-doneC[w]:
+				}
+			}
+			if abortOnError && ctx.Err() != nil {
+				return
+			}
+			if errFn := fn(ctx, svc); errFn != nil {
+				errMu.Lock()
+				if abortOnError {
+					if err == nil {
+						err = errFn
+					}
+					cancel(errFn)
+				} else {
+					err = errors.Join(err, errFn)
+				}
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
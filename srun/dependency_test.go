@@ -0,0 +1,262 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ ServiceDependencyAware = (*serviceWithDependencies)(nil)
+
+// serviceWithDependencies is a service that declares its dependencies and records the order of its lifecycle to the recorder.
+type serviceWithDependencies struct {
+	name     string
+	deps     []string
+	recorder *lifecycleRecorder
+	onInit   func()
+
+	stopC chan struct{}
+}
+
+func newServiceWithDependencies(name string, recorder *lifecycleRecorder, deps ...string) *serviceWithDependencies {
+	return &serviceWithDependencies{
+		name:     name,
+		deps:     deps,
+		recorder: recorder,
+		stopC:    make(chan struct{}),
+	}
+}
+
+func (s *serviceWithDependencies) Name() string {
+	return s.name
+}
+
+func (s *serviceWithDependencies) DependsOn() []string {
+	return s.deps
+}
+
+func (s *serviceWithDependencies) Init(Context) error {
+	if s.onInit != nil {
+		s.onInit()
+	}
+	s.recorder.record("init:" + s.name)
+	return nil
+}
+
+func (s *serviceWithDependencies) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-s.stopC:
+	}
+	return nil
+}
+
+func (s *serviceWithDependencies) Ready(context.Context) error {
+	return nil
+}
+
+func (s *serviceWithDependencies) Stop(context.Context) error {
+	s.recorder.record("stop:" + s.name)
+	close(s.stopC)
+	return nil
+}
+
+type lifecycleRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *lifecycleRecorder) record(event string) {
+	l.mu.Lock()
+	l.events = append(l.events, event)
+	l.mu.Unlock()
+}
+
+func (l *lifecycleRecorder) index(event string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Index(l.events, event)
+}
+
+func TestServiceGraph(t *testing.T) {
+	t.Parallel()
+
+	internal := func(name string) *ServiceStateTracker {
+		tracker := newServiceStateTracker(&serviceDoNothing{name: name}, slog.Default())
+		tracker.svcTypes = append(tracker.svcTypes, serviceTypeInternal)
+		return tracker
+	}
+	implicit := func(name string) *ServiceStateTracker {
+		return newServiceStateTracker(&serviceDoNothing{name: name}, slog.Default())
+	}
+	explicit := func(name string, deps ...string) *ServiceStateTracker {
+		return newServiceStateTracker(newServiceWithDependencies(name, nil, deps...), slog.Default())
+	}
+
+	tests := []struct {
+		name         string
+		services     []*ServiceStateTracker
+		allowMissing bool
+		expect       [][]int
+		err          error
+	}{
+		{
+			name:     "implicit services",
+			services: []*ServiceStateTracker{internal("admin"), implicit("a"), implicit("b")},
+			expect:   [][]int{nil, {0}, {1}},
+		},
+		{
+			name: "explicit services",
+			services: []*ServiceStateTracker{
+				internal("admin"),
+				internal("otel"),
+				explicit("resources"),
+				explicit("http", "resources"),
+				explicit("consumer", "resources", "http"),
+			},
+			expect: [][]int{nil, {0}, {1}, {1, 2}, {1, 2, 3}},
+		},
+		{
+			name: "mixed services",
+			services: []*ServiceStateTracker{
+				internal("admin"),
+				implicit("resources"),
+				explicit("http", "resources"),
+				implicit("grpc"),
+			},
+			expect: [][]int{nil, {0}, {0, 1}, {1}},
+		},
+		{
+			name: "depends on itself",
+			services: []*ServiceStateTracker{
+				explicit("a", "a"),
+			},
+			err: errServiceDependencyCycle,
+		},
+		{
+			name: "cycle",
+			services: []*ServiceStateTracker{
+				explicit("a", "c"),
+				explicit("b", "a"),
+				explicit("c", "b"),
+			},
+			err: errServiceDependencyCycle,
+		},
+		{
+			name: "dependency not found",
+			services: []*ServiceStateTracker{
+				explicit("a", "b"),
+			},
+			err: errServiceDependencyNotFound,
+		},
+		{
+			name: "allow missing dependency",
+			services: []*ServiceStateTracker{
+				explicit("a", "b"),
+			},
+			allowMissing: true,
+			expect:       [][]int{nil},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			graph, err := newServiceGraph(test.services, test.allowMissing)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expecting error %v but got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.expect, graph.dependencies); diff != "" {
+				t.Fatalf("(-want/+got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegisterDependencyCycle(t *testing.T) {
+	t.Parallel()
+
+	r := New(Config{
+		Name:       "testing_dependency_cycle",
+		Admin:      AdminConfig{Disable: true},
+		OtelTracer: OTelTracerConfig{Disable: true},
+		OtelMetric: OtelMetricConfig{Disable: true},
+	})
+	registrar := newRegistrar(r)
+	if err := registrar.Register(newServiceWithDependencies("a", nil, "b")); err != nil {
+		t.Fatal(err)
+	}
+	err := registrar.Register(newServiceWithDependencies("b", nil, "a"))
+	if !errors.Is(err, errServiceDependencyCycle) {
+		t.Fatalf("expecting error %v but got %v", errServiceDependencyCycle, err)
+	}
+	// The service that forming a cycle should not be registered.
+	if len(r.services) != 1 {
+		t.Fatalf("expecting 1 registered service but got %d", len(r.services))
+	}
+}
+
+func TestDependencyStartStopOrder(t *testing.T) {
+	t.Parallel()
+
+	recorder := &lifecycleRecorder{}
+	resources := newServiceWithDependencies("resources", recorder)
+	http := newServiceWithDependencies("http", recorder, "resources")
+	consumer := newServiceWithDependencies("consumer", recorder, "resources")
+	gateway := newServiceWithDependencies("gateway", recorder, "http", "consumer")
+
+	// Both http and consumer only depend on resources, so they should be started concurrently. Wait until both of them
+	// are being initiated to prove that.
+	var initWg sync.WaitGroup
+	initWg.Add(2)
+	concurrentInit := func() {
+		initWg.Done()
+		initWg.Wait()
+	}
+	http.onInit = concurrentInit
+	consumer.onInit = concurrentInit
+
+	config := Config{
+		Name:       "testing_dependency_order",
+		Admin:      AdminConfig{Disable: true},
+		OtelTracer: OTelTracerConfig{Disable: true},
+		OtelMetric: OtelMetricConfig{Disable: true},
+		Timeout: TimeoutConfig{
+			InitTimeout: time.Second * 3,
+		},
+		DeadlineDuration: time.Second * 2,
+	}
+	err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+		// Register in a random order as the order will be determined by the dependencies.
+		return runner.Register(gateway, consumer, http, resources)
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+
+	before := [][2]string{
+		{"init:resources", "init:http"},
+		{"init:resources", "init:consumer"},
+		{"init:http", "init:gateway"},
+		{"init:consumer", "init:gateway"},
+		{"stop:gateway", "stop:http"},
+		{"stop:gateway", "stop:consumer"},
+		{"stop:http", "stop:resources"},
+		{"stop:consumer", "stop:resources"},
+	}
+	for _, b := range before {
+		first, second := recorder.index(b[0]), recorder.index(b[1])
+		if first < 0 || second < 0 || first > second {
+			t.Fatalf("expecting %s before %s, got events %v", b[0], b[1], recorder.events)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package srun
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const drainDefaultTimeout = time.Second * 30
+
+// ServiceDrainAware defines a service that reacts to the start of the drain phase. The drain phase happens before the runner
+// stops all the services, and the program is marked as not ready during the phase while the services are still serving.
+//
+// For example, a http server can use the drain phase to wait until all in-flight requests are finished:
+//
+//	func (s *HTTPServer) Drain(ctx context.Context) error {
+//		for s.inFlight.Load() > 0 {
+//			select {
+//			case <-ctx.Done():
+//				return ctx.Err()
+//			case <-time.After(time.Millisecond * 100):
+//			}
+//		}
+//		return nil
+//	}
+type ServiceDrainAware interface {
+	// Drain is invoked when the drain phase starts. The function should block until the service is drained or the context
+	// is cancelled because the drain timeout is reached.
+	Drain(ctx context.Context) error
+}
+
+// drain runs the drain phase of the runner. The phase waits until the drain period is passed and all services that implement
+// ServiceDrainAware are drained, or until the drain timeout is reached.
+func (r *Runner) drain() {
+	var drainers []*ServiceStateTracker
+	for _, svc := range r.services {
+		if _, ok := svc.ServiceInitAware.(ServiceDrainAware); ok {
+			drainers = append(drainers, svc)
+		}
+	}
+	if r.config.Timeout.DrainPeriod == 0 && len(drainers) == 0 {
+		return
+	}
+
+	start := time.Now()
+	r.logger.Info(
+		"Draining services",
+		slog.Duration("drain_period", r.config.Timeout.DrainPeriod),
+		slog.Duration("drain_timeout", r.config.Timeout.DrainTimeout),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout.DrainTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, svc := range drainers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := svc.ServiceInitAware.(ServiceDrainAware).Drain(ctx); err != nil {
+				r.logger.Error(
+					fmt.Sprintf("[Service] %s: failed to drain service", svc.Name()),
+					slog.String("error", err.Error()),
+				)
+			}
+		}()
+	}
+	drainedC := make(chan struct{})
+	go func() {
+		wg.Wait()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(start.Add(r.config.Timeout.DrainPeriod))):
+		}
+		close(drainedC)
+	}()
+
+	select {
+	case <-ctx.Done():
+		r.logger.Warn("Drain timeout reached", slog.Duration("drain_duration", time.Since(start)))
+	case <-drainedC:
+		r.logger.Info("Services drained", slog.Duration("drain_duration", time.Since(start)))
+	}
+}
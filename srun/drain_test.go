@@ -0,0 +1,184 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var _ ServiceDrainAware = (*serviceWithDrain)(nil)
+
+// serviceWithDrain is a service that records its state when the drain phase starts.
+type serviceWithDrain struct {
+	*serviceDoNothing
+	runner *Runner
+
+	drained        atomic.Bool
+	runCtxAlive    atomic.Bool
+	readyInDrain   atomic.Bool
+	stoppedInDrain atomic.Bool
+	runCtx         atomic.Value
+	// readyCodeInDrain is the status code of the admin /ready endpoint in the drain phase, if the admin server is enabled.
+	readyCodeInDrain atomic.Int32
+}
+
+func (s *serviceWithDrain) Drain(ctx context.Context) error {
+	runCtx := s.runCtx.Load().(context.Context)
+	s.runCtxAlive.Store(runCtx.Err() == nil)
+	s.readyInDrain.Store(s.runner.readinessReport().OK())
+	if s.runner.adminServer != nil {
+		rec := httptest.NewRecorder()
+		s.runner.adminServer.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		s.readyCodeInDrain.Store(int32(rec.Code))
+	}
+	// Simulate waiting for the in-flight requests.
+	time.Sleep(time.Millisecond * 500)
+	s.drained.Store(true)
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		Name:             "testing_drain",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second,
+	}
+
+	t.Run("drain hook", func(t *testing.T) {
+		t.Parallel()
+
+		r := New(config)
+		svc := &serviceWithDrain{runner: r}
+		svc.serviceDoNothing = &serviceDoNothing{
+			errC: make(chan error, 1),
+			onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
+				svc.runCtx.Store(ctx)
+				<-ctx.Done()
+				// The service must be stopped after the drain is finished.
+				svc.stoppedInDrain.Store(!svc.drained.Load())
+				return nil
+			},
+		}
+		err := r.Run(func(ctx context.Context, runner ServiceRunner) error {
+			return runner.Register(svc)
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if !svc.drained.Load() {
+			t.Fatal("expecting service to be drained")
+		}
+		if !svc.runCtxAlive.Load() {
+			t.Fatal("expecting the service to be still running when draining")
+		}
+		if svc.readyInDrain.Load() {
+			t.Fatal("expecting the program to be not ready when draining")
+		}
+		if svc.stoppedInDrain.Load() {
+			t.Fatal("expecting the service to be stopped after drained")
+		}
+	})
+
+	t.Run("drain period", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config
+		conf.Timeout.DrainPeriod = time.Second
+		start := time.Now()
+		err := New(conf).Run(func(ctx context.Context, runner ServiceRunner) error {
+			return Serve("drain-period", runner, func(ctx Context) error {
+				<-ctx.Ctx.Done()
+				return nil
+			})
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if elapsed := time.Since(start); elapsed < conf.DeadlineDuration+conf.Timeout.DrainPeriod {
+			t.Fatalf("expecting the runner to wait for the drain period, but only run for %s", elapsed)
+		}
+	})
+
+	t.Run("drain timeout", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config
+		conf.Timeout.DrainPeriod = time.Second * 10
+		conf.Timeout.DrainTimeout = time.Second
+		start := time.Now()
+		err := New(conf).Run(func(ctx context.Context, runner ServiceRunner) error {
+			return Serve("drain-timeout", runner, func(ctx Context) error {
+				<-ctx.Ctx.Done()
+				return nil
+			})
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second*5 {
+			t.Fatalf("expecting the drain to be timed out, but run for %s", elapsed)
+		}
+	})
+
+	t.Run("custom readiness func", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config
+		conf.Admin = AdminConfig{
+			AdminServerConfig: AdminServerConfig{
+				Address: "127.0.0.1:0",
+				// The custom readiness function doesn't know about the drain phase, so the runner must fail the
+				// readiness before calling it.
+				ReadinessFunc: func() error {
+					return nil
+				},
+			},
+		}
+		r := New(conf)
+		svc := &serviceWithDrain{runner: r}
+		svc.serviceDoNothing = &serviceDoNothing{
+			errC: make(chan error, 1),
+			onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
+				svc.runCtx.Store(ctx)
+				<-ctx.Done()
+				return nil
+			},
+		}
+		err := r.Run(func(ctx context.Context, runner ServiceRunner) error {
+			return runner.Register(svc)
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if code := svc.readyCodeInDrain.Load(); code != http.StatusServiceUnavailable {
+			t.Fatalf("expecting /ready to respond %d when draining but got %d", http.StatusServiceUnavailable, code)
+		}
+	})
+
+	t.Run("no drain when all services exited", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config
+		conf.Timeout.DrainPeriod = time.Second * 10
+		start := time.Now()
+		err := New(conf).Run(func(ctx context.Context, runner ServiceRunner) error {
+			return Serve("exit", runner, func(ctx Context) error {
+				return nil
+			})
+		})
+		if !errors.Is(err, errAllServicesExited) {
+			t.Fatalf("expecting error %v but got %v", errAllServicesExited, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second*5 {
+			t.Fatalf("expecting the runner to not wait for the drain period, but run for %s", elapsed)
+		}
+	})
+}
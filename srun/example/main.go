@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
-	"flag"
 	"log/slog"
 
 	"github.com/albertwidi/pkg/resources"
@@ -15,8 +13,7 @@ type Config struct {
 }
 
 func main() {
-	// srun.New().MustRun() wraps the main function and ensure everything is wrapped inside srun scope.
-	srun.New(srun.Config{
+	srunConfig := srun.Config{
 		Name: "testing",
 		Healthcheck: srun.HealthcheckConfig{
 			// Please enable the healthcheck if you are aware of what you are doing. The healthcheck service will occupied some of your resources
@@ -31,21 +28,34 @@ func main() {
 			Format: "json",
 			Level:  slog.LevelInfo,
 		},
-	}).MustRun(run())
+	}
+	// Load the configuration from the file passed via -config=path/to/config/file, the SRUN_* and APP_* environment variables and
+	// the flags. The values above are the defaults that are overridden by the loader.
+	var config Config
+	loader := srun.ConfigLoader{EnvPrefix: "APP"}
+	if err := loader.Load(&srunConfig, &config); err != nil {
+		panic(err)
+	}
+	// Reload the configuration from the same sources when the configuration files are modified or the program receives SIGUSR2.
+	// The services that implement srun.ServiceReloadAware are notified with the new configuration.
+	srunConfig.Reload.Config = &config
+	srunConfig.Reload.Files = append(srunConfig.Reload.Files, loader.LoadedFiles()...)
+	srunConfig.Reload.Load = func(ctx context.Context) (any, error) {
+		var newConfig Config
+		// The runner configuration is validated when it is reloaded, so it needs the program name.
+		if err := loader.Reload(&srun.Config{Name: srunConfig.Name}, &newConfig); err != nil {
+			return nil, err
+		}
+		return &newConfig, nil
+	}
+
+	// srun.New().MustRun() wraps the main function and ensure everything is wrapped inside srun scope.
+	srun.New(srunConfig).MustRun(run(config))
 }
 
 // run function runs inside srun ensures all errors/operations are encapsulated within srun. Thus, if panic happens, the log of panic will also follows
 // the slog log configuration. This especially useful for centralized logging platform as multi-line logs are usually hard to read and need to be combined.
-func run() func(context.Context, srun.ServiceRunner) error {
-	var configFile string
-	var config Config
-
-	flag.Parse()
-	flag.StringVar(&configFile, "config", "", "-config=path/to/config/file")
-	if configFile == "" {
-		return srun.Error(errors.New("config file cannot be empty"))
-	}
-
+func run(config Config) func(context.Context, srun.ServiceRunner) error {
 	return func(ctx context.Context, sr srun.ServiceRunner) error {
 		r, err := resources.New(ctx, config.Resources)
 		if err != nil {
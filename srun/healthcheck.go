@@ -32,7 +32,9 @@ package srun
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"sync"
 	"time"
 
@@ -42,10 +44,18 @@ import (
 var _ ServiceRunnerAware = (*HealthcheckService)(nil)
 
 const (
-	healthcheckDefaultTimeout  = time.Second * 5
-	healthcheckDefaultInterval = time.Second * 20
+	healthcheckDefaultTimeout     = time.Second * 5
+	healthcheckDefaultInterval    = time.Second * 20
+	healthcheckDefaultConcurrency = 10
+	healthcheckDefaultThreshold   = 1
+	healthcheckDefaultHistorySize = 10
+	// healthcheckDefaultTransitionHistorySize is the number of the status transitions of all services retained by default.
+	healthcheckDefaultTransitionHistorySize = 100
 )
 
+// errHealthcheckTimeout is thrown when the service doesn't return from Health within the healthcheck timeout.
+var errHealthcheckTimeout = errors.New("healthcheck: timeout reached")
+
 type (
 	HealthStatus       int
 	HealthStatusSource int
@@ -80,10 +90,27 @@ func (h HealthStatus) String() string {
 		"UNKNOWN_STATUS",
 		"STOPPED",
 		"UNHEALTHY",
+		"DEGRADED",
 		"HEALTHY",
 	}[h]
 }
 
+// MarshalText encodes the status as its string, so the status is readable in the JSON response of the admin server.
+func (h HealthStatus) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes the status from its string.
+func (h *HealthStatus) UnmarshalText(text []byte) error {
+	for status := HealthStatus(0); status <= HealthStatusHealthy; status++ {
+		if status.String() == string(text) {
+			*h = status
+			return nil
+		}
+	}
+	return fmt.Errorf("healthcheck: invalid status %q", text)
+}
+
 // String returns the state in string.
 func (h HealthStatusSource) String() string {
 	return []string{
@@ -93,6 +120,22 @@ func (h HealthStatusSource) String() string {
 	}[h]
 }
 
+// MarshalText encodes the source as its string.
+func (h HealthStatusSource) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes the source from its string.
+func (h *HealthStatusSource) UnmarshalText(text []byte) error {
+	for source := HealthStatusSource(0); source <= HealthStatusSourceCheckNotifier; source++ {
+		if source.String() == string(text) {
+			*h = source
+			return nil
+		}
+	}
+	return fmt.Errorf("healthcheck: invalid source %q", text)
+}
+
 // Healthcheck checks whether the service is in a healthy condition or not. The check is not to be confused by ready check
 // as healthcheck will always running after the service is ready. If the healthcheck fails, the runner will use the status
 // for internal status and publish it to the service who needs the checks.
@@ -109,6 +152,16 @@ type Healthcheck interface {
 	Health(ctx context.Context) (HealthStatus, error)
 }
 
+// HealthChecker checks the health of a dependency of the service. A service can implement Healthcheck by delegating the
+// check to a HealthChecker, for example the ready-made checkers in the srun/healthcheck package:
+//
+//	func (s *Service) Health(ctx context.Context) (srun.HealthStatus, error) {
+//		return s.checker.Health(ctx)
+//	}
+type HealthChecker interface {
+	Health(ctx context.Context) (HealthStatus, error)
+}
+
 // HealthcheckConsumer consumes the healthcheck messages from the healthcheck service. The check messages will be multiplexed
 // to all services that consumes the notification.
 //
@@ -132,6 +185,24 @@ type HealthcheckConsumer interface {
 	ConsumeHealthcheckNotification(HealthcheckNotifyFunc)
 }
 
+// HealthcheckTransitionConsumer consumes the healthcheck notifications only when the status of the service changes. The
+// repeated notifications with the same status are skipped, so the consumer doesn't need to de-duplicate them. The previous
+// status and how long the service was in the previous status are available in the notification.
+//
+// For example:
+//
+//	func (s *Service) ConsumeHealthcheckTransition(fn HealthcheckNotifyFunc) {
+//		fn([]string{"service_1"}, func(notif HealthcheckNotification) {
+//			if notif.Status <= HealthStatusUhealthy {
+//				// Open the circuit breaker.
+//			}
+//		})
+//	}
+type HealthcheckTransitionConsumer interface {
+	ServiceInitAware
+	ConsumeHealthcheckTransition(HealthcheckNotifyFunc)
+}
+
 // HealthcheckNotifyFunc manage the loops and notify the HealthcheckNotifyFunc all the notifications of the subscriptions.
 // The reason of why this function exist is because we don't want for each servie to maintain its for loop. Its tedious
 // and some of them might doing it wrong thing by not exiting the tight loop. So its better for the healthcheck service
@@ -148,12 +219,141 @@ type HealthcheckNotification struct {
 	Status         HealthStatus
 	CheckTimestamp int64
 	Source         HealthStatusSource
+	// PreviousStatus is the status of the service before the notification. The previous status is only set when the status
+	// of the service changes.
+	PreviousStatus HealthStatus
+	// PreviousStatusDuration is how long the service was in the previous status.
+	PreviousStatusDuration time.Duration
+}
+
+// Changed returns true if the notification changes the status of the service.
+func (n HealthcheckNotification) Changed() bool {
+	return n.PreviousStatus != 0 && n.PreviousStatus != n.Status
+}
+
+// withTransition sets the previous status of the notification from the transition.
+func (n HealthcheckNotification) withTransition(transition *HealthTransition) HealthcheckNotification {
+	if transition != nil {
+		n.PreviousStatus = transition.From
+		n.PreviousStatusDuration = transition.Duration
+	}
+	return n
 }
 
 type HealthcheckConfig struct {
-	Enabled  bool
-	Timeout  time.Duration
-	Interval time.Duration
+	Enabled bool `yaml:"enabled"`
+	// Timeout is the timeout of each check. By default, the timeout is 5 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval is the interval between the checks of each service. By default, the interval is 20 seconds.
+	Interval time.Duration `yaml:"interval"`
+	// Concurrency is the maximum number of checks that running at the same time. By default, 10 checks are allowed to run
+	// at the same time.
+	Concurrency int `yaml:"concurrency"`
+	// Jitter is the fraction of the interval that being randomized, the value must be between zero and one. The jitter
+	// spreads the checks of the services that have the same interval. By default, the interval is not randomized.
+	Jitter float64 `yaml:"jitter"`
+	// FailureThreshold is the number of consecutive failed checks before the service status is changed to the failed status.
+	// By default, the status is changed on the first failed check.
+	FailureThreshold int `yaml:"failure-threshold"`
+	// SuccessThreshold is the number of consecutive healthy checks before a failed service is marked as healthy again. By
+	// default, the status is changed on the first healthy check.
+	SuccessThreshold int `yaml:"success-threshold"`
+	// HistorySize is the number of the latest check results retained for each service. By default, 10 results are retained.
+	HistorySize int `yaml:"history-size"`
+	// TransitionHistorySize is the number of the latest status transitions of all services retained for /health/history.
+	// By default, 100 transitions are retained.
+	TransitionHistorySize int `yaml:"transition-history-size"`
+	// Webhook sends the status transitions of the services to an external endpoint.
+	Webhook HealthcheckWebhookConfig `yaml:"webhook"`
+}
+
+func (c *HealthcheckConfig) validate() error {
+	if c.Timeout < 0 || c.Interval < 0 {
+		return errors.New("healthcheck: timeout and interval cannot be negative")
+	}
+	if c.Concurrency < 0 || c.FailureThreshold < 0 || c.SuccessThreshold < 0 || c.HistorySize < 0 || c.TransitionHistorySize < 0 {
+		return errors.New("healthcheck: concurrency, thresholds and history size cannot be negative")
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return withConfigKey("jitter", errors.New("healthcheck: jitter must be between zero and one"))
+	}
+	if c.Interval == 0 {
+		c.Interval = healthcheckDefaultInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = healthcheckDefaultTimeout
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = healthcheckDefaultConcurrency
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = healthcheckDefaultThreshold
+	}
+	if c.SuccessThreshold == 0 {
+		c.SuccessThreshold = healthcheckDefaultThreshold
+	}
+	if c.HistorySize == 0 {
+		c.HistorySize = healthcheckDefaultHistorySize
+	}
+	if c.TransitionHistorySize == 0 {
+		c.TransitionHistorySize = healthcheckDefaultTransitionHistorySize
+	}
+	return withConfigKey("webhook", c.Webhook.validate())
+}
+
+// HealthcheckPolicy overrides the healthcheck configuration for a service. The zero fields use the value of HealthcheckConfig.
+type HealthcheckPolicy struct {
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+	SuccessThreshold int
+	// UnhealthyAction is the action taken when the service reports HealthStatusUhealthy for UnhealthyThreshold consecutive
+	// checks. By default, no action is taken.
+	UnhealthyAction UnhealthyAction
+	// UnhealthyThreshold is the number of consecutive unhealthy checks before the action is taken. The action is taken again
+	// after the next UnhealthyThreshold consecutive unhealthy checks. By default, the threshold is 3.
+	UnhealthyThreshold int
+}
+
+// withDefaults validates the policy and fills the zero fields from the healthcheck configuration.
+func (p HealthcheckPolicy) withDefaults(config HealthcheckConfig) (HealthcheckPolicy, error) {
+	if p.Interval < 0 || p.Timeout < 0 || p.FailureThreshold < 0 || p.SuccessThreshold < 0 || p.UnhealthyThreshold < 0 {
+		return p, errors.New("healthcheck: policy cannot have negative values")
+	}
+	if p.UnhealthyAction < UnhealthyActionNone || p.UnhealthyAction > UnhealthyActionShutdown {
+		return p, fmt.Errorf("healthcheck: invalid unhealthy action %d", p.UnhealthyAction)
+	}
+	if p.UnhealthyThreshold == 0 {
+		p.UnhealthyThreshold = unhealthyDefaultThreshold
+	}
+	if p.Interval == 0 {
+		p.Interval = config.Interval
+	}
+	if p.Timeout == 0 {
+		p.Timeout = config.Timeout
+	}
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = config.FailureThreshold
+	}
+	if p.SuccessThreshold == 0 {
+		p.SuccessThreshold = config.SuccessThreshold
+	}
+	return p, nil
+}
+
+// ServiceHealthcheckPolicyAware defines a service that has its own healthcheck policy. For example, a service that checks
+// a remote dependency might need a longer timeout and interval than the other services:
+//
+//	func (s *PaymentClient) HealthcheckPolicy() srun.HealthcheckPolicy {
+//		return srun.HealthcheckPolicy{
+//			Interval:         time.Minute,
+//			Timeout:          time.Second * 10,
+//			FailureThreshold: 3,
+//			UnhealthyAction:  srun.UnhealthyActionRestart,
+//		}
+//	}
+type ServiceHealthcheckPolicyAware interface {
+	HealthcheckPolicy() HealthcheckPolicy
 }
 
 // HealthcheckService provides a service that actively checks the services. And it continuously notify other services
@@ -176,25 +376,43 @@ type HealthcheckService struct {
 	notifiers map[ServiceInitAware]*HealthcheckNotifier
 	// services is the list of services that need checks.
 	services map[ServiceRunnerAware]Healthcheck
+	// policies is the healthcheck policy of the services that need checks.
+	policies map[ServiceRunnerAware]HealthcheckPolicy
 	// servicesStatus is a map based on service name to track the health status of eaach services.
 	servicesStatus map[string]*ServiceHealthStatus
 	// consumers is the consumers of the healthcheck notification. We are using a concurrent services to start the
 	// all the consumers.
-	consumers []HealthcheckConsumer
+	consumers []healthcheckConsumer
 	// broadcastC is the healthcheck notification channel. The number of channel will be the same with the number of consumers
 	// as this channel acted as the multiplexer to all consumers(all consumers will receive the same message). We don't create
 	// the channel for all services because it is pointeless to provide the notification for a service without consumer.
 	broadcastC []chan HealthcheckNotification
+	// transitions is the history of the status transitions of all services.
+	transitions *healthTransitionHistory
+	// webhook sends the status transitions to an external endpoint, it is nil if the webhook is not configured.
+	webhook *healthcheckWebhook
+	// actions takes the unhealthy action of the services, it is nil if the healthcheck service is not run by the runner.
+	actions unhealthyActionHandler
 
 	readyC chan struct{}
 }
 
+// healthcheckConsumer is the consumer of the healthcheck notifications. The transition-only consumer only receives the
+// notifications that change the status of the service.
+type healthcheckConsumer struct {
+	consume        func(HealthcheckNotifyFunc)
+	transitionOnly bool
+}
+
 func newHealthcheckService(config HealthcheckConfig) *HealthcheckService {
 	hcs := &HealthcheckService{
 		config:         config,
 		services:       make(map[ServiceRunnerAware]Healthcheck),
+		policies:       make(map[ServiceRunnerAware]HealthcheckPolicy),
 		servicesStatus: make(map[string]*ServiceHealthStatus),
 		notifiers:      make(map[ServiceInitAware]*HealthcheckNotifier),
+		transitions:    newHealthTransitionHistory(config.TransitionHistorySize),
+		webhook:        newHealthcheckWebhook(config.Webhook),
 		readyC:         make(chan struct{}, 1),
 	}
 	return hcs
@@ -230,8 +448,17 @@ func (h *HealthcheckService) register(svc ServiceInitAware) error {
 		if ok {
 			hc, ok := svc.(Healthcheck)
 			if ok {
+				var policy HealthcheckPolicy
+				if hpa, ok := svc.(ServiceHealthcheckPolicyAware); ok {
+					policy = hpa.HealthcheckPolicy()
+				}
+				policy, err := policy.withDefaults(h.config)
+				if err != nil {
+					return fmt.Errorf("service %s: %w", svc.Name(), err)
+				}
 				h.services[sra] = hc
-				h.servicesStatus[svc.Name()] = &ServiceHealthStatus{status: HealthStatusStopped}
+				h.policies[sra] = policy
+				h.servicesStatus[svc.Name()] = newServiceHealthStatus(svc.Name(), policy, h.config.HistorySize)
 			}
 			h.notifiers[svc] = &HealthcheckNotifier{
 				serviceName: svc.Name(),
@@ -239,11 +466,13 @@ func (h *HealthcheckService) register(svc ServiceInitAware) error {
 				notifyC:     h.notifC,
 			}
 		}
-		hcc, ok := svc.(HealthcheckConsumer)
-		if ok {
-			notifC := make(chan HealthcheckNotification, 100)
-			h.consumers = append(h.consumers, hcc)
-			h.broadcastC = append(h.broadcastC, notifC)
+		if hcc, ok := svc.(HealthcheckConsumer); ok {
+			h.consumers = append(h.consumers, healthcheckConsumer{consume: hcc.ConsumeHealthcheckNotification})
+			h.broadcastC = append(h.broadcastC, make(chan HealthcheckNotification, 100))
+		}
+		if htc, ok := svc.(HealthcheckTransitionConsumer); ok {
+			h.consumers = append(h.consumers, healthcheckConsumer{consume: htc.ConsumeHealthcheckTransition, transitionOnly: true})
+			h.broadcastC = append(h.broadcastC, make(chan HealthcheckNotification, 100))
 		}
 	}
 	return nil
@@ -258,6 +487,10 @@ func (h *HealthcheckService) Init(ctx Context) error {
 	// of len(services) * 20.
 	if h.config.Enabled {
 		h.notifC = make(chan HealthcheckNotification, len(h.services)*20)
+		// The notifiers are created when the services are registered, which is before the channel is created.
+		for _, notifier := range h.notifiers {
+			notifier.notifyC = h.notifC
+		}
 	}
 	h.iCtx = ctx
 	return nil
@@ -266,10 +499,13 @@ func (h *HealthcheckService) Init(ctx Context) error {
 // Run runs the healthcheck service. The service runs two goroutines to serve the notification worker and check worker.
 func (h *HealthcheckService) Run(ctx context.Context) error {
 	g := errgroup.Group{}
-	// Only handle notifications if there are consumers of the notification.
-	if len(h.consumers) > 0 {
+	// Always handle the notifications, as the status pushed by the notifiers is recorded even though there are no consumers.
+	g.Go(func() error {
+		return h.handleNotifications(ctx)
+	})
+	if h.webhook != nil {
 		g.Go(func() error {
-			return h.handleNotifications(ctx)
+			return h.webhook.run(ctx, h.iCtx.Logger)
 		})
 	}
 	// Only check the services is there are services that implements Healthcheck.
@@ -308,7 +544,73 @@ func (h *HealthcheckService) check(ctx context.Context, svc ServiceRunnerAware)
 	if !ok {
 		return HealthStatusHealthy, nil
 	}
-	return hc.Health(ctx)
+	result, _, err := h.runCheck(ctx, hc, h.policies[svc].Timeout)
+	if _, transition := h.servicesStatus[svc.Name()].observe(result); transition != nil {
+		h.recordTransition(*transition)
+	}
+	return result.Status, err
+}
+
+// runCheck checks the health of the service within the timeout. The check is running in the background, so a check that
+// doesn't respect the context won't block the caller. The returned channel is closed when the check that exceeds the timeout
+// returns, and it is nil if the check is finished within the timeout.
+func (h *HealthcheckService) runCheck(ctx context.Context, hc Healthcheck, timeout time.Duration) (HealthcheckResult, <-chan struct{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	doneC := make(chan struct{})
+	var (
+		status HealthStatus
+		err    error
+	)
+	go func() {
+		defer close(doneC)
+		status, err = hc.Health(ctx)
+	}()
+
+	result := HealthcheckResult{Time: start}
+	var checkErr error
+	select {
+	case <-doneC:
+		result.Status, checkErr = status, err
+	case <-ctx.Done():
+		checkErr = errHealthcheckTimeout
+		if errors.Is(ctx.Err(), context.Canceled) {
+			checkErr = ctx.Err()
+		}
+	}
+	result.Duration = time.Since(start)
+	// The service is treated as unhealthy if the status is unknown and the error is not nil.
+	if result.Status == 0 && checkErr != nil {
+		result.Status = HealthStatusUhealthy
+	}
+	if checkErr != nil {
+		result.Error = checkErr.Error()
+	}
+	select {
+	case <-doneC:
+		return result, nil, checkErr
+	default:
+		return result, doneC, checkErr
+	}
+}
+
+// status returns the last known health status of the service and whether the service health is tracked.
+func (h *HealthcheckService) status(name string) (HealthStatus, bool) {
+	s, ok := h.servicesStatus[name]
+	if !ok {
+		return 0, false
+	}
+	return s.Get(), true
+}
+
+// history returns the latest check results of the service.
+func (h *HealthcheckService) history(name string) []HealthcheckResult {
+	s, ok := h.servicesStatus[name]
+	if !ok {
+		return nil
+	}
+	return s.History()
 }
 
 func (h *HealthcheckService) handleNotifications(ctx context.Context) error {
@@ -316,7 +618,7 @@ func (h *HealthcheckService) handleNotifications(ctx context.Context) error {
 	// they want to listen from.
 	handlers := make([]HealthcheckNotifierHandler, len(h.consumers))
 	for idx, consumer := range h.consumers {
-		consumer.ConsumeHealthcheckNotification(func(s []string, hcf HealthcheckConsumeFunc) error {
+		consumer.consume(func(s []string, hcf HealthcheckConsumeFunc) error {
 			// Use the emptyFilter to mark whether we need to filter the service name or not. If the list of the filter
 			// is empty, then we should not seek anything in the filter at all.
 			var emptyFilter bool
@@ -328,9 +630,10 @@ func (h *HealthcheckService) handleNotifications(ctx context.Context) error {
 				emptyFilter = true
 			}
 			handlers[idx] = HealthcheckNotifierHandler{
-				filter:      filter,
-				emptyFilter: emptyFilter,
-				handlerFunc: hcf,
+				filter:         filter,
+				emptyFilter:    emptyFilter,
+				transitionOnly: consumer.transitionOnly,
+				handlerFunc:    hcf,
 			}
 			return nil
 		})
@@ -343,8 +646,13 @@ func (h *HealthcheckService) handleNotifications(ctx context.Context) error {
 		case notification := <-h.notifC:
 			// Set the latest status of the service. If the service is somehow miss to publish the notification upon recovery, the healthcheck
 			// will still send the periodic notification. So we might see some delay, but we will eventually get the correct status.
-			if s, ok := h.servicesStatus[notification.ServiceName]; ok {
-				s.Set(notification.Status)
+			//
+			// The status from the healthcheck service is already set when the service is checked.
+			if s, ok := h.servicesStatus[notification.ServiceName]; ok && notification.Source == HealthStatusSourceCheckNotifier {
+				if transition := s.set(notification.Status, HealthStatusSourceCheckNotifier); transition != nil {
+					h.recordTransition(*transition)
+					notification = notification.withTransition(transition)
+				}
 			}
 
 			for _, handler := range handlers {
@@ -360,47 +668,117 @@ func (h *HealthcheckService) handleNotifications(ctx context.Context) error {
 	}
 }
 
+// handleChecks checks each service periodically based on its policy. Each service is scheduled independently, so a slow check
+// only delays the next check of the same service, while the number of checks that running at the same time is bounded by the
+// concurrency configuration.
 func (h *HealthcheckService) handleChecks(ctx context.Context) error {
-	ticker := time.NewTicker(time.Second * 20)
+	semC := make(chan struct{}, h.config.Concurrency)
+	var wg sync.WaitGroup
+	for svc, hc := range h.services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.scheduleChecks(ctx, hc, h.policies[svc], semC)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// scheduleChecks checks the service every interval until the context is cancelled.
+func (h *HealthcheckService) scheduleChecks(ctx context.Context, hc Healthcheck, policy HealthcheckPolicy, semC chan struct{}) {
+	status := h.servicesStatus[hc.Name()]
+	// pendingC is not nil when the previous check exceeds the timeout and still running.
+	var pendingC <-chan struct{}
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
-			for _, svc := range h.services {
-				ctxTimeout, cancel := context.WithTimeout(ctx, h.config.Timeout)
-				status, err := svc.Health(ctxTimeout)
-				if err != nil {
-					h.iCtx.Logger.Error(
-						"healthcheck failed",
-						slog.String("service_name", svc.Name()),
-						slog.String("error", err.Error()),
-					)
-				}
-				h.notifC <- HealthcheckNotification{
-					ServiceName:    svc.Name(),
-					Status:         status,
-					CheckTimestamp: time.Now().Unix(),
-					Source:         HealthStatusSourceCheckService,
-				}
-				cancel()
+			return
+		case <-time.After(h.jitter(policy.Interval)):
+		}
+
+		var result HealthcheckResult
+		select {
+		case <-pendingC:
+			pendingC = nil
+		default:
+		}
+		if pendingC != nil {
+			// Don't pile up the checks if the service doesn't respect the timeout, the service is still treated as failed.
+			result = HealthcheckResult{Status: HealthStatusUhealthy, Error: errHealthcheckTimeout.Error(), Time: time.Now()}
+		} else {
+			select {
+			case <-ctx.Done():
+				return
+			case semC <- struct{}{}:
 			}
+			result, pendingC, _ = h.runCheck(ctx, hc, policy.Timeout)
+			<-semC
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		current, transition := status.observe(result)
+		if result.Error != "" {
+			h.iCtx.Logger.Error(
+				"healthcheck failed",
+				slog.String("service_name", hc.Name()),
+				slog.String("error", result.Error),
+			)
+		}
+		if transition != nil {
+			h.recordTransition(*transition)
+		}
+		if policy.UnhealthyAction != UnhealthyActionNone && h.actions != nil {
+			act, recovered := status.observeUnhealthy(result, policy.UnhealthyThreshold)
+			switch {
+			case act:
+				h.actions.handleUnhealthy(hc.Name(), policy.UnhealthyAction)
+			case recovered:
+				h.actions.handleRecovered(hc.Name(), policy.UnhealthyAction)
+			}
+		}
+		// Only send the notification if there are consumers of the notification, as nobody receives it otherwise.
+		if len(h.consumers) == 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case h.notifC <- HealthcheckNotification{
+			ServiceName:    hc.Name(),
+			Status:         current,
+			CheckTimestamp: time.Now().Unix(),
+			Source:         HealthStatusSourceCheckService,
+		}.withTransition(transition):
 		}
 	}
 }
 
+// jitter randomizes the interval in the range of [interval - jitter, interval + jitter].
+func (h *HealthcheckService) jitter(interval time.Duration) time.Duration {
+	jitter := float64(interval) * h.config.Jitter
+	return time.Duration(float64(interval) - jitter + (rand.Float64() * jitter * 2))
+}
+
 // HealthcheckNotifierHandler handles the healthcheck notifications and decide whether we need to invoke the notification
 // to a coresponding service.
 type HealthcheckNotifierHandler struct {
 	handlerFunc HealthcheckConsumeFunc
 	filter      map[string]struct{}
 	emptyFilter bool
+	// transitionOnly skips the notifications that don't change the status of the service.
+	transitionOnly bool
 }
 
 func (h *HealthcheckNotifierHandler) handle(notif HealthcheckNotification) {
 	if h.filter == nil {
 		return
 	}
+	if h.transitionOnly && !notif.Changed() {
+		return
+	}
 	if _, ok := h.filter[notif.ServiceName]; !ok {
 		return
 	}
@@ -443,16 +821,141 @@ func (h *HealthcheckNotifier) stop() {
 	h.mu.Unlock()
 }
 
+// HealthcheckResult is the result of a healthcheck of a service.
+type HealthcheckResult struct {
+	// Status is the status returned by the check. The status might be different from the status of the service, as the
+	// status of the service only changes after the failure or success threshold is reached.
+	Status   HealthStatus  `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+}
+
+// failed returns true if the check reports any status other than healthy.
+func (r HealthcheckResult) failed() bool {
+	return r.Status != HealthStatusHealthy
+}
+
 // ServiceHealthStatus tracks the health status of each service. The set and get of health status is concurrently safe.
+//
+// The status changes to the failed status after the number of consecutive failed checks reaches the failure threshold, and
+// changes back to healthy after the number of consecutive healthy checks reaches the success threshold. This way, the status
+// doesn't flap because of a single slow or failed check.
 type ServiceHealthStatus struct {
 	mu     sync.RWMutex
+	name   string
 	status HealthStatus
+	// since is the time when the service changed to the current status.
+	since time.Time
+
+	failureThreshold int
+	successThreshold int
+	// failures and successes are the number of consecutive failed and healthy checks.
+	failures  int
+	successes int
+	// history is the latest check results.
+	history *ringBuffer[HealthcheckResult]
+	// unhealthyResults is the number of consecutive unhealthy results since the last unhealthy action, and unhealthyActed is
+	// true if the unhealthy action is taken and the service is not recovered yet.
+	unhealthyResults int
+	unhealthyActed   bool
+}
+
+func newServiceHealthStatus(name string, policy HealthcheckPolicy, historySize int) *ServiceHealthStatus {
+	return &ServiceHealthStatus{
+		name:             name,
+		status:           HealthStatusStopped,
+		since:            time.Now(),
+		failureThreshold: policy.FailureThreshold,
+		successThreshold: policy.SuccessThreshold,
+		history:          newRingBuffer[HealthcheckResult](historySize),
+	}
 }
 
+// Set sets the status of the service directly without the thresholds, for example when the service pushes its status via
+// HealthcheckNotifier.
 func (s *ServiceHealthStatus) Set(status HealthStatus) {
+	s.set(status, HealthStatusSourceCheckNotifier)
+}
+
+// set sets the status of the service and returns the transition if the status is changed.
+func (s *ServiceHealthStatus) set(status HealthStatus, source HealthStatusSource) *HealthTransition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures, s.successes = 0, 0
+	return s.transition(status, source, "")
+}
+
+// transition changes the status of the service and returns the transition, it returns nil if the status is not changed.
+// The caller must hold the lock.
+func (s *ServiceHealthStatus) transition(status HealthStatus, source HealthStatusSource, errMessage string) *HealthTransition {
+	if status == s.status {
+		return nil
+	}
+	now := time.Now()
+	transition := &HealthTransition{
+		ServiceName: s.name,
+		From:        s.status,
+		To:          status,
+		Source:      source,
+		Time:        now,
+		Duration:    now.Sub(s.since),
+		Error:       errMessage,
+	}
+	s.status, s.since = status, now
+	return transition
+}
+
+// observe records the result of the check and changes the status of the service based on the thresholds. The thresholds
+// are not applied when the service is never checked before, so the first check always sets the status. The function returns
+// the status of the service and the transition if the status is changed.
+func (s *ServiceHealthStatus) observe(result HealthcheckResult) (HealthStatus, *HealthTransition) {
 	s.mu.Lock()
-	s.status = status
-	s.mu.Unlock()
+	defer s.mu.Unlock()
+
+	s.history.push(result)
+	var transition *HealthTransition
+	if result.failed() {
+		s.failures++
+		s.successes = 0
+		if s.status == HealthStatusStopped || s.failures >= s.failureThreshold {
+			transition = s.transition(result.Status, HealthStatusSourceCheckService, result.Error)
+		}
+	} else {
+		s.successes++
+		s.failures = 0
+		if s.status == HealthStatusStopped || s.successes >= s.successThreshold {
+			transition = s.transition(result.Status, HealthStatusSourceCheckService, result.Error)
+		}
+	}
+	return s.status, transition
+}
+
+// observeUnhealthy counts the consecutive unhealthy results of the service. It returns true for act when the number of the
+// consecutive unhealthy results reaches the threshold, and true for recovered when the result is not unhealthy anymore after
+// the action was taken.
+func (s *ServiceHealthStatus) observeUnhealthy(result HealthcheckResult, threshold int) (act, recovered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if result.Status != HealthStatusUhealthy {
+		recovered = s.unhealthyActed
+		s.unhealthyResults, s.unhealthyActed = 0, false
+		return false, recovered
+	}
+	s.unhealthyResults++
+	if s.unhealthyResults < threshold {
+		return false, false
+	}
+	s.unhealthyResults, s.unhealthyActed = 0, true
+	return true, false
+}
+
+// History returns the latest check results of the service, ordered from the oldest result.
+func (s *ServiceHealthStatus) History() []HealthcheckResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.history.list()
 }
 
 func (s *ServiceHealthStatus) Get() (status HealthStatus) {
@@ -0,0 +1,103 @@
+// Package healthcheck provides ready-made health checkers for the common dependencies of a service. The checkers implement
+// srun.HealthChecker, so they can be composed and returned by the Health method of a service:
+//
+//	checker := healthcheck.All(
+//		healthcheck.Named("primary", healthcheck.Postgres(primary)),
+//		healthcheck.Degraded(healthcheck.Named("secondary", healthcheck.Postgres(secondary))),
+//		healthcheck.TCP("localhost:6379"),
+//	)
+//
+//	func (s *Service) Health(ctx context.Context) (srun.HealthStatus, error) {
+//		return checker.Health(ctx)
+//	}
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/albertwidi/pkg/srun"
+)
+
+var _ srun.HealthChecker = Func(nil)
+
+// Func is an adapter to allow the use of ordinary functions as srun.HealthChecker.
+type Func func(ctx context.Context) (srun.HealthStatus, error)
+
+// Health calls f(ctx).
+func (f Func) Health(ctx context.Context) (srun.HealthStatus, error) {
+	return f(ctx)
+}
+
+// All checks all the checkers concurrently and returns the worst status among them. The errors of the checkers are joined,
+// so the caller knows which dependencies are failing.
+func All(checkers ...srun.HealthChecker) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		statuses := make([]srun.HealthStatus, len(checkers))
+		errs := make([]error, len(checkers))
+		var wg sync.WaitGroup
+		for idx, checker := range checkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statuses[idx], errs[idx] = check(ctx, checker)
+			}()
+		}
+		wg.Wait()
+
+		status := srun.HealthStatus(srun.HealthStatusHealthy)
+		for _, s := range statuses {
+			status = min(status, s)
+		}
+		return status, errors.Join(errs...)
+	})
+}
+
+// Degraded reports the failure of the checker as degraded instead of unhealthy. Use it for the dependencies that the service
+// can still partially serve without, for example the secondary database.
+func Degraded(checker srun.HealthChecker) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		status, err := check(ctx, checker)
+		return max(status, srun.HealthStatusDegarded), err
+	})
+}
+
+// Named adds the name of the dependency to the error of the checker.
+func Named(name string, checker srun.HealthChecker) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		status, err := check(ctx, checker)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", name, err)
+		}
+		return status, err
+	})
+}
+
+// check runs the checker and treats the unknown status as unhealthy when the check returns an error, the same as the
+// healthcheck service does.
+func check(ctx context.Context, checker srun.HealthChecker) (srun.HealthStatus, error) {
+	status, err := checker.Health(ctx)
+	if status == 0 {
+		status = srun.HealthStatusHealthy
+		if err != nil {
+			status = srun.HealthStatusUhealthy
+		}
+	}
+	return status, err
+}
+
+// threshold returns the status of the value against the degraded and the unhealthy thresholds, where a higher value is worse.
+// A zero threshold disables the check.
+func threshold[T int | time.Duration](value, degradedAbove, unhealthyAbove T) srun.HealthStatus {
+	switch {
+	case unhealthyAbove > 0 && value > unhealthyAbove:
+		return srun.HealthStatusUhealthy
+	case degradedAbove > 0 && value > degradedAbove:
+		return srun.HealthStatusDegarded
+	default:
+		return srun.HealthStatusHealthy
+	}
+}
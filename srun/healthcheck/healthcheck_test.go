@@ -0,0 +1,161 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/albertwidi/pkg/srun"
+)
+
+func status(s srun.HealthStatus, err error) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		return s, err
+	})
+}
+
+func TestCompose(t *testing.T) {
+	t.Parallel()
+
+	errDown := errors.New("down")
+	tests := []struct {
+		name    string
+		checker srun.HealthChecker
+		expect  srun.HealthStatus
+		errs    []string
+	}{
+		{
+			name:    "all healthy",
+			checker: All(status(srun.HealthStatusHealthy, nil), status(srun.HealthStatusHealthy, nil)),
+			expect:  srun.HealthStatusHealthy,
+		},
+		{
+			name:    "no checkers",
+			checker: All(),
+			expect:  srun.HealthStatusHealthy,
+		},
+		{
+			name: "worst status",
+			checker: All(
+				status(srun.HealthStatusHealthy, nil),
+				Named("cache", status(srun.HealthStatusDegarded, errDown)),
+				Named("db", status(srun.HealthStatusUhealthy, errDown)),
+			),
+			expect: srun.HealthStatusUhealthy,
+			errs:   []string{"cache: down", "db: down"},
+		},
+		{
+			name:    "unknown status with error",
+			checker: All(status(0, errDown)),
+			expect:  srun.HealthStatusUhealthy,
+			errs:    []string{"down"},
+		},
+		{
+			name: "degraded secondary",
+			checker: All(
+				Named("primary", status(srun.HealthStatusHealthy, nil)),
+				Degraded(Named("secondary", status(srun.HealthStatusUhealthy, errDown))),
+			),
+			expect: srun.HealthStatusDegarded,
+			errs:   []string{"secondary: down"},
+		},
+		{
+			name:    "degraded keeps healthy",
+			checker: Degraded(status(srun.HealthStatusHealthy, nil)),
+			expect:  srun.HealthStatusHealthy,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := test.checker.Health(context.Background())
+			if got != test.expect {
+				t.Fatalf("expecting status %s but got %s", test.expect, got)
+			}
+			if (err != nil) != (len(test.errs) > 0) {
+				t.Fatalf("expecting errors %q but got %v", test.errs, err)
+			}
+			for _, e := range test.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Fatalf("expecting error %q in %v", e, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTCP(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	if s, err := TCP(address).Health(context.Background()); s != srun.HealthStatusHealthy || err != nil {
+		t.Fatalf("expecting healthy but got %s: %v", s, err)
+	}
+	listener.Close()
+	if s, err := TCP(address).Health(context.Background()); s != srun.HealthStatusUhealthy || err == nil {
+		t.Fatalf("expecting unhealthy after the listener is closed but got %s: %v", s, err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	if s, err := HTTP(server.URL+"/up", nil).Health(context.Background()); s != srun.HealthStatusHealthy || err != nil {
+		t.Fatalf("expecting healthy but got %s: %v", s, err)
+	}
+	s, err := HTTP(server.URL+"/down", server.Client()).Health(context.Background())
+	if s != srun.HealthStatusUhealthy || err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expecting unhealthy with status 503 but got %s: %v", s, err)
+	}
+}
+
+func TestSystem(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		checker srun.HealthChecker
+		expect  srun.HealthStatus
+	}{
+		{name: "disk without threshold", checker: DiskSpace(t.TempDir(), 0, 0), expect: srun.HealthStatusHealthy},
+		// The free space is always below 100% of the disk.
+		{name: "disk degraded", checker: DiskSpace(t.TempDir(), 1.01, 0), expect: srun.HealthStatusDegarded},
+		{name: "disk unhealthy", checker: DiskSpace(t.TempDir(), 1.01, 1.01), expect: srun.HealthStatusUhealthy},
+		{name: "goroutines without threshold", checker: Goroutines(0, 0), expect: srun.HealthStatusHealthy},
+		{name: "goroutines degraded", checker: Goroutines(1, 0), expect: srun.HealthStatusDegarded},
+		{name: "goroutines unhealthy", checker: Goroutines(1, 1), expect: srun.HealthStatusUhealthy},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := test.checker.Health(context.Background())
+			if s != test.expect {
+				t.Fatalf("expecting status %s but got %s: %v", test.expect, s, err)
+			}
+			if (err != nil) != (test.expect != srun.HealthStatusHealthy) {
+				t.Fatalf("unexpected error %v for status %s", err, s)
+			}
+		})
+	}
+}
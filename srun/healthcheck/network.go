@@ -0,0 +1,49 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/albertwidi/pkg/srun"
+)
+
+// TCP checks whether a connection to the address can be established.
+func TCP(address string) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return srun.HealthStatusUhealthy, err
+		}
+		conn.Close()
+		return srun.HealthStatusHealthy, nil
+	})
+}
+
+// HTTP sends a GET request to the url and checks whether the response status code is 2xx. The http.DefaultClient is used
+// if the client is nil.
+func HTTP(url string, client *http.Client) srun.HealthChecker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return srun.HealthStatusUhealthy, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return srun.HealthStatusUhealthy, err
+		}
+		defer resp.Body.Close()
+		// Drain the body so the connection can be reused by the next check.
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return srun.HealthStatusUhealthy, fmt.Errorf("http: GET %s returned status %d", url, resp.StatusCode)
+		}
+		return srun.HealthStatusHealthy, nil
+	})
+}
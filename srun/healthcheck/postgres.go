@@ -0,0 +1,46 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/albertwidi/pkg/postgres"
+	"github.com/albertwidi/pkg/srun"
+)
+
+// postgresReplicationLagQuery returns the replication lag in seconds. The lag is zero on the primary database, and when the
+// replica already replayed all the received WAL, so an idle primary database doesn't look like a lagging replica.
+const postgresReplicationLagQuery = `
+SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8
+`
+
+// Postgres checks whether the database is reachable.
+func Postgres(pg *postgres.Postgres) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		if err := pg.Ping(ctx); err != nil {
+			return srun.HealthStatusUhealthy, fmt.Errorf("postgres: %w", err)
+		}
+		return srun.HealthStatusHealthy, nil
+	})
+}
+
+// PostgresReplicationLag checks the replication lag of the replica database. The status is degraded when the lag is above
+// degradedAbove and unhealthy when the lag is above unhealthyAbove. A zero threshold disables the check.
+func PostgresReplicationLag(pg *postgres.Postgres, degradedAbove, unhealthyAbove time.Duration) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		var seconds float64
+		if err := pg.QueryRow(ctx, postgresReplicationLagQuery).Scan(&seconds); err != nil {
+			return srun.HealthStatusUhealthy, fmt.Errorf("postgres: %w", err)
+		}
+		lag := time.Duration(seconds * float64(time.Second))
+		status := threshold(lag, degradedAbove, unhealthyAbove)
+		if status != srun.HealthStatusHealthy {
+			return status, fmt.Errorf("postgres: replication lag %v is above the threshold", lag.Round(time.Millisecond))
+		}
+		return status, nil
+	})
+}
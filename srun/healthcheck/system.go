@@ -0,0 +1,50 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"syscall"
+
+	"github.com/albertwidi/pkg/srun"
+)
+
+// DiskSpace checks the ratio of the available space of the filesystem where the path is located. The status is degraded
+// when the ratio is below degradedBelow and unhealthy when the ratio is below unhealthyBelow, for example 0.1 for 10%.
+// A zero threshold disables the check.
+func DiskSpace(path string, degradedBelow, unhealthyBelow float64) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err != nil {
+			return srun.HealthStatusUhealthy, fmt.Errorf("disk: %w", err)
+		}
+		if stat.Blocks == 0 {
+			return srun.HealthStatusHealthy, nil
+		}
+		free := float64(stat.Bavail) / float64(stat.Blocks)
+		status := srun.HealthStatus(srun.HealthStatusHealthy)
+		switch {
+		case free < unhealthyBelow:
+			status = srun.HealthStatusUhealthy
+		case free < degradedBelow:
+			status = srun.HealthStatusDegarded
+		}
+		if status != srun.HealthStatusHealthy {
+			return status, fmt.Errorf("disk: %.1f%% free space of %s is below the threshold", free*100, path)
+		}
+		return status, nil
+	})
+}
+
+// Goroutines checks the number of goroutines of the program. The status is degraded when the number is above degradedAbove
+// and unhealthy when the number is above unhealthyAbove. A zero threshold disables the check.
+func Goroutines(degradedAbove, unhealthyAbove int) srun.HealthChecker {
+	return Func(func(ctx context.Context) (srun.HealthStatus, error) {
+		n := runtime.NumGoroutine()
+		status := threshold(n, degradedAbove, unhealthyAbove)
+		if status != srun.HealthStatusHealthy {
+			return status, fmt.Errorf("runtime: %d goroutines are above the threshold", n)
+		}
+		return status, nil
+	})
+}
@@ -2,13 +2,39 @@ package srun
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
+var (
+	_ Healthcheck                   = (*serviceWithHealthPolicy)(nil)
+	_ ServiceHealthcheckPolicyAware = (*serviceWithHealthPolicy)(nil)
+)
+
+// serviceWithHealthPolicy is a service with its own healthcheck policy, the health function counts the number of checks.
+type serviceWithHealthPolicy struct {
+	*serviceDoNothing
+	policy HealthcheckPolicy
+	health func(ctx context.Context) (HealthStatus, error)
+	checks atomic.Int32
+}
+
+func (s *serviceWithHealthPolicy) HealthcheckPolicy() HealthcheckPolicy {
+	return s.policy
+}
+
+func (s *serviceWithHealthPolicy) Health(ctx context.Context) (HealthStatus, error) {
+	s.checks.Add(1)
+	return s.health(ctx)
+}
+
 func TestHealthcheckRegister(t *testing.T) {
 	t.Parallel()
 
@@ -149,3 +175,186 @@ func TestHandleNotifications(t *testing.T) {
 	}
 	cancel()
 }
+
+func TestServiceHealthStatusObserve(t *testing.T) {
+	t.Parallel()
+
+	status := newServiceHealthStatus("test", HealthcheckPolicy{FailureThreshold: 3, SuccessThreshold: 2}, 3)
+	tests := []struct {
+		result  HealthStatus
+		expect  HealthStatus
+		changed bool
+	}{
+		// The first check always sets the status.
+		{result: HealthStatusHealthy, expect: HealthStatusHealthy, changed: true},
+		{result: HealthStatusUhealthy, expect: HealthStatusHealthy},
+		{result: HealthStatusDegarded, expect: HealthStatusHealthy},
+		// The consecutive failures are reset by the healthy check.
+		{result: HealthStatusHealthy, expect: HealthStatusHealthy},
+		{result: HealthStatusUhealthy, expect: HealthStatusHealthy},
+		{result: HealthStatusUhealthy, expect: HealthStatusHealthy},
+		{result: HealthStatusUhealthy, expect: HealthStatusUhealthy, changed: true},
+		// The status follows the failed status after the failure threshold is reached.
+		{result: HealthStatusDegarded, expect: HealthStatusDegarded, changed: true},
+		{result: HealthStatusHealthy, expect: HealthStatusDegarded},
+		{result: HealthStatusHealthy, expect: HealthStatusHealthy, changed: true},
+	}
+	for idx, test := range tests {
+		got, transition := status.observe(HealthcheckResult{Status: test.result})
+		if changed := transition != nil; got != test.expect || changed != test.changed {
+			t.Fatalf("check %d: expecting status %s and changed %t but got %s and %t", idx, test.expect, test.changed, got, changed)
+		}
+	}
+
+	// Only the latest results are retained in the history.
+	var history []HealthStatus
+	for _, result := range status.History() {
+		history = append(history, result.Status)
+	}
+	if diff := cmp.Diff([]HealthStatus{HealthStatusDegarded, HealthStatusHealthy, HealthStatusHealthy}, history); diff != "" {
+		t.Fatalf("(-want/+got)\n%s", diff)
+	}
+}
+
+func TestHealthcheckConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config HealthcheckConfig
+		expect HealthcheckConfig
+		err    bool
+	}{
+		{
+			name: "default",
+			expect: HealthcheckConfig{
+				Timeout:               healthcheckDefaultTimeout,
+				Interval:              healthcheckDefaultInterval,
+				Concurrency:           healthcheckDefaultConcurrency,
+				FailureThreshold:      healthcheckDefaultThreshold,
+				SuccessThreshold:      healthcheckDefaultThreshold,
+				HistorySize:           healthcheckDefaultHistorySize,
+				TransitionHistorySize: healthcheckDefaultTransitionHistorySize,
+			},
+		},
+		{
+			name:   "invalid jitter",
+			config: HealthcheckConfig{Jitter: 1.5},
+			err:    true,
+		},
+		{
+			name:   "negative threshold",
+			config: HealthcheckConfig{FailureThreshold: -1},
+			err:    true,
+		},
+		{
+			name:   "invalid webhook url",
+			config: HealthcheckConfig{Webhook: HealthcheckWebhookConfig{URL: "localhost:8080"}},
+			err:    true,
+		},
+		{
+			name:   "webhook",
+			config: HealthcheckConfig{Webhook: HealthcheckWebhookConfig{URL: "https://example.com/hook"}},
+			expect: HealthcheckConfig{
+				Timeout:               healthcheckDefaultTimeout,
+				Interval:              healthcheckDefaultInterval,
+				Concurrency:           healthcheckDefaultConcurrency,
+				FailureThreshold:      healthcheckDefaultThreshold,
+				SuccessThreshold:      healthcheckDefaultThreshold,
+				HistorySize:           healthcheckDefaultHistorySize,
+				TransitionHistorySize: healthcheckDefaultTransitionHistorySize,
+				Webhook: HealthcheckWebhookConfig{
+					URL:           "https://example.com/hook",
+					Timeout:       healthcheckWebhookDefaultTimeout,
+					MaxRetries:    healthcheckWebhookDefaultMaxRetries,
+					RetryInterval: healthcheckWebhookDefaultRetryInterval,
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := test.config.validate()
+			if (err != nil) != test.err {
+				t.Fatalf("expecting error %t but got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(test.expect, test.config); diff != "" {
+				t.Fatalf("(-want/+got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHealthcheckSchedule(t *testing.T) {
+	t.Parallel()
+
+	newService := func(name string, policy HealthcheckPolicy, health func(ctx context.Context) (HealthStatus, error)) *serviceWithHealthPolicy {
+		return &serviceWithHealthPolicy{
+			serviceDoNothing: &serviceDoNothing{name: name, errC: make(chan error, 1)},
+			policy:           policy,
+			health:           health,
+		}
+	}
+	releaseC := make(chan struct{})
+	defer close(releaseC)
+	// The hanging service ignores the context, so the check should not block the other services.
+	hanging := newService("hanging", HealthcheckPolicy{Interval: time.Millisecond * 50, Timeout: time.Millisecond * 50}, func(ctx context.Context) (HealthStatus, error) {
+		<-releaseC
+		return HealthStatusHealthy, nil
+	})
+	fast := newService("fast", HealthcheckPolicy{Interval: time.Millisecond * 20}, func(ctx context.Context) (HealthStatus, error) {
+		return HealthStatusHealthy, nil
+	})
+	flaky := newService("flaky", HealthcheckPolicy{Interval: time.Millisecond * 20, FailureThreshold: 1000}, func(ctx context.Context) (HealthStatus, error) {
+		return 0, errors.New("flaky")
+	})
+
+	config := HealthcheckConfig{Enabled: true, Interval: time.Hour, Concurrency: 1, Jitter: 0.5, HistorySize: 5}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	hcs := newHealthcheckService(config)
+	for _, svc := range []ServiceRunnerAware{hanging, fast, flaky} {
+		if err := hcs.register(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hcs.Init(Context{Logger: slog.Default()}); err != nil {
+		t.Fatal(err)
+	}
+	// The first check sets the status of the flaky service, the next checks are below the failure threshold.
+	if _, err := hcs.check(context.Background(), fast); err != nil {
+		t.Fatal(err)
+	}
+	hcs.servicesStatus["flaky"].Set(HealthStatusHealthy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+	if err := hcs.handleChecks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if checks := hanging.checks.Load(); checks != 1 {
+		t.Fatalf("expecting the hanging check to be invoked once but got %d", checks)
+	}
+	if status, _ := hcs.status("hanging"); status != HealthStatusUhealthy {
+		t.Fatalf("expecting the hanging service to be %s but got %s", HealthStatus(HealthStatusUhealthy), status)
+	}
+	if history := hcs.history("hanging"); len(history) == 0 || history[0].Error != errHealthcheckTimeout.Error() {
+		t.Fatalf("expecting the timeout in the history but got %v", history)
+	}
+	if checks := fast.checks.Load(); checks < 5 {
+		t.Fatalf("expecting the fast service to be checked at least 5 times but got %d", checks)
+	}
+	if history := hcs.history("fast"); len(history) != config.HistorySize {
+		t.Fatalf("expecting %d results in the history but got %d", config.HistorySize, len(history))
+	}
+	if status, _ := hcs.status("flaky"); status != HealthStatusHealthy {
+		t.Fatalf("expecting the flaky service to be %s below the failure threshold but got %s", HealthStatus(HealthStatusHealthy), status)
+	}
+}
@@ -0,0 +1,263 @@
+package srun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	healthcheckWebhookDefaultTimeout       = time.Second * 5
+	healthcheckWebhookDefaultMaxRetries    = 3
+	healthcheckWebhookDefaultRetryInterval = time.Second
+	// healthcheckWebhookQueueSize is the number of transitions waiting to be sent to the webhook. The transitions are dropped
+	// when the queue is full, so a slow webhook doesn't block the healthcheck.
+	healthcheckWebhookQueueSize = 100
+)
+
+// HealthTransition is the change of the health status of a service.
+type HealthTransition struct {
+	ServiceName string             `json:"service_name"`
+	From        HealthStatus       `json:"from"`
+	To          HealthStatus       `json:"to"`
+	Source      HealthStatusSource `json:"source"`
+	Time        time.Time          `json:"time"`
+	// Duration is how long the service was in the previous status.
+	Duration time.Duration `json:"duration"`
+	// Error is the error of the check that changes the status, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// ringBuffer keeps the latest items up to its size. The buffer is not concurrently safe, the owner must guard it.
+type ringBuffer[T any] struct {
+	items []T
+	// next is the position of the next item once the buffer is full.
+	next int
+	size int
+}
+
+func newRingBuffer[T any](size int) *ringBuffer[T] {
+	return &ringBuffer[T]{size: size}
+}
+
+func (r *ringBuffer[T]) push(item T) {
+	if r.size <= 0 {
+		return
+	}
+	if len(r.items) < r.size {
+		r.items = append(r.items, item)
+	} else {
+		r.items[r.next] = item
+	}
+	r.next = (r.next + 1) % r.size
+}
+
+// list returns the items ordered from the oldest item.
+func (r *ringBuffer[T]) list() []T {
+	items := make([]T, 0, len(r.items))
+	if len(r.items) < r.size {
+		return append(items, r.items...)
+	}
+	items = append(items, r.items[r.next:]...)
+	return append(items, r.items[:r.next]...)
+}
+
+// healthTransitionHistory keeps the latest status transitions of all services.
+type healthTransitionHistory struct {
+	mu          sync.RWMutex
+	transitions *ringBuffer[HealthTransition]
+}
+
+func newHealthTransitionHistory(size int) *healthTransitionHistory {
+	return &healthTransitionHistory{transitions: newRingBuffer[HealthTransition](size)}
+}
+
+func (h *healthTransitionHistory) add(transition HealthTransition) {
+	h.mu.Lock()
+	h.transitions.push(transition)
+	h.mu.Unlock()
+}
+
+// list returns the transitions ordered from the oldest transition. Only the transitions of the service are returned if the
+// service name is not empty.
+func (h *healthTransitionHistory) list(serviceName string) []HealthTransition {
+	h.mu.RLock()
+	transitions := h.transitions.list()
+	h.mu.RUnlock()
+	if serviceName == "" {
+		return transitions
+	}
+	filtered := transitions[:0]
+	for _, transition := range transitions {
+		if transition.ServiceName == serviceName {
+			filtered = append(filtered, transition)
+		}
+	}
+	return filtered
+}
+
+// recordTransition records the status transition of the service to the history, and sends it to the webhook.
+func (h *HealthcheckService) recordTransition(transition HealthTransition) {
+	h.transitions.add(transition)
+	if h.iCtx.Logger != nil {
+		h.iCtx.Logger.Warn(
+			"healthcheck status changed",
+			slog.String("service_name", transition.ServiceName),
+			slog.String("from", transition.From.String()),
+			slog.String("status", transition.To.String()),
+			slog.Duration("previous_status_duration", transition.Duration),
+		)
+	}
+	h.webhook.send(transition, h.iCtx.Logger)
+}
+
+// transitionHistory returns the latest status transitions, filtered by the service name if it is not empty.
+func (h *HealthcheckService) transitionHistory(serviceName string) []HealthTransition {
+	return h.transitions.list(serviceName)
+}
+
+// HealthcheckWebhookConfig configures the webhook that receives the status transitions of the services. Each transition is
+// sent as a JSON HealthTransition via POST, and the request is retried with exponential backoff when the webhook fails or
+// responds with 429 or 5xx status code.
+type HealthcheckWebhookConfig struct {
+	// URL is the endpoint of the webhook. The webhook is disabled if the URL is empty.
+	URL string `yaml:"url"`
+	// Headers are the additional headers of the request, for example the authorization header.
+	Headers map[string]string `yaml:"headers"`
+	// Timeout is the timeout of each request. By default, the timeout is 5 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxRetries is the maximum number of retries after the first request fails. By default, the request is retried 3 times.
+	MaxRetries int `yaml:"max-retries"`
+	// RetryInterval is the delay before the first retry, the delay is doubled for each retry. By default, the interval is
+	// one second.
+	RetryInterval time.Duration `yaml:"retry-interval"`
+}
+
+func (c *HealthcheckWebhookConfig) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("healthcheck: invalid webhook url %q", c.URL)
+	}
+	if c.Timeout < 0 || c.MaxRetries < 0 || c.RetryInterval < 0 {
+		return errors.New("healthcheck: webhook timeout, retries and retry interval cannot be negative")
+	}
+	if c.Timeout == 0 {
+		c.Timeout = healthcheckWebhookDefaultTimeout
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = healthcheckWebhookDefaultMaxRetries
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = healthcheckWebhookDefaultRetryInterval
+	}
+	return nil
+}
+
+// healthcheckWebhook sends the status transitions to the webhook in the background, so the healthcheck is not blocked by the
+// webhook. All methods are safe to be called with nil webhook.
+type healthcheckWebhook struct {
+	config HealthcheckWebhookConfig
+	client *http.Client
+	queueC chan HealthTransition
+}
+
+// newHealthcheckWebhook returns nil if the webhook is not configured.
+func newHealthcheckWebhook(config HealthcheckWebhookConfig) *healthcheckWebhook {
+	if config.URL == "" {
+		return nil
+	}
+	return &healthcheckWebhook{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		queueC: make(chan HealthTransition, healthcheckWebhookQueueSize),
+	}
+}
+
+// send queues the transition to be sent to the webhook. The transition is dropped if the queue is full.
+func (w *healthcheckWebhook) send(transition HealthTransition, logger *slog.Logger) {
+	if w == nil {
+		return
+	}
+	select {
+	case w.queueC <- transition:
+	default:
+		if logger != nil {
+			logger.Warn("Dropping healthcheck webhook notification, the queue is full", slog.String("service_name", transition.ServiceName))
+		}
+	}
+}
+
+// run sends the queued transitions to the webhook until the context is cancelled.
+func (w *healthcheckWebhook) run(ctx context.Context, logger *slog.Logger) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case transition := <-w.queueC:
+			if err := w.deliver(ctx, transition); err != nil && ctx.Err() == nil {
+				logger.Error(
+					"Failed to send healthcheck webhook notification",
+					slog.String("service_name", transition.ServiceName),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+	}
+}
+
+// deliver sends the transition to the webhook and retries the request with exponential backoff.
+func (w *healthcheckWebhook) deliver(ctx context.Context, transition HealthTransition) error {
+	body, err := json.Marshal(transition)
+	if err != nil {
+		return err
+	}
+	interval := w.config.RetryInterval
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == w.config.MaxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// post sends the request to the webhook. The function returns whether the request can be retried when it fails.
+func (w *healthcheckWebhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.config.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("healthcheck: webhook responded with status %d", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("healthcheck: webhook responded with status %d", resp.StatusCode)
+	}
+	return false, nil
+}
@@ -0,0 +1,228 @@
+package srun
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var _ HealthcheckTransitionConsumer = (*serviceWithTransitions)(nil)
+
+// serviceWithTransitions records the healthcheck notifications it consumes.
+type serviceWithTransitions struct {
+	*serviceDoNothing
+	mu            sync.Mutex
+	notifications []HealthcheckNotification
+	transitions   []HealthcheckNotification
+}
+
+func (s *serviceWithTransitions) ConsumeHealthcheckNotification(fn HealthcheckNotifyFunc) {
+	fn([]string{"notifier"}, func(notif HealthcheckNotification) {
+		s.mu.Lock()
+		s.notifications = append(s.notifications, notif)
+		s.mu.Unlock()
+	})
+}
+
+func (s *serviceWithTransitions) ConsumeHealthcheckTransition(fn HealthcheckNotifyFunc) {
+	fn([]string{"notifier"}, func(notif HealthcheckNotification) {
+		s.mu.Lock()
+		s.transitions = append(s.transitions, notif)
+		s.mu.Unlock()
+	})
+}
+
+func TestRingBuffer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		size   int
+		items  []int
+		expect []int
+	}{
+		{name: "empty", size: 3, expect: []int{}},
+		{name: "not full", size: 3, items: []int{1, 2}, expect: []int{1, 2}},
+		{name: "full", size: 3, items: []int{1, 2, 3, 4, 5}, expect: []int{3, 4, 5}},
+		{name: "zero size", size: 0, items: []int{1, 2}, expect: []int{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := newRingBuffer[int](test.size)
+			for _, item := range test.items {
+				r.push(item)
+			}
+			if diff := cmp.Diff(test.expect, r.list()); diff != "" {
+				t.Fatalf("(-want/+got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHealthTransitions(t *testing.T) {
+	t.Parallel()
+
+	config := HealthcheckConfig{Enabled: true, TransitionHistorySize: 2}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	hcs := newHealthcheckService(config)
+	notifier := &serviceWithHealthPolicy{
+		serviceDoNothing: &serviceDoNothing{name: "notifier", errC: make(chan error, 1)},
+		health: func(ctx context.Context) (HealthStatus, error) {
+			return HealthStatusHealthy, nil
+		},
+	}
+	consumer := &serviceWithTransitions{serviceDoNothing: &serviceDoNothing{name: "consumer", errC: make(chan error, 1)}}
+	for _, svc := range []ServiceRunnerAware{notifier, consumer} {
+		if err := hcs.register(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The notifier is created before the healthcheck service is initiated, so the notifier must be usable after Init.
+	if err := hcs.Init(Context{Logger: slog.Default()}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+		hcs.handleNotifications(ctx)
+	}()
+
+	for _, status := range []HealthStatus{HealthStatusHealthy, HealthStatusHealthy, HealthStatusDegarded, HealthStatusDegarded, HealthStatusHealthy} {
+		hcs.notifiers[notifier].Notify(status)
+	}
+	// Wait until all notifications are consumed.
+	for start := time.Now(); ; time.Sleep(time.Millisecond * 10) {
+		consumer.mu.Lock()
+		n := len(consumer.notifications)
+		consumer.mu.Unlock()
+		if n == 5 {
+			break
+		}
+		if time.Since(start) > time.Second*5 {
+			t.Fatalf("expecting 5 notifications but got %d", n)
+		}
+	}
+	cancel()
+	<-doneC
+
+	var got []HealthStatus
+	for _, notif := range consumer.transitions {
+		if notif.PreviousStatus == 0 || notif.PreviousStatusDuration <= 0 {
+			t.Fatalf("expecting the previous status of the transition but got %+v", notif)
+		}
+		got = append(got, notif.Status)
+	}
+	if diff := cmp.Diff([]HealthStatus{HealthStatusHealthy, HealthStatusDegarded, HealthStatusHealthy}, got); diff != "" {
+		t.Fatalf("(-want/+got) transitions:\n%s", diff)
+	}
+
+	// Only the latest transitions are retained in the history.
+	want := []HealthTransition{
+		{ServiceName: "notifier", From: HealthStatusHealthy, To: HealthStatusDegarded, Source: HealthStatusSourceCheckNotifier},
+		{ServiceName: "notifier", From: HealthStatusDegarded, To: HealthStatusHealthy, Source: HealthStatusSourceCheckNotifier},
+	}
+	if diff := cmp.Diff(want, hcs.transitionHistory("notifier"), cmpopts.IgnoreFields(HealthTransition{}, "Time", "Duration")); diff != "" {
+		t.Fatalf("(-want/+got) history:\n%s", diff)
+	}
+	if history := hcs.transitionHistory("consumer"); len(history) != 0 {
+		t.Fatalf("expecting no transitions of the consumer but got %v", history)
+	}
+
+	// The history is served by the admin server.
+	admin, err := newAdminServer(AdminServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.setHealthHistoryFunc(hcs.transitionHistory)
+	rec := httptest.NewRecorder()
+	admin.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/history?service=notifier", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expecting status code %d but got %d", http.StatusOK, rec.Code)
+	}
+	var body struct {
+		Transitions []HealthTransition `json:"transitions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(hcs.transitionHistory("notifier"), body.Transitions, cmpopts.EquateApproxTime(0)); diff != "" {
+		t.Fatalf("(-want/+got) /health/history:\n%s", diff)
+	}
+}
+
+func TestHealthcheckWebhook(t *testing.T) {
+	t.Parallel()
+
+	transition := HealthTransition{
+		ServiceName: "database",
+		From:        HealthStatusHealthy,
+		To:          HealthStatusUhealthy,
+		Source:      HealthStatusSourceCheckService,
+		Time:        time.Now().UTC(),
+		Duration:    time.Minute,
+		Error:       "connection refused",
+	}
+	tests := []struct {
+		name string
+		// statuses are the status codes responded by the webhook for each attempt.
+		statuses       []int
+		expectAttempts int32
+		expectErr      bool
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, expectAttempts: 1},
+		{name: "retry until success", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, expectAttempts: 3},
+		{name: "retries exhausted", statuses: []int{500, 500, 500, 500, 500}, expectAttempts: 3, expectErr: true},
+		{name: "client error is not retried", statuses: []int{http.StatusBadRequest}, expectAttempts: 1, expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := attempts.Add(1)
+				var got HealthTransition
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil || r.Header.Get("X-Token") != "secret" {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					return
+				}
+				if diff := cmp.Diff(transition, got); diff != "" {
+					t.Errorf("(-want/+got) transition:\n%s", diff)
+				}
+				w.WriteHeader(test.statuses[attempt-1])
+			}))
+			defer server.Close()
+
+			config := HealthcheckWebhookConfig{
+				URL:           server.URL,
+				Headers:       map[string]string{"X-Token": "secret"},
+				MaxRetries:    2,
+				RetryInterval: time.Millisecond * 10,
+			}
+			if err := config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			err := newHealthcheckWebhook(config).deliver(context.Background(), transition)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expecting error %t but got %v", test.expectErr, err)
+			}
+			if got := attempts.Load(); got != test.expectAttempts {
+				t.Fatalf("expecting %d attempts but got %d", test.expectAttempts, got)
+			}
+		})
+	}
+}
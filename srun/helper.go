@@ -65,6 +65,7 @@ func (c *ConcurrentServices) Register(services ...ServiceRunnerAware) error {
 		}
 		// Wrap each service in a service state tracker because we want the behavior to be the same.
 		s := newServiceStateTracker(svc, c.runnerLogger)
+		s.svcTypes = serviceTypesOf(svc, serviceTypeUser)
 		c.services = append(c.services, s)
 	}
 	return nil
@@ -85,10 +86,12 @@ func (c *ConcurrentServices) Init(ctx Context) error {
 		s := svc
 		errGroup.Go(func() error {
 			return s.Init(Context{
-				Ctx:    ctx.Ctx,
-				Logger: c.runnerLogger.WithGroup(s.Name()),
-				Meter:  ctx.Meter,
-				Tracer: ctx.Tracer,
+				Ctx:            ctx.Ctx,
+				Logger:         c.runnerLogger.WithGroup(s.Name()),
+				Meter:          ctx.Meter,
+				Tracer:         ctx.Tracer,
+				MeterProvider:  ctx.MeterProvider,
+				TracerProvider: ctx.TracerProvider,
 			})
 		})
 	}
@@ -185,6 +188,12 @@ func NewLongRunningTask(name string, fn func(ctx Context) error) (*LongRunningTa
 	}, nil
 }
 
+var (
+	_ ServiceRestartAware       = (*LongRunningTask)(nil)
+	_ ServiceShutdownPhaseAware = (*LongRunningTask)(nil)
+	_ ServiceStopTimeoutAware   = (*LongRunningTask)(nil)
+)
+
 // LongRunningTask is usually used for trivial task like serving http server without using the
 // internal package that aware of runner package. This means we can start the standard library
 // http server easily using this object.
@@ -208,6 +217,11 @@ type LongRunningTask struct {
 	// a context cancelled error that might not behave as intended.
 	stopC   chan struct{}
 	stopCtx context.Context
+	// restartPolicy is the restart policy of the task when the task exits.
+	restartPolicy RestartPolicy
+	// shutdownPhase and stopTimeout control how the runner stops the task.
+	shutdownPhase ShutdownPhase
+	stopTimeout   time.Duration
 }
 
 // Name returns the name of the long running task.
@@ -218,9 +232,51 @@ func (l *LongRunningTask) Name() string {
 // Init does nothing in the long-running-task as it only wraps function.
 func (l *LongRunningTask) Init(ctx Context) error {
 	l.iCtx = ctx
+	// Reset the error from the previous run as the task might be restarted.
+	l.errMu.Lock()
+	l.err = nil
+	l.errMu.Unlock()
 	return nil
 }
 
+// SetRestartPolicy sets the restart policy of the task. By default, the task is never restarted and the runner stops all
+// services when the task returns an error.
+//
+// The restart policy must be set before the task is registered to the runner.
+func (l *LongRunningTask) SetRestartPolicy(policy RestartPolicy) {
+	l.restartPolicy = policy
+}
+
+// RestartPolicy returns the restart policy of the task.
+func (l *LongRunningTask) RestartPolicy() RestartPolicy {
+	return l.restartPolicy
+}
+
+// SetShutdownPhase sets the shutdown phase of the task. By default, the task is stopped in ShutdownPhaseDefault.
+//
+// The shutdown phase must be set before the task is registered to the runner.
+func (l *LongRunningTask) SetShutdownPhase(phase ShutdownPhase) {
+	l.shutdownPhase = phase
+}
+
+// ShutdownPhase returns the shutdown phase of the task.
+func (l *LongRunningTask) ShutdownPhase() ShutdownPhase {
+	return l.shutdownPhase
+}
+
+// SetStopTimeout sets the maximum duration for the task to stop. By default, the task is only bounded by the timeout of
+// its shutdown phase.
+//
+// The stop timeout must be set before the task is registered to the runner.
+func (l *LongRunningTask) SetStopTimeout(timeout time.Duration) {
+	l.stopTimeout = timeout
+}
+
+// StopTimeout returns the stop timeout of the task.
+func (l *LongRunningTask) StopTimeout() time.Duration {
+	return l.stopTimeout
+}
+
 func (l *LongRunningTask) Run(ctx context.Context) error {
 	// Create a new context for cancellation because we will trigger the cancel context in the stop function.
 	cancelCtx, cancel := context.WithCancel(ctx)
@@ -238,6 +294,8 @@ func (l *LongRunningTask) Run(ctx context.Context) error {
 			Logger:         l.iCtx.Logger,
 			Meter:          l.iCtx.Meter,
 			Tracer:         l.iCtx.Tracer,
+			MeterProvider:  l.iCtx.MeterProvider,
+			TracerProvider: l.iCtx.TracerProvider,
 			HealthNotifier: l.iCtx.HealthNotifier,
 		})
 	}()
@@ -267,7 +325,10 @@ func (l *LongRunningTask) Run(ctx context.Context) error {
 		}
 	case err := <-errC:
 		// If somehow the context is cancelled here, we should append the log with stop deadline.
-		if l.stopCtx != nil && l.stopCtx.Err() != nil {
+		l.stopMu.Lock()
+		stopCtx := l.stopCtx
+		l.stopMu.Unlock()
+		if stopCtx != nil && stopCtx.Err() != nil {
 			err = errors.Join(err, errLongRunningTaskStopDeadline)
 		}
 		l.errMu.Lock()
@@ -0,0 +1,131 @@
+package srun
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ListenerRequest is the request of a listener or a packet connection from a service.
+type ListenerRequest struct {
+	// Network is the network of the listener, for example 'tcp', 'unix', 'udp' or 'unixgram'. A net.PacketConn is created for
+	// the packet networks, which are 'udp', 'udp4', 'udp6', 'unixgram' and 'ip', and a net.Listener is created for the others.
+	Network string
+	Address string
+	// FileMode is the permission of the unix socket file. The permission is not changed if the mode is zero.
+	FileMode os.FileMode
+}
+
+// ServiceListener is the listener or the packet connection created for a ListenerRequest.
+type ServiceListener struct {
+	ListenerRequest
+	// Listener is set for the stream networks.
+	Listener net.Listener
+	// PacketConn is set for the packet networks.
+	PacketConn net.PacketConn
+}
+
+// ServiceListenersAware defines a service that requires multiple listeners and packet connections. The runner creates the
+// listeners before the service is initiated for the first time. When the self-upgrade is enabled, the listeners are created
+// via the upgrader, so the listeners are passed to the new process and survive the upgrade. For example:
+//
+//	func (s *DNSServer) RequiredListeners() []srun.ListenerRequest {
+//		return []srun.ListenerRequest{
+//			{Network: "tcp", Address: ":53"},
+//			{Network: "udp", Address: ":53"},
+//			{Network: "unix", Address: "/run/dns.sock", FileMode: 0o660},
+//		}
+//	}
+//
+// Unlike ServiceUpgraderAware, the listeners are created even though the self-upgrade is disabled.
+type ServiceListenersAware interface {
+	RequiredListeners() []ListenerRequest
+	// RegisterListeners registers the listeners to the service, the listeners are in the same order with the requests.
+	RegisterListeners(listeners []ServiceListener)
+}
+
+// isPacketNetwork returns true if the network is a packet-oriented network.
+func isPacketNetwork(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	// The ip networks might have the protocol suffix, for example 'ip4:icmp'.
+	network, _, _ = strings.Cut(network, ":")
+	switch network {
+	case "ip", "ip4", "ip6":
+		return true
+	}
+	return false
+}
+
+// isUnixNetwork returns true if the network uses a unix socket file.
+func isUnixNetwork(network string) bool {
+	switch network {
+	case "unix", "unixgram", "unixpacket":
+		return true
+	}
+	return false
+}
+
+// listen creates the listener or the packet connection of the request. The listener is created via the upgrader if the
+// self-upgrade is enabled, so the listener can be passed to the new process. The socket passed by systemd is used instead of
+// creating a new one if the address matches.
+func (r *Runner) listen(req ListenerRequest) (ServiceListener, error) {
+	sl := ServiceListener{ListenerRequest: req}
+	var err error
+	switch packet := isPacketNetwork(req.Network); {
+	case packet && r.upgrader != nil:
+		sl.PacketConn, err = r.upgrader.createPacketConn(req.Network, req.Address)
+	case packet:
+		sl.PacketConn, err = r.systemd.listenPacket(req.Network, req.Address)
+	case r.upgrader != nil:
+		sl.Listener, err = r.upgrader.createListener(req.Network, req.Address)
+	default:
+		sl.Listener, err = r.systemd.listen(req.Network, req.Address)
+	}
+	if err != nil {
+		return sl, err
+	}
+	if req.FileMode != 0 && isUnixNetwork(req.Network) {
+		if err := os.Chmod(req.Address, req.FileMode); err != nil {
+			return sl, errors.Join(err, sl.close())
+		}
+	}
+	return sl, nil
+}
+
+func (sl ServiceListener) close() error {
+	if sl.Listener != nil {
+		return sl.Listener.Close()
+	}
+	if sl.PacketConn != nil {
+		return sl.PacketConn.Close()
+	}
+	return nil
+}
+
+// registerListeners creates the listeners that required by the service and registers them to the service. The listeners that
+// already created are closed if one of the listeners failed to be created.
+func (r *Runner) registerListeners(svc *ServiceStateTracker) error {
+	sla, ok := svc.ServiceInitAware.(ServiceListenersAware)
+	if !ok {
+		return nil
+	}
+	requests := sla.RequiredListeners()
+	listeners := make([]ServiceListener, 0, len(requests))
+	for _, req := range requests {
+		sl, err := r.listen(req)
+		if err != nil {
+			for _, l := range listeners {
+				l.close()
+			}
+			return fmt.Errorf("service %s: failed to listen %s %s: %w", svc.Name(), req.Network, req.Address, err)
+		}
+		listeners = append(listeners, sl)
+	}
+	sla.RegisterListeners(listeners)
+	return nil
+}
@@ -0,0 +1,142 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var _ ServiceListenersAware = (*serviceWithListeners)(nil)
+
+// serviceWithListeners is a service that records the listeners registered by the runner.
+type serviceWithListeners struct {
+	*serviceDoNothing
+	requests  []ListenerRequest
+	listeners []ServiceListener
+	// initListeners is the number of listeners when Init is called.
+	initListeners int
+}
+
+func (s *serviceWithListeners) RequiredListeners() []ListenerRequest {
+	return s.requests
+}
+
+func (s *serviceWithListeners) RegisterListeners(listeners []ServiceListener) {
+	s.listeners = listeners
+}
+
+func (s *serviceWithListeners) Init(ctx Context) error {
+	s.initListeners = len(s.listeners)
+	return s.serviceDoNothing.Init(ctx)
+}
+
+func TestIsPacketNetwork(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		network string
+		expect  bool
+	}{
+		{network: "tcp", expect: false},
+		{network: "tcp4", expect: false},
+		{network: "unix", expect: false},
+		{network: "unixpacket", expect: false},
+		{network: "udp", expect: true},
+		{network: "udp6", expect: true},
+		{network: "unixgram", expect: true},
+		{network: "ip4:icmp", expect: true},
+	}
+	for _, test := range tests {
+		if got := isPacketNetwork(test.network); got != test.expect {
+			t.Errorf("%s: expecting packet network %t but got %t", test.network, test.expect, got)
+		}
+	}
+}
+
+func TestServiceListeners(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		Name:             "testing_listeners",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Millisecond * 500,
+	}
+	newService := func(requests ...ListenerRequest) *serviceWithListeners {
+		return &serviceWithListeners{
+			serviceDoNothing: &serviceDoNothing{
+				errC: make(chan error, 1),
+				onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
+					<-ctx.Done()
+					return nil
+				},
+			},
+			requests: requests,
+		}
+	}
+
+	t.Run("multiple listeners", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		svc := newService(
+			ListenerRequest{Network: "tcp", Address: "127.0.0.1:0"},
+			ListenerRequest{Network: "udp", Address: "127.0.0.1:0"},
+			ListenerRequest{Network: "unix", Address: filepath.Join(dir, "stream.sock"), FileMode: 0o600},
+			ListenerRequest{Network: "unixgram", Address: filepath.Join(dir, "packet.sock"), FileMode: 0o660},
+		)
+		err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+			return runner.Register(svc)
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if svc.initListeners != len(svc.requests) {
+			t.Fatalf("expecting %d listeners when the service is initiated but got %d", len(svc.requests), svc.initListeners)
+		}
+		for idx, l := range svc.listeners {
+			if l.ListenerRequest != svc.requests[idx] {
+				t.Fatalf("expecting listener %d for request %v but got %v", idx, svc.requests[idx], l.ListenerRequest)
+			}
+			packet := isPacketNetwork(l.Network)
+			if (l.PacketConn != nil) != packet || (l.Listener != nil) == packet {
+				t.Fatalf("%s: unexpected listener %v and packet connection %v", l.Network, l.Listener, l.PacketConn)
+			}
+			if l.FileMode != 0 {
+				info, err := os.Stat(l.Address)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != l.FileMode {
+					t.Fatalf("%s: expecting file mode %v but got %v", l.Address, l.FileMode, info.Mode().Perm())
+				}
+			}
+			if err := l.close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("failed to listen", func(t *testing.T) {
+		t.Parallel()
+
+		svc := newService(
+			ListenerRequest{Network: "tcp", Address: "127.0.0.1:0"},
+			ListenerRequest{Network: "invalid", Address: "127.0.0.1:0"},
+		)
+		err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+			return runner.Register(svc)
+		})
+		if err == nil || !strings.Contains(err.Error(), "failed to listen invalid") {
+			t.Fatalf("expecting listen error but got %v", err)
+		}
+		if svc.listeners != nil {
+			t.Fatal("expecting the listeners to not be registered")
+		}
+	})
+}
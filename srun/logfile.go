@@ -0,0 +1,265 @@
+package srun
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFileBackupTimeFormat is the time format of the rotated log file suffix, the format is sortable so the oldest backup can be
+// found by sorting the file names.
+const logFileBackupTimeFormat = "20060102T150405.000000000"
+
+var _ io.WriteCloser = (*logFile)(nil)
+
+// LogFileConfig configures the file output of a log sink.
+type LogFileConfig struct {
+	// Path is the path of the log file. The directory of the file is created if it doesn't exist.
+	Path string `yaml:"path"`
+	// MaxSize is the maximum size of the log file in bytes before it is rotated. The file is not rotated by size if the
+	// size is zero.
+	MaxSize int64 `yaml:"max-size"`
+	// RotateInterval rotates the log file periodically, the rotation time is aligned to the interval, so the daily rotation
+	// happens at midnight UTC. The file is not rotated periodically if the interval is zero.
+	RotateInterval time.Duration `yaml:"rotate-interval"`
+	// MaxBackups is the maximum number of rotated files to keep, the oldest files are removed first. All rotated files are
+	// kept if MaxBackups is zero.
+	MaxBackups int `yaml:"max-backups"`
+	// Compress compresses the rotated files with gzip.
+	Compress bool `yaml:"compress"`
+}
+
+func (c LogFileConfig) validate() error {
+	if c.Path == "" {
+		return withConfigKey("path", errors.New("log file: path cannot be empty"))
+	}
+	if c.MaxSize < 0 || c.RotateInterval < 0 || c.MaxBackups < 0 {
+		return errors.New("log file: max size, rotate interval and max backups cannot be negative")
+	}
+	return nil
+}
+
+// logFile is a log file writer that rotates the file by size and time. The rotated file is renamed with the rotation time as
+// its suffix, for example 'program.log.20240102T150405.000000000'.
+type logFile struct {
+	config LogFileConfig
+	now    func() time.Time
+
+	mu           sync.Mutex
+	file         *os.File
+	size         int64
+	nextRotation time.Time
+
+	// cleanupMu guards the removal of the old backups, as the backups are removed after compressed in the background.
+	cleanupMu sync.Mutex
+	// compressWg waits for the background compression to finish.
+	compressWg sync.WaitGroup
+}
+
+func newLogFile(config LogFileConfig) (*logFile, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &logFile{config: config, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *logFile) open() error {
+	file, err := os.OpenFile(f.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	if f.config.RotateInterval > 0 {
+		f.nextRotation = f.now().Truncate(f.config.RotateInterval).Add(f.config.RotateInterval)
+	}
+	return nil
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *logFile) shouldRotate(length int) bool {
+	if f.config.MaxSize > 0 && f.size > 0 && f.size+int64(length) > f.config.MaxSize {
+		return true
+	}
+	return f.config.RotateInterval > 0 && !f.now().Before(f.nextRotation)
+}
+
+// rotate renames the current file as a backup and opens a new file.
+func (f *logFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := f.config.Path + "." + f.now().UTC().Format(logFileBackupTimeFormat)
+	if err := os.Rename(f.config.Path, backup); err != nil {
+		// Reopen the current file, so the logs can still be written even though the file is not rotated.
+		return errors.Join(err, f.open())
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if !f.config.Compress {
+		f.removeOldBackups()
+		return nil
+	}
+	f.compressWg.Add(1)
+	go func() {
+		defer f.compressWg.Done()
+		// Keep the uncompressed backup if the compression fails, so the logs are not lost.
+		compressLogFile(backup)
+		f.removeOldBackups()
+	}()
+	return nil
+}
+
+// Reopen closes and opens the log file at the same path. This allows external tools like logrotate to move the log file and
+// ask the program to write to a new file.
+func (f *logFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the log file and waits for the background compression to finish.
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.compressWg.Wait()
+	return err
+}
+
+// removeOldBackups removes the oldest backups when the number of backups exceeds MaxBackups.
+func (f *logFile) removeOldBackups() {
+	if f.config.MaxBackups == 0 {
+		return
+	}
+	f.cleanupMu.Lock()
+	defer f.cleanupMu.Unlock()
+
+	matches, err := filepath.Glob(f.config.Path + ".*")
+	if err != nil {
+		return
+	}
+	// The backup might exist in both compressed and uncompressed form while it is being compressed, so count the backups by
+	// their names without the compression suffix.
+	var backups []string
+	for _, match := range matches {
+		name := strings.TrimSuffix(match, ".gz")
+		if _, err := time.Parse(logFileBackupTimeFormat, strings.TrimPrefix(name, f.config.Path+".")); err != nil {
+			continue
+		}
+		if !slices.Contains(backups, name) {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= f.config.MaxBackups {
+		return
+	}
+	slices.Sort(backups)
+	for _, backup := range backups[:len(backups)-f.config.MaxBackups] {
+		os.Remove(backup)
+		os.Remove(backup + ".gz")
+	}
+}
+
+// compressLogFile compresses the file with gzip and removes the original file once the file is compressed.
+func compressLogFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(dst)
+	_, err = io.Copy(gw, src)
+	err = errors.Join(err, gw.Close(), dst.Close())
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// newLogFileReopenService returns a long running task that reopens the log files when the program receives the signal.
+func newLogFileReopenService(files []*logFile, sig os.Signal) (*LongRunningTask, error) {
+	fn := func(ctx Context) error {
+		sigC := make(chan os.Signal, 1)
+		signal.Notify(sigC, sig)
+		defer signal.Stop(sigC)
+
+		for {
+			select {
+			case <-ctx.Ctx.Done():
+				return nil
+			case <-sigC:
+				for _, file := range files {
+					if err := file.Reopen(); err != nil {
+						ctx.Logger.Error("failed to reopen log file", slog.String("path", file.config.Path), slog.String("error", err.Error()))
+					}
+				}
+			}
+		}
+	}
+	task, err := NewLongRunningTask("srun-log-file-reopener", fn)
+	if err != nil {
+		return nil, err
+	}
+	// Keep listening to the signal until the last phase, so the logs of the shutdown process can still be written to the new
+	// files.
+	task.SetShutdownPhase(ShutdownPhaseTelemetry)
+	return task, nil
+}
@@ -0,0 +1,171 @@
+package srun
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readLogFiles returns the content of the log file and its backups sorted by the backup time. The compressed backups are
+// decompressed.
+func readLogFiles(t *testing.T, path string) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(matches)
+	var contents []string
+	for _, name := range append(matches, path) {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(name, ".gz") {
+			gr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gr
+		}
+		out, err := io.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(out))
+	}
+	return contents
+}
+
+func TestLogFileRotateSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		config       LogFileConfig
+		expect       []string
+		expectSuffix string
+	}{
+		{
+			name:   "rotate",
+			config: LogFileConfig{MaxSize: 10},
+			expect: []string{"line-1\n", "line-2\n", "line-3\n"},
+		},
+		{
+			name:   "max backups",
+			config: LogFileConfig{MaxSize: 10, MaxBackups: 1},
+			expect: []string{"line-2\n", "line-3\n"},
+		},
+		{
+			name:         "compress",
+			config:       LogFileConfig{MaxSize: 10, MaxBackups: 1, Compress: true},
+			expect:       []string{"line-2\n", "line-3\n"},
+			expectSuffix: ".gz",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.config.Path = filepath.Join(t.TempDir(), "logs", "test.log")
+			f, err := newLogFile(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range []string{"line-1\n", "line-2\n", "line-3\n"} {
+				if _, err := f.Write([]byte(line)); err != nil {
+					t.Fatal(err)
+				}
+				// Sleep to ensure the backup names are different.
+				time.Sleep(time.Millisecond)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.expect, readLogFiles(t, test.config.Path)); diff != "" {
+				t.Fatalf("(-want/+got)\n%s", diff)
+			}
+			backups, err := filepath.Glob(test.config.Path + ".*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, backup := range backups {
+				if !strings.HasSuffix(backup, test.expectSuffix) {
+					t.Fatalf("expecting backup %s to have suffix %q", backup, test.expectSuffix)
+				}
+			}
+		})
+	}
+}
+
+func TestLogFileRotateInterval(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "test.log")
+	f := &logFile{config: LogFileConfig{Path: path, RotateInterval: time.Hour * 24}, now: func() time.Time { return now }}
+	if err := f.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("day-1\n"))
+	// The file is rotated at midnight.
+	now = now.Add(time.Minute)
+	f.Write([]byte("day-2\n"))
+	now = now.Add(time.Hour)
+	f.Write([]byte("day-2\n"))
+
+	if diff := cmp.Diff([]string{"day-1\n", "day-2\nday-2\n"}, readLogFiles(t, path)); diff != "" {
+		t.Fatalf("(-want/+got)\n%s", diff)
+	}
+	if _, err := os.Stat(path + ".20240102T000000.000000000"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogFileReopen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+	f, err := newLogFile(LogFileConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before\n"))
+	// Simulate logrotate that moves the file before asking the program to reopen the file.
+	moved := filepath.Join(dir, "moved.log")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("moved\n"))
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+
+	for name, expect := range map[string]string{moved: "before\nmoved\n", path: "after\n"} {
+		out, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expect, string(out)); diff != "" {
+			t.Fatalf("%s: (-want/+got)\n%s", name, diff)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// runnerMetrics is the lifecycle metrics of the runner and its services.
+type runnerMetrics struct {
+	// restarts counts the number of service restarts based on the service restart policy.
+	restarts metric.Int64Counter
+	// stateTransitions counts the state transitions of the services.
+	stateTransitions metric.Int64Counter
+	initDuration     metric.Float64Histogram
+	readyDuration    metric.Float64Histogram
+	stopDuration     metric.Float64Histogram
+	// shutdownDuration is the time spent to stop the services within the graceful period.
+	shutdownDuration metric.Float64Histogram
+	// reloads counts the configuration reloads by their result.
+	reloads metric.Int64Counter
+	// upgrades counts the binary upgrades by their result.
+	upgrades        metric.Int64Counter
+	upgradeDuration metric.Float64Histogram
+}
+
+func newRunnerMetrics(meter metric.Meter) (*runnerMetrics, error) {
+	var (
+		m   runnerMetrics
+		err error
+		e   error
+	)
+	m.restarts, e = meter.Int64Counter(
+		"srun.service.restarts",
+		metric.WithDescription("The number of service restarts based on the service restart policy."),
+	)
+	err = errors.Join(err, e)
+	m.stateTransitions, e = meter.Int64Counter(
+		"srun.service.state.transitions",
+		metric.WithDescription("The number of service state transitions."),
+	)
+	err = errors.Join(err, e)
+	m.initDuration, e = meter.Float64Histogram(
+		"srun.service.init.duration",
+		metric.WithDescription("The duration of service Init."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	m.readyDuration, e = meter.Float64Histogram(
+		"srun.service.ready.duration",
+		metric.WithDescription("The duration of waiting for the service to be ready."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	m.stopDuration, e = meter.Float64Histogram(
+		"srun.service.stop.duration",
+		metric.WithDescription("The duration of service Stop."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	m.shutdownDuration, e = meter.Float64Histogram(
+		"srun.shutdown.duration",
+		metric.WithDescription("The duration of stopping the services within the graceful period."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	m.reloads, e = meter.Int64Counter(
+		"srun.config.reloads",
+		metric.WithDescription("The number of configuration reloads."),
+	)
+	err = errors.Join(err, e)
+	m.upgrades, e = meter.Int64Counter(
+		"srun.upgrades",
+		metric.WithDescription("The number of binary upgrades."),
+	)
+	err = errors.Join(err, e)
+	m.upgradeDuration, e = meter.Float64Histogram(
+		"srun.upgrade.duration",
+		metric.WithDescription("The duration of waiting for the new process to be ready when upgrading the binary."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// serviceAttributes returns the metric attributes of a service.
+func serviceAttributes(name string, attrs ...attribute.KeyValue) metric.MeasurementOption {
+	return metric.WithAttributes(append([]attribute.KeyValue{attribute.String("service_name", name)}, attrs...)...)
+}
+
+// The record functions below are safe to be called with nil metrics, as the service state tracker can be created without the runner.
+
+func (m *runnerMetrics) recordInit(name string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.initDuration.Record(context.Background(), time.Since(start).Seconds(), serviceAttributes(name))
+}
+
+func (m *runnerMetrics) recordReady(name string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.readyDuration.Record(context.Background(), time.Since(start).Seconds(), serviceAttributes(name))
+}
+
+func (m *runnerMetrics) recordStop(name string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.stopDuration.Record(context.Background(), time.Since(start).Seconds(), serviceAttributes(name))
+}
+
+func (m *runnerMetrics) recordShutdown(start time.Time) {
+	if m == nil {
+		return
+	}
+	m.shutdownDuration.Record(context.Background(), time.Since(start).Seconds())
+}
+
+func (m *runnerMetrics) recordStateTransition(name string, state serviceState) {
+	if m == nil {
+		return
+	}
+	m.stateTransitions.Add(context.Background(), 1, serviceAttributes(name, attribute.String("state", state.String())))
+}
+
+func (m *runnerMetrics) recordRestart(ctx context.Context, name string) {
+	if m == nil {
+		return
+	}
+	m.restarts.Add(ctx, 1, serviceAttributes(name))
+}
+
+func (m *runnerMetrics) recordReload(result string) {
+	if m == nil {
+		return
+	}
+	m.reloads.Add(context.Background(), 1, metric.WithAttributes(attribute.String("result", result)))
+}
+
+func (m *runnerMetrics) recordUpgrade(result string, start time.Time) {
+	if m == nil {
+		return
+	}
+	attrs := metric.WithAttributes(attribute.String("result", result))
+	m.upgrades.Add(context.Background(), 1, attrs)
+	m.upgradeDuration.Record(context.Background(), time.Since(start).Seconds(), attrs)
+}
+
+// runtimeMetricSamples are the Go runtime metrics that are reported by the runner.
+var runtimeMetricSamples = []string{
+	"/sched/goroutines:goroutines",
+	"/sched/gomaxprocs:threads",
+	"/sched/latencies:seconds",
+	"/gc/cycles/total:gc-cycles",
+	"/gc/heap/goal:bytes",
+	"/gc/heap/allocs:bytes",
+	"/sched/pauses/total/gc:seconds",
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/total:bytes",
+}
+
+// runtimeMetricQuantiles are the quantiles reported from the runtime histograms, because observable histogram is not supported
+// by the open telemetry.
+var runtimeMetricQuantiles = []float64{0.5, 0.9, 0.99}
+
+// registerRuntimeMetrics registers the Go runtime and process metrics to the meter. The metrics are read when the metrics are
+// collected, so there is no background goroutine to collect the metrics. The process metrics are only available in linux.
+func registerRuntimeMetrics(meter metric.Meter) error {
+	var (
+		err error
+		e   error
+	)
+	goroutines, e := meter.Int64ObservableUpDownCounter(
+		"go.goroutine.count",
+		metric.WithDescription("Count of live goroutines."),
+	)
+	err = errors.Join(err, e)
+	processors, e := meter.Int64ObservableUpDownCounter(
+		"go.processor.limit",
+		metric.WithDescription("The number of OS threads that can execute user-level Go code simultaneously."),
+	)
+	err = errors.Join(err, e)
+	scheduleLatency, e := meter.Float64ObservableGauge(
+		"go.schedule.duration",
+		metric.WithDescription("The time goroutines have spent in the scheduler in a runnable state before actually running, by quantile."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	gcCycles, e := meter.Int64ObservableCounter(
+		"go.gc.count",
+		metric.WithDescription("Count of completed GC cycles."),
+	)
+	err = errors.Join(err, e)
+	gcPause, e := meter.Float64ObservableGauge(
+		"go.gc.pause.duration",
+		metric.WithDescription("The stop-the-world pause duration caused by the GC, by quantile."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	gcGoal, e := meter.Int64ObservableUpDownCounter(
+		"go.memory.gc.goal",
+		metric.WithDescription("Heap size target for the end of the GC cycle."),
+		metric.WithUnit("By"),
+	)
+	err = errors.Join(err, e)
+	heapAllocated, e := meter.Int64ObservableCounter(
+		"go.memory.allocated",
+		metric.WithDescription("Memory allocated to the heap by the application."),
+		metric.WithUnit("By"),
+	)
+	err = errors.Join(err, e)
+	heapUsed, e := meter.Int64ObservableUpDownCounter(
+		"go.memory.heap.used",
+		metric.WithDescription("Memory occupied by live objects and dead objects that have not yet been marked free by the GC."),
+		metric.WithUnit("By"),
+	)
+	err = errors.Join(err, e)
+	memoryTotal, e := meter.Int64ObservableUpDownCounter(
+		"go.memory.used",
+		metric.WithDescription("All memory mapped by the Go runtime into the current process."),
+		metric.WithUnit("By"),
+	)
+	err = errors.Join(err, e)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		// Create the samples for each callback as the callback might be called concurrently by multiple readers.
+		samples := make([]metrics.Sample, len(runtimeMetricSamples))
+		for idx, name := range runtimeMetricSamples {
+			samples[idx].Name = name
+		}
+		metrics.Read(samples)
+		values := make(map[string]metrics.Value, len(samples))
+		for _, sample := range samples {
+			values[sample.Name] = sample.Value
+		}
+		observeUint64 := func(instrument metric.Int64Observable, name string) {
+			if v := values[name]; v.Kind() == metrics.KindUint64 {
+				o.ObserveInt64(instrument, int64(v.Uint64()))
+			}
+		}
+		observeQuantiles := func(instrument metric.Float64Observable, name string) {
+			v := values[name]
+			if v.Kind() != metrics.KindFloat64Histogram {
+				return
+			}
+			for _, q := range runtimeMetricQuantiles {
+				o.ObserveFloat64(
+					instrument,
+					histogramQuantile(v.Float64Histogram(), q),
+					metric.WithAttributes(attribute.String("quantile", strconv.FormatFloat(q, 'f', -1, 64))),
+				)
+			}
+		}
+		observeUint64(goroutines, "/sched/goroutines:goroutines")
+		observeUint64(processors, "/sched/gomaxprocs:threads")
+		observeQuantiles(scheduleLatency, "/sched/latencies:seconds")
+		observeUint64(gcCycles, "/gc/cycles/total:gc-cycles")
+		observeQuantiles(gcPause, "/sched/pauses/total/gc:seconds")
+		observeUint64(gcGoal, "/gc/heap/goal:bytes")
+		observeUint64(heapAllocated, "/gc/heap/allocs:bytes")
+		observeUint64(heapUsed, "/memory/classes/heap/objects:bytes")
+		observeUint64(memoryTotal, "/memory/classes/total:bytes")
+		return nil
+	},
+		goroutines, processors, scheduleLatency, gcCycles, gcPause, gcGoal, heapAllocated, heapUsed, memoryTotal,
+	)
+	if err != nil {
+		return err
+	}
+	return registerProcessMetrics(meter)
+}
+
+// histogramQuantile returns the approximate quantile of the runtime histogram. The upper boundary of the bucket is used as the
+// value of the quantile.
+func histogramQuantile(h *metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	threshold := uint64(q * float64(total))
+	var cumulative uint64
+	for idx, count := range h.Counts {
+		cumulative += count
+		if cumulative > threshold {
+			// The bucket boundaries has one more element than the counts, and the last boundary might be infinite.
+			upper := h.Buckets[idx+1]
+			if math.IsInf(upper, 1) {
+				return h.Buckets[idx]
+			}
+			return upper
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
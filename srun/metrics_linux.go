@@ -0,0 +1,81 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// registerProcessMetrics registers the process metrics to the meter. The cpu time is read via getrusage, and the memory usage
+// and open file descriptors are read from procfs.
+func registerProcessMetrics(meter metric.Meter) error {
+	var (
+		err error
+		e   error
+	)
+	cpuTime, e := meter.Float64ObservableCounter(
+		"process.cpu.time",
+		metric.WithDescription("Total CPU seconds broken down by different CPU modes."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	memoryUsage, e := meter.Int64ObservableUpDownCounter(
+		"process.memory.usage",
+		metric.WithDescription("The amount of physical memory in use."),
+		metric.WithUnit("By"),
+	)
+	err = errors.Join(err, e)
+	openFDs, e := meter.Int64ObservableUpDownCounter(
+		"process.open_file_descriptor.count",
+		metric.WithDescription("Number of file descriptors in use by the process."),
+	)
+	err = errors.Join(err, e)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		var rusage syscall.Rusage
+		if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err == nil {
+			o.ObserveFloat64(cpuTime, timevalSeconds(rusage.Utime), metric.WithAttributes(attribute.String("cpu.mode", "user")))
+			o.ObserveFloat64(cpuTime, timevalSeconds(rusage.Stime), metric.WithAttributes(attribute.String("cpu.mode", "system")))
+		}
+		if rss, ok := processRSS(); ok {
+			o.ObserveInt64(memoryUsage, rss)
+		}
+		if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+			o.ObserveInt64(openFDs, int64(len(fds)))
+		}
+		return nil
+	},
+		cpuTime, memoryUsage, openFDs,
+	)
+	return err
+}
+
+func timevalSeconds(tv syscall.Timeval) float64 {
+	return float64(tv.Sec) + float64(tv.Usec)/1e6
+}
+
+// processRSS returns the resident set size of the process from /proc/self/statm.
+func processRSS() (int64, bool) {
+	out, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return pages * int64(os.Getpagesize()), true
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package srun
+
+import "go.opentelemetry.io/otel/metric"
+
+// registerProcessMetrics doesn't register the process metrics outside linux, as the metrics are read via getrusage and procfs.
+func registerProcessMetrics(metric.Meter) error {
+	return nil
+}
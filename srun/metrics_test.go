@@ -0,0 +1,156 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectMetrics collects the metrics from the reader and returns the metrics by name.
+func collectMetrics(t *testing.T, reader metricsdk.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			result[m.Name] = m
+		}
+	}
+	return result
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	t.Parallel()
+
+	reader := metricsdk.NewManualReader()
+	provider := metricsdk.NewMeterProvider(metricsdk.WithReader(reader))
+	if err := registerRuntimeMetrics(provider.Meter("testing")); err != nil {
+		t.Fatal(err)
+	}
+
+	collected := collectMetrics(t, reader)
+	expectMetrics := []string{
+		"go.goroutine.count",
+		"go.processor.limit",
+		"go.schedule.duration",
+		"go.gc.count",
+		"go.memory.gc.goal",
+		"go.memory.allocated",
+		"go.memory.heap.used",
+		"go.memory.used",
+	}
+	// The process metrics are only available in linux.
+	if runtime.GOOS == "linux" {
+		expectMetrics = append(expectMetrics, "process.cpu.time", "process.memory.usage", "process.open_file_descriptor.count")
+	}
+	for _, name := range expectMetrics {
+		if _, ok := collected[name]; !ok {
+			t.Errorf("expecting metric %s to be collected", name)
+		}
+	}
+
+	goroutines, ok := collected["go.goroutine.count"].Data.(metricdata.Sum[int64])
+	if !ok || len(goroutines.DataPoints) != 1 || goroutines.DataPoints[0].Value <= 0 {
+		t.Fatalf("expecting goroutine count to be reported, got %+v", collected["go.goroutine.count"].Data)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	t.Parallel()
+
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 4, 1},
+		Buckets: []float64{0, 1, 2, math.Inf(1)},
+	}
+	tests := []struct {
+		quantile float64
+		expect   float64
+	}{
+		{quantile: 0.1, expect: 1},
+		{quantile: 0.5, expect: 2},
+		{quantile: 0.8, expect: 2},
+		// The last bucket is infinite, so the lower boundary is used.
+		{quantile: 0.99, expect: 2},
+	}
+	for _, tt := range tests {
+		if got := histogramQuantile(h, tt.quantile); got != tt.expect {
+			t.Errorf("quantile %v: expecting %v but got %v", tt.quantile, tt.expect, got)
+		}
+	}
+	if got := histogramQuantile(&metrics.Float64Histogram{Counts: []uint64{0}, Buckets: []float64{0, 1}}, 0.5); got != 0 {
+		t.Errorf("expecting 0 for empty histogram but got %v", got)
+	}
+}
+
+func TestRunnerMetrics(t *testing.T) {
+	t.Parallel()
+
+	reader := metricsdk.NewManualReader()
+	provider := metricsdk.NewMeterProvider(metricsdk.WithReader(reader))
+	r := New(Config{
+		Name:             "testing_runner_metrics",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second,
+	})
+	var err error
+	r.metrics, err = newRunnerMetrics(provider.Meter("testing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Run(func(ctx context.Context, runner ServiceRunner) error {
+		return Serve("metric-task", runner, func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			return nil
+		})
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+
+	collected := collectMetrics(t, reader)
+	transitions, ok := collected["srun.service.state.transitions"].Data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatal("expecting state transitions to be collected")
+	}
+	var states []string
+	for _, dp := range transitions.DataPoints {
+		if name, _ := dp.Attributes.Value(attribute.Key("service_name")); name.AsString() != "metric-task" {
+			continue
+		}
+		state, _ := dp.Attributes.Value(attribute.Key("state"))
+		states = append(states, state.AsString())
+	}
+	for _, state := range []serviceState{serviceStateStarting, serviceStateRunning, serviceStateShutdown, serviceStateStopped} {
+		if !slices.Contains(states, state.String()) {
+			t.Errorf("expecting state transition to %s to be recorded, got %v", state, states)
+		}
+	}
+
+	for _, name := range []string{
+		"srun.service.init.duration",
+		"srun.service.ready.duration",
+		"srun.service.stop.duration",
+		"srun.shutdown.duration",
+	} {
+		histogram, ok := collected[name].Data.(metricdata.Histogram[float64])
+		if !ok || len(histogram.DataPoints) == 0 || histogram.DataPoints[0].Count == 0 {
+			t.Errorf("expecting %s to be recorded", name)
+		}
+	}
+}
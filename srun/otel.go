@@ -2,37 +2,227 @@ package srun
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/metric"
 	meternoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
 	metricsdk "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// OTelTraceExporter is the exporter used to export the trace spans.
+type OTelTraceExporter string
+
+const (
+	// OTelTraceExporterStdout exports the trace spans to the stdout with pretty print. The exporter is useful for local development.
+	OTelTraceExporterStdout OTelTraceExporter = "stdout"
+	// OTelTraceExporterOTLPGRPC exports the trace spans to the OTLP collector via gRPC.
+	OTelTraceExporterOTLPGRPC OTelTraceExporter = "otlp-grpc"
+	// OTelTraceExporterOTLPHTTP exports the trace spans to the OTLP collector via HTTP with protobuf encoding.
+	OTelTraceExporterOTLPHTTP OTelTraceExporter = "otlp-http"
+	// OTelTraceExporterNone doesn't export the trace spans. The spans are still created, so the trace context can still be
+	// propagated to other services.
+	OTelTraceExporterNone OTelTraceExporter = "none"
+)
+
+// OTelSamplerType is the type of the trace sampler. The values are the same with the values of OTEL_TRACES_SAMPLER environment
+// variable.
+type OTelSamplerType string
+
+const (
+	OTelSamplerAlwaysOn                OTelSamplerType = "always_on"
+	OTelSamplerAlwaysOff               OTelSamplerType = "always_off"
+	OTelSamplerTraceIDRatio            OTelSamplerType = "traceidratio"
+	OTelSamplerParentBasedAlwaysOn     OTelSamplerType = "parentbased_always_on"
+	OTelSamplerParentBasedAlwaysOff    OTelSamplerType = "parentbased_always_off"
+	OTelSamplerParentBasedTraceIDRatio OTelSamplerType = "parentbased_traceidratio"
 )
 
 type OTelTracerConfig struct {
-	Disable bool
+	Disable bool `yaml:"disable"`
+	// Exporter is the exporter of the trace spans. If the exporter is empty, the exporter is decided by OTEL_TRACES_EXPORTER
+	// and OTEL_EXPORTER_OTLP_PROTOCOL environment variables. The stdout exporter is used if none of them is set.
+	Exporter OTelTraceExporter `yaml:"exporter"`
+	// OTLP is the configuration for OTLP exporters.
+	OTLP OTLPExporterConfig `yaml:"otlp"`
+	// Sampler is the configuration of the trace sampler.
+	Sampler OTelSamplerConfig `yaml:"sampler"`
 	// Below is a private configuration passed from the srun itself to provide several information
 	// for the open-telemetry.
 	serviceName    string
 	serviceVersion string
 }
 
+// OTLPExporterConfig is the configuration for OTLP exporters. The configuration that is not set falls back to the standard
+// OTEL_EXPORTER_OTLP_* environment variables, for example OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_HEADERS.
+type OTLPExporterConfig struct {
+	// Endpoint is the address of the collector. The endpoint can be a host and port like localhost:4317, or a full URL
+	// like https://localhost:4318/v1/traces.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure disables the transport security of the exporter.
+	Insecure bool `yaml:"insecure"`
+	// TLSConfig is the TLS configuration of the exporter. The configuration is ignored if Insecure is true.
+	TLSConfig *tls.Config `yaml:"-"`
+	// Headers is the additional headers or gRPC metadata sent with each export request.
+	Headers map[string]string `yaml:"headers"`
+	// Compression is the compression of the export request, the supported values are "gzip" and "none".
+	Compression string `yaml:"compression"`
+	// Timeout is the timeout of each export request.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c OTLPExporterConfig) validate() error {
+	switch c.Compression {
+	case "", "gzip", "none":
+	default:
+		return fmt.Errorf("otlp: unsupported compression %q", c.Compression)
+	}
+	return nil
+}
+
+// OTelSamplerConfig is the configuration of the trace sampler. If the type is empty, the sampler is decided by OTEL_TRACES_SAMPLER
+// and OTEL_TRACES_SAMPLER_ARG environment variables. The parentbased_always_on sampler is used if none of them is set.
+type OTelSamplerConfig struct {
+	Type OTelSamplerType `yaml:"type"`
+	// Ratio is the ratio of the sampled traces for traceidratio and parentbased_traceidratio sampler. The ratio must be
+	// between 0 and 1.
+	Ratio float64 `yaml:"ratio"`
+}
+
+func (c OTelSamplerConfig) sampler() (tracesdk.Sampler, error) {
+	if c.Ratio < 0 || c.Ratio > 1 {
+		return nil, fmt.Errorf("sampler: ratio must be between 0 and 1, got %v", c.Ratio)
+	}
+	switch c.Type {
+	case OTelSamplerAlwaysOn:
+		return tracesdk.AlwaysSample(), nil
+	case OTelSamplerAlwaysOff:
+		return tracesdk.NeverSample(), nil
+	case OTelSamplerTraceIDRatio:
+		return tracesdk.TraceIDRatioBased(c.Ratio), nil
+	case "", OTelSamplerParentBasedAlwaysOn:
+		return tracesdk.ParentBased(tracesdk.AlwaysSample()), nil
+	case OTelSamplerParentBasedAlwaysOff:
+		return tracesdk.ParentBased(tracesdk.NeverSample()), nil
+	case OTelSamplerParentBasedTraceIDRatio:
+		return tracesdk.ParentBased(tracesdk.TraceIDRatioBased(c.Ratio)), nil
+	default:
+		return nil, fmt.Errorf("sampler: unsupported sampler type %q", c.Type)
+	}
+}
+
+// loadEnv loads the configuration that is not set from the standard OTEL_* environment variables.
+func (c *OTelTracerConfig) loadEnv(getenv func(string) string) error {
+	if c.Exporter == "" {
+		switch exporter := getenv("OTEL_TRACES_EXPORTER"); exporter {
+		case "", "console":
+			c.Exporter = OTelTraceExporterStdout
+		case "none":
+			c.Exporter = OTelTraceExporterNone
+		case "otlp":
+			protocol := getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+			if protocol == "" {
+				protocol = getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+			}
+			switch protocol {
+			// The default protocol of the specification is http/protobuf.
+			case "", "http/protobuf":
+				c.Exporter = OTelTraceExporterOTLPHTTP
+			case "grpc":
+				c.Exporter = OTelTraceExporterOTLPGRPC
+			default:
+				return fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL: unsupported protocol %q", protocol)
+			}
+		default:
+			return fmt.Errorf("OTEL_TRACES_EXPORTER: unsupported exporter %q", exporter)
+		}
+	}
+	if c.Sampler.Type == "" {
+		c.Sampler.Type = OTelSamplerType(getenv("OTEL_TRACES_SAMPLER"))
+		if arg := getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+			ratio, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("OTEL_TRACES_SAMPLER_ARG: %w", err)
+			}
+			c.Sampler.Ratio = ratio
+		}
+	}
+	return nil
+}
+
 // newOTelTracerService returns a function to trigger and starts open telemetry processes. The function returns a function to allow us to use
 // the LongRunningTask so we can listen to the exit signal.
-func newOTelTracerService(config OTelTracerConfig) (trace.Tracer, *LongRunningTask, error) {
+func newOTelTracerService(config OTelTracerConfig, shutdownTimeout time.Duration) (trace.Tracer, trace.TracerProvider, *LongRunningTask, error) {
 	if config.Disable {
-		return tracenoop.NewTracerProvider().Tracer("noop"), nil, nil
+		provider := tracenoop.NewTracerProvider()
+		return provider.Tracer("noop"), provider, nil, nil
+	}
+	provider, err := newOTelTracerProvider(context.Background(), config, os.Getenv)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tracer := provider.Tracer(config.serviceName)
+
+	fn := func(ctx Context) error {
+		// Wait until the context is cancalled to shutdown the provider.
+		<-ctx.Ctx.Done()
+
+		// The provider is stopped in the telemetry phase, so use the timeout of the phase as the flush window.
+		ctxTimeout, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		// Forcefully flush all registered spans before shutdown to ensure we are sending all traces.
+		if err := provider.ForceFlush(ctxTimeout); err != nil {
+			ctx.Logger.Error(
+				"failed to flush otel-traces",
+				slog.String("error", err.Error()),
+			)
+		}
+		return provider.Shutdown(ctxTimeout)
+	}
+	task, err := NewLongRunningTask("otel-tracer-listener", fn)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	// Stop the provider in the telemetry phase so the spans from the shutdown process are flushed.
+	task.SetShutdownPhase(ShutdownPhaseTelemetry)
+	return tracer, provider, task, nil
+}
 
+// newOTelTracerProvider creates the tracer provider with the exporter and sampler from the configuration.
+func newOTelTracerProvider(ctx context.Context, config OTelTracerConfig, getenv func(string) string) (*tracesdk.TracerProvider, error) {
+	if err := config.loadEnv(getenv); err != nil {
+		return nil, err
+	}
+	if err := config.OTLP.validate(); err != nil {
+		return nil, err
+	}
+	sampler, err := config.Sampler.sampler()
+	if err != nil {
+		return nil, err
+	}
 	res, err := resource.Merge(
 		resource.Default(),
 		resource.NewWithAttributes(
@@ -42,70 +232,216 @@ func newOTelTracerService(config OTelTracerConfig) (trace.Tracer, *LongRunningTa
 		),
 	)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+	opts := []tracesdk.TracerProviderOption{
+		tracesdk.WithResource(res),
+		tracesdk.WithSampler(sampler),
+	}
+	exporter, err := newOTelTraceExporter(ctx, config)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-
-	provider := tracesdk.NewTracerProvider(
-		tracesdk.WithBatcher(
+	// The exporter is nil when the exporter is none, so the spans are not exported anywhere.
+	if exporter != nil {
+		opts = append(opts, tracesdk.WithBatcher(
 			exporter,
 			// The default timeout is 5s, but we want to be explicit about it.
 			tracesdk.WithBatchTimeout(time.Second*5),
-		),
-		tracesdk.WithResource(res),
-	)
-	tracer := provider.Tracer(config.serviceName)
+		))
+	}
+	return tracesdk.NewTracerProvider(opts...), nil
+}
 
-	fn := func(ctx Context) error {
-		// Wait until the context is cancalled to shutdown the provider.
-		<-ctx.Ctx.Done()
+// newOTelTraceExporter creates the trace exporter based on the configuration.
+func newOTelTraceExporter(ctx context.Context, config OTelTracerConfig) (tracesdk.SpanExporter, error) {
+	switch config.Exporter {
+	case OTelTraceExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case OTelTraceExporterNone:
+		return nil, nil
+	case OTelTraceExporterOTLPGRPC:
+		return otlptracegrpc.New(ctx, otlpTraceGRPCOptions(config.OTLP)...)
+	case OTelTraceExporterOTLPHTTP:
+		return otlptracehttp.New(ctx, otlpTraceHTTPOptions(config.OTLP)...)
+	default:
+		return nil, fmt.Errorf("otel: unsupported trace exporter %q", config.Exporter)
+	}
+}
 
-		ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Second*30)
-		defer cancel()
-		// Forcefully flush all registered spans before shutdown to ensure we are sending all traces.
-		if err := provider.ForceFlush(ctxTimeout); err != nil {
-			ctx.Logger.Error(
-				"failed to flush otel-traces",
-				slog.String("error", err.Error()),
-			)
+func otlpTraceGRPCOptions(config OTLPExporterConfig) []otlptracegrpc.Option {
+	var opts []otlptracegrpc.Option
+	if config.Endpoint != "" {
+		if strings.Contains(config.Endpoint, "://") {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(config.Endpoint))
+		} else {
+			opts = append(opts, otlptracegrpc.WithEndpoint(config.Endpoint))
 		}
-		return provider.Shutdown(ctxTimeout)
 	}
-	task, err := NewLongRunningTask("otel-tracer-listener", fn)
-	if err != nil {
-		return nil, nil, err
+	if config.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	} else if config.TLSConfig != nil {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(config.TLSConfig)))
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(config.Headers))
 	}
-	return tracer, task, nil
+	// The gRPC exporter doesn't compress the request by default, so we only need to set the compressor for gzip.
+	if config.Compression == "gzip" {
+		opts = append(opts, otlptracegrpc.WithCompressor(gzip.Name))
+	}
+	if config.Timeout > 0 {
+		opts = append(opts, otlptracegrpc.WithTimeout(config.Timeout))
+	}
+	return opts
+}
+
+func otlpTraceHTTPOptions(config OTLPExporterConfig) []otlptracehttp.Option {
+	var opts []otlptracehttp.Option
+	if config.Endpoint != "" {
+		if strings.Contains(config.Endpoint, "://") {
+			opts = append(opts, otlptracehttp.WithEndpointURL(config.Endpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+	}
+	if config.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	} else if config.TLSConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(config.TLSConfig))
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(config.Headers))
+	}
+	switch config.Compression {
+	case "gzip":
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	case "none":
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.NoCompression))
+	}
+	if config.Timeout > 0 {
+		opts = append(opts, otlptracehttp.WithTimeout(config.Timeout))
+	}
+	return opts
 }
 
+// OtelMetricExporter is the exporter used to export the metrics.
+type OtelMetricExporter string
+
+const (
+	// OtelMetricExporterPrometheus exposes the metrics via /metrics endpoint in the admin server. The metrics are pulled
+	// by the prometheus server.
+	OtelMetricExporterPrometheus OtelMetricExporter = "prometheus"
+	// OtelMetricExporterOTLPGRPC pushes the metrics periodically to the OTLP collector via gRPC.
+	OtelMetricExporterOTLPGRPC OtelMetricExporter = "otlp-grpc"
+	// OtelMetricExporterOTLPHTTP pushes the metrics periodically to the OTLP collector via HTTP with protobuf encoding.
+	OtelMetricExporterOTLPHTTP OtelMetricExporter = "otlp-http"
+	// OtelMetricExporterNone doesn't export the metrics.
+	OtelMetricExporterNone OtelMetricExporter = "none"
+)
+
 type OtelMetricConfig struct {
 	// Disable disables metrics collection via otel/noop package that essentially doing nothing.
-	Disable bool
+	Disable bool `yaml:"disable"`
 	// MeterName is the name of metric meter for otel meter provider.
-	MeterName string
+	MeterName string `yaml:"meter-name"`
+	// Exporters is the list of the metric exporters, the exporters can be combined so the metrics are pulled by prometheus
+	// and pushed to the OTLP collector at the same time. If the exporters are empty, the exporters are decided by
+	// OTEL_METRICS_EXPORTER and OTEL_EXPORTER_OTLP_PROTOCOL environment variables. The prometheus exporter is used if none
+	// of them is set.
+	Exporters []OtelMetricExporter `yaml:"exporters"`
+	// OTLP is the configuration for OTLP exporters.
+	OTLP OTLPExporterConfig `yaml:"otlp"`
+	// ExportInterval is the interval of pushing the metrics to the OTLP collector. The interval falls back to
+	// OTEL_METRIC_EXPORT_INTERVAL environment variable, and the default interval is one minute.
+	ExportInterval time.Duration `yaml:"export-interval"`
+	// ExportTimeout is the timeout of pushing the metrics to the OTLP collector. The timeout falls back to
+	// OTEL_METRIC_EXPORT_TIMEOUT environment variable, and the default timeout is 30 seconds.
+	ExportTimeout time.Duration `yaml:"export-timeout"`
+	// HistogramViews overrides the bucket boundaries of the histogram instruments.
+	HistogramViews []OtelHistogramView `yaml:"histogram-views"`
+	// DisableRuntimeMetrics disables the Go runtime and process metrics that are reported by the runner.
+	DisableRuntimeMetrics bool `yaml:"disable-runtime-metrics"`
 	// Below is a private configuration passed from the srun itself to provide several information
 	// for the open-telemetry.
 	serviceName    string
 	serviceVersion string
 }
 
+// OtelHistogramView overrides the bucket boundaries of histogram instruments that match the instrument name.
+type OtelHistogramView struct {
+	// InstrumentName is the name of the histogram instrument. The name supports '*' to match zero or more characters and '?'
+	// to match exactly one character.
+	InstrumentName string `yaml:"instrument-name"`
+	// Boundaries is the bucket boundaries of the histogram in increasing order.
+	Boundaries []float64 `yaml:"boundaries"`
+}
+
+func (v OtelHistogramView) validate() error {
+	if v.InstrumentName == "" {
+		return errors.New("histogram view: instrument name cannot be empty")
+	}
+	if !slices.IsSorted(v.Boundaries) {
+		return fmt.Errorf("histogram view %s: boundaries must be in increasing order", v.InstrumentName)
+	}
+	return nil
+}
+
+// loadEnv loads the configuration that is not set from the standard OTEL_* environment variables.
+func (c *OtelMetricConfig) loadEnv(getenv func(string) string) error {
+	if len(c.Exporters) > 0 {
+		return nil
+	}
+	exporters := getenv("OTEL_METRICS_EXPORTER")
+	if exporters == "" {
+		c.Exporters = []OtelMetricExporter{OtelMetricExporterPrometheus}
+		return nil
+	}
+	for _, exporter := range strings.Split(exporters, ",") {
+		switch exporter = strings.TrimSpace(exporter); exporter {
+		case "prometheus":
+			c.Exporters = append(c.Exporters, OtelMetricExporterPrometheus)
+		case "none":
+			c.Exporters = append(c.Exporters, OtelMetricExporterNone)
+		case "otlp":
+			protocol := getenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL")
+			if protocol == "" {
+				protocol = getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+			}
+			switch protocol {
+			// The default protocol of the specification is http/protobuf.
+			case "", "http/protobuf":
+				c.Exporters = append(c.Exporters, OtelMetricExporterOTLPHTTP)
+			case "grpc":
+				c.Exporters = append(c.Exporters, OtelMetricExporterOTLPGRPC)
+			default:
+				return fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL: unsupported protocol %q", protocol)
+			}
+		default:
+			return fmt.Errorf("OTEL_METRICS_EXPORTER: unsupported exporter %q", exporter)
+		}
+	}
+	return nil
+}
+
+// prometheusEnabled returns whether the prometheus exporter is used. The function must be called after the environment
+// variables are loaded.
+func (c OtelMetricConfig) prometheusEnabled() bool {
+	return !c.Disable && slices.Contains(c.Exporters, OtelMetricExporterPrometheus)
+}
+
 // newOtelMetricsMeterAndProviderService returns open telemetry meter and provider so we can use them inside the runner and inject it to the Context.
 // The function returns otel provider as LongRunningTask as we need to shut it down when the program stops to properly flush all metrics.
-func newOtelMetricMeterAndProviderService(config OtelMetricConfig) (metric.Meter, *LongRunningTask, error) {
+func newOtelMetricMeterAndProviderService(config OtelMetricConfig, shutdownTimeout time.Duration) (metric.Meter, metric.MeterProvider, *LongRunningTask, error) {
 	if config.Disable {
-		return meternoop.NewMeterProvider().Meter("noop"), nil, nil
+		provider := meternoop.NewMeterProvider()
+		return provider.Meter("noop"), provider, nil, nil
 	}
-	promExporter, err := prometheus.New()
+	provider, err := newOtelMeterProvider(context.Background(), config, os.Getenv)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	provider := metricsdk.NewMeterProvider(
-		metricsdk.WithReader(promExporter),
-	)
 	meter := provider.Meter(
 		config.MeterName,
 		metric.WithInstrumentationVersion(config.serviceVersion),
@@ -119,7 +455,8 @@ func newOtelMetricMeterAndProviderService(config OtelMetricConfig) (metric.Meter
 		// Wait until the context is cancalled to shutdown the provider.
 		<-ctx.Ctx.Done()
 
-		ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		// The provider is stopped in the telemetry phase, so use the timeout of the phase as the flush window.
+		ctxTimeout, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 		// Forcefully flush all pending telemetry before shutdown to ensure we are sending all telemetries.
 		if err := provider.ForceFlush(ctxTimeout); err != nil {
@@ -131,7 +468,171 @@ func newOtelMetricMeterAndProviderService(config OtelMetricConfig) (metric.Meter
 		return provider.Shutdown(ctxTimeout)
 	})
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	providerTask.SetShutdownPhase(ShutdownPhaseTelemetry)
+	return meter, provider, providerTask, nil
+}
+
+// newOtelMeterProvider creates the meter provider with the readers and views from the configuration.
+func newOtelMeterProvider(ctx context.Context, config OtelMetricConfig, getenv func(string) string) (*metricsdk.MeterProvider, error) {
+	if err := config.loadEnv(getenv); err != nil {
+		return nil, err
+	}
+	if err := config.OTLP.validate(); err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(config.serviceName),
+			semconv.ServiceVersion(config.serviceVersion),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []metricsdk.Option{metricsdk.WithResource(res)}
+	for _, exporter := range config.Exporters {
+		var reader metricsdk.Reader
+		switch exporter {
+		case OtelMetricExporterPrometheus:
+			reader, err = prometheus.New()
+		case OtelMetricExporterOTLPGRPC:
+			var otlpExporter *otlpmetricgrpc.Exporter
+			otlpExporter, err = otlpmetricgrpc.New(ctx, otlpMetricGRPCOptions(config.OTLP)...)
+			if err == nil {
+				reader = newOtelPeriodicReader(otlpExporter, config)
+			}
+		case OtelMetricExporterOTLPHTTP:
+			var otlpExporter *otlpmetrichttp.Exporter
+			otlpExporter, err = otlpmetrichttp.New(ctx, otlpMetricHTTPOptions(config.OTLP)...)
+			if err == nil {
+				reader = newOtelPeriodicReader(otlpExporter, config)
+			}
+		case OtelMetricExporterNone:
+			continue
+		default:
+			return nil, fmt.Errorf("otel: unsupported metric exporter %q", exporter)
+		}
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, metricsdk.WithReader(reader))
+	}
+	for _, view := range config.HistogramViews {
+		if err := view.validate(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, metricsdk.WithView(metricsdk.NewView(
+			metricsdk.Instrument{
+				Name: view.InstrumentName,
+				Kind: metricsdk.InstrumentKindHistogram,
+			},
+			metricsdk.Stream{
+				Aggregation: metricsdk.AggregationExplicitBucketHistogram{
+					Boundaries: view.Boundaries,
+				},
+			},
+		)))
+	}
+	return metricsdk.NewMeterProvider(opts...), nil
+}
+
+// newOtelPeriodicReader creates a periodic reader to push the metrics. The reader reads OTEL_METRIC_EXPORT_INTERVAL and
+// OTEL_METRIC_EXPORT_TIMEOUT environment variables if the interval and timeout are not set.
+func newOtelPeriodicReader(exporter metricsdk.Exporter, config OtelMetricConfig) metricsdk.Reader {
+	var opts []metricsdk.PeriodicReaderOption
+	if config.ExportInterval > 0 {
+		opts = append(opts, metricsdk.WithInterval(config.ExportInterval))
+	}
+	if config.ExportTimeout > 0 {
+		opts = append(opts, metricsdk.WithTimeout(config.ExportTimeout))
+	}
+	return metricsdk.NewPeriodicReader(exporter, opts...)
+}
+
+func otlpMetricGRPCOptions(config OTLPExporterConfig) []otlpmetricgrpc.Option {
+	var opts []otlpmetricgrpc.Option
+	if config.Endpoint != "" {
+		if strings.Contains(config.Endpoint, "://") {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(config.Endpoint))
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(config.Endpoint))
+		}
 	}
-	return meter, providerTask, nil
+	if config.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	} else if config.TLSConfig != nil {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(config.TLSConfig)))
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, otlpmetricgrpc.WithHeaders(config.Headers))
+	}
+	// The gRPC exporter doesn't compress the request by default, so we only need to set the compressor for gzip.
+	if config.Compression == "gzip" {
+		opts = append(opts, otlpmetricgrpc.WithCompressor(gzip.Name))
+	}
+	if config.Timeout > 0 {
+		opts = append(opts, otlpmetricgrpc.WithTimeout(config.Timeout))
+	}
+	return opts
+}
+
+func otlpMetricHTTPOptions(config OTLPExporterConfig) []otlpmetrichttp.Option {
+	var opts []otlpmetrichttp.Option
+	if config.Endpoint != "" {
+		if strings.Contains(config.Endpoint, "://") {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(config.Endpoint))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(config.Endpoint))
+		}
+	}
+	if config.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	} else if config.TLSConfig != nil {
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(config.TLSConfig))
+	}
+	if len(config.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(config.Headers))
+	}
+	switch config.Compression {
+	case "gzip":
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+	case "none":
+		opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.NoCompression))
+	}
+	if config.Timeout > 0 {
+		opts = append(opts, otlpmetrichttp.WithTimeout(config.Timeout))
+	}
+	return opts
+}
+
+// flushOtelMetric flushes the pending metrics before the runner exits. The meter provider is flushed when the otel-metric-provider
+// service is stopped, but the service is not stopped if the runner exits before the service is started. So we need to flush
+// the provider again to ensure the metrics from short-lived program are always pushed.
+func (r *Runner) flushOtelMetric() {
+	provider, ok := r.otelMeterProvider.(*metricsdk.MeterProvider)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout.TelemetryShutdownTimeout)
+	defer cancel()
+	// The provider returns ErrReaderShutdown if the provider is already flushed and shut down by the service.
+	if err := provider.ForceFlush(ctx); err != nil && !errors.Is(err, metricsdk.ErrReaderShutdown) {
+		r.logger.Error("failed to flush otel-metrics", slog.String("error", err.Error()))
+	}
+}
+
+// registerOtelGlobal registers the providers of the runner as the global open telemetry providers, and sets the W3C trace context
+// and baggage as the global propagator.
+func registerOtelGlobal(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) {
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
 }
@@ -1,13 +1,30 @@
 package srun
 
 import (
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/trace"
 	nooptrace "go.opentelemetry.io/otel/trace/noop"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestOtelTracer(t *testing.T) {
@@ -41,7 +58,7 @@ func TestOtelTracer(t *testing.T) {
 		tt := test
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			tracer, task, err := newOTelTracerService(tt.config)
+			tracer, _, task, err := newOTelTracerService(tt.config, telemetryShutdownDefaultTimeout)
 			if err != tt.err {
 				t.Fatalf("expecting error %v but got %v", tt.err, err)
 			}
@@ -98,7 +115,7 @@ func TestOtelMeter(t *testing.T) {
 		tt := test
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			tracer, task, err := newOtelMetricMeterAndProviderService(tt.config)
+			tracer, _, task, err := newOtelMetricMeterAndProviderService(tt.config, telemetryShutdownDefaultTimeout)
 			if err != tt.err {
 				t.Fatalf("expecting error %v but got %v", tt.err, err)
 			}
@@ -123,3 +140,538 @@ func TestOtelMeter(t *testing.T) {
 		})
 	}
 }
+
+func TestOTelTracerConfigLoadEnv(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		config OTelTracerConfig
+		env    map[string]string
+		expect OTelTracerConfig
+		err    bool
+	}{
+		{
+			name:   "default",
+			expect: OTelTracerConfig{Exporter: OTelTraceExporterStdout},
+		},
+		{
+			name: "otlp default protocol",
+			env:  map[string]string{"OTEL_TRACES_EXPORTER": "otlp"},
+			expect: OTelTracerConfig{
+				Exporter: OTelTraceExporterOTLPHTTP,
+			},
+		},
+		{
+			name: "otlp grpc with sampler",
+			env: map[string]string{
+				"OTEL_TRACES_EXPORTER":        "otlp",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc",
+				"OTEL_TRACES_SAMPLER":         "parentbased_traceidratio",
+				"OTEL_TRACES_SAMPLER_ARG":     "0.25",
+			},
+			expect: OTelTracerConfig{
+				Exporter: OTelTraceExporterOTLPGRPC,
+				Sampler: OTelSamplerConfig{
+					Type:  OTelSamplerParentBasedTraceIDRatio,
+					Ratio: 0.25,
+				},
+			},
+		},
+		{
+			name: "traces protocol takes precedence",
+			env: map[string]string{
+				"OTEL_TRACES_EXPORTER":               "otlp",
+				"OTEL_EXPORTER_OTLP_PROTOCOL":        "http/protobuf",
+				"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "grpc",
+			},
+			expect: OTelTracerConfig{Exporter: OTelTraceExporterOTLPGRPC},
+		},
+		{
+			name: "config takes precedence",
+			config: OTelTracerConfig{
+				Exporter: OTelTraceExporterNone,
+				Sampler:  OTelSamplerConfig{Type: OTelSamplerAlwaysOff},
+			},
+			env: map[string]string{
+				"OTEL_TRACES_EXPORTER":    "otlp",
+				"OTEL_TRACES_SAMPLER":     "traceidratio",
+				"OTEL_TRACES_SAMPLER_ARG": "0.5",
+			},
+			expect: OTelTracerConfig{
+				Exporter: OTelTraceExporterNone,
+				Sampler:  OTelSamplerConfig{Type: OTelSamplerAlwaysOff},
+			},
+		},
+		{
+			name: "unsupported exporter",
+			env:  map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"},
+			err:  true,
+		},
+		{
+			name: "invalid sampler arg",
+			env:  map[string]string{"OTEL_TRACES_SAMPLER_ARG": "half"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			config := tt.config
+			err := config.loadEnv(func(key string) string {
+				return tt.env[key]
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("expecting error %v but got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if config.Exporter != tt.expect.Exporter || config.Sampler != tt.expect.Sampler {
+				t.Fatalf("expecting config %+v but got %+v", tt.expect, config)
+			}
+		})
+	}
+}
+
+func TestOTelSampler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		config      OTelSamplerConfig
+		description string
+		err         bool
+	}{
+		{
+			name:        "default",
+			description: "ParentBased{root:AlwaysOnSampler,remoteParentSampled:AlwaysOnSampler,remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,localParentNotSampled:AlwaysOffSampler}",
+		},
+		{
+			name:        "always off",
+			config:      OTelSamplerConfig{Type: OTelSamplerAlwaysOff},
+			description: "AlwaysOffSampler",
+		},
+		{
+			name:        "ratio",
+			config:      OTelSamplerConfig{Type: OTelSamplerTraceIDRatio, Ratio: 0.5},
+			description: "TraceIDRatioBased{0.5}",
+		},
+		{
+			name:   "invalid ratio",
+			config: OTelSamplerConfig{Type: OTelSamplerTraceIDRatio, Ratio: 2},
+			err:    true,
+		},
+		{
+			name:   "unsupported type",
+			config: OTelSamplerConfig{Type: "jaeger_remote"},
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sampler, err := tt.config.sampler()
+			if (err != nil) != tt.err {
+				t.Fatalf("expecting error %v but got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if sampler.Description() != tt.description {
+				t.Fatalf("expecting sampler %s but got %s", tt.description, sampler.Description())
+			}
+		})
+	}
+}
+
+// otlpTraceRequest is the trace export request received by the OTLP collector stand-in.
+type otlpTraceRequest struct {
+	header    string
+	spanNames []string
+}
+
+func newOTLPTraceRequest(header string, req *coltracepb.ExportTraceServiceRequest) otlpTraceRequest {
+	r := otlpTraceRequest{header: header}
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				r.spanNames = append(r.spanNames, span.GetName())
+			}
+		}
+	}
+	return r
+}
+
+// otlpTraceGRPCCollector is an in-process OTLP gRPC collector stand-in.
+type otlpTraceGRPCCollector struct {
+	coltracepb.UnimplementedTraceServiceServer
+	requestC chan otlpTraceRequest
+}
+
+func (c *otlpTraceGRPCCollector) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.requestC <- newOTLPTraceRequest(strings.Join(md.Get("x-test-header"), ","), req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func TestOTLPTraceExporter(t *testing.T) {
+	t.Parallel()
+
+	exportSpan := func(t *testing.T, config OTelTracerConfig) {
+		t.Helper()
+		provider, err := newOTelTracerProvider(context.Background(), config, func(string) string { return "" })
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, span := provider.Tracer("testing").Start(context.Background(), "testing-span")
+		span.End()
+		// Shutdown flushes all the spans to the collector.
+		if err := provider.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectRequest := func(t *testing.T, requestC chan otlpTraceRequest) {
+		t.Helper()
+		select {
+		case req := <-requestC:
+			expect := otlpTraceRequest{header: "testing", spanNames: []string{"testing-span"}}
+			if diff := cmp.Diff(expect, req, cmp.AllowUnexported(otlpTraceRequest{})); diff != "" {
+				t.Fatalf("(-want/+got)\n%s", diff)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("expecting the collector to receive the spans")
+		}
+	}
+
+	t.Run("http", func(t *testing.T) {
+		t.Parallel()
+
+		requestC := make(chan otlpTraceRequest, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/traces" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var body io.Reader = r.Body
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				gr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				defer gr.Close()
+				body = gr
+			}
+			out, err := io.ReadAll(body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			req := &coltracepb.ExportTraceServiceRequest{}
+			if err := proto.Unmarshal(out, req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			requestC <- newOTLPTraceRequest(r.Header.Get("X-Test-Header"), req)
+
+			resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.Write(resp)
+		}))
+		defer server.Close()
+
+		exportSpan(t, OTelTracerConfig{
+			Exporter: OTelTraceExporterOTLPHTTP,
+			OTLP: OTLPExporterConfig{
+				Endpoint:    server.URL + "/v1/traces",
+				Headers:     map[string]string{"X-Test-Header": "testing"},
+				Compression: "gzip",
+			},
+		})
+		expectRequest(t, requestC)
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		collector := &otlpTraceGRPCCollector{requestC: make(chan otlpTraceRequest, 1)}
+		server := grpc.NewServer()
+		coltracepb.RegisterTraceServiceServer(server, collector)
+		go server.Serve(listener)
+		defer server.Stop()
+
+		exportSpan(t, OTelTracerConfig{
+			Exporter: OTelTraceExporterOTLPGRPC,
+			OTLP: OTLPExporterConfig{
+				Endpoint:    listener.Addr().String(),
+				Insecure:    true,
+				Headers:     map[string]string{"x-test-header": "testing"},
+				Compression: "gzip",
+			},
+		})
+		expectRequest(t, collector.requestC)
+	})
+}
+
+func TestOtelMetricConfigLoadEnv(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		config    OtelMetricConfig
+		env       map[string]string
+		exporters []OtelMetricExporter
+		err       bool
+	}{
+		{
+			name:      "default",
+			exporters: []OtelMetricExporter{OtelMetricExporterPrometheus},
+		},
+		{
+			name: "prometheus and otlp",
+			env: map[string]string{
+				"OTEL_METRICS_EXPORTER":               "prometheus, otlp",
+				"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL": "grpc",
+			},
+			exporters: []OtelMetricExporter{OtelMetricExporterPrometheus, OtelMetricExporterOTLPGRPC},
+		},
+		{
+			name:      "otlp default protocol",
+			env:       map[string]string{"OTEL_METRICS_EXPORTER": "otlp"},
+			exporters: []OtelMetricExporter{OtelMetricExporterOTLPHTTP},
+		},
+		{
+			name:      "config takes precedence",
+			config:    OtelMetricConfig{Exporters: []OtelMetricExporter{OtelMetricExporterNone}},
+			env:       map[string]string{"OTEL_METRICS_EXPORTER": "otlp"},
+			exporters: []OtelMetricExporter{OtelMetricExporterNone},
+		},
+		{
+			name: "unsupported exporter",
+			env:  map[string]string{"OTEL_METRICS_EXPORTER": "statsd"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			config := tt.config
+			err := config.loadEnv(func(key string) string {
+				return tt.env[key]
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("expecting error %v but got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.exporters, config.Exporters); diff != "" {
+				t.Fatalf("(-want/+got)\n%s", diff)
+			}
+		})
+	}
+}
+
+// otlpMetricRequest is the metric export request received by the OTLP collector stand-in.
+type otlpMetricRequest struct {
+	metricNames     []string
+	histogramBounds map[string][]float64
+}
+
+// newOTLPMetricCollector creates an in-process OTLP HTTP collector stand-in that sends the received metrics to the channel.
+func newOTLPMetricCollector(t *testing.T) (*httptest.Server, chan otlpMetricRequest) {
+	t.Helper()
+
+	requestC := make(chan otlpMetricRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		out, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req := &colmetricpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(out, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		result := otlpMetricRequest{histogramBounds: make(map[string][]float64)}
+		for _, rm := range req.GetResourceMetrics() {
+			for _, sm := range rm.GetScopeMetrics() {
+				for _, m := range sm.GetMetrics() {
+					result.metricNames = append(result.metricNames, m.GetName())
+					for _, dp := range m.GetHistogram().GetDataPoints() {
+						result.histogramBounds[m.GetName()] = dp.GetExplicitBounds()
+					}
+				}
+			}
+		}
+		requestC <- result
+
+		resp, _ := proto.Marshal(&colmetricpb.ExportMetricsServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server, requestC
+}
+
+func TestOTLPMetricExporter(t *testing.T) {
+	t.Parallel()
+
+	server, requestC := newOTLPMetricCollector(t)
+	provider, err := newOtelMeterProvider(context.Background(), OtelMetricConfig{
+		Exporters: []OtelMetricExporter{OtelMetricExporterOTLPHTTP},
+		OTLP: OTLPExporterConfig{
+			Endpoint: server.URL + "/v1/metrics",
+		},
+		// Use a long interval to ensure the metrics are pushed by the shutdown.
+		ExportInterval: time.Hour,
+		HistogramViews: []OtelHistogramView{
+			{InstrumentName: "testing.*", Boundaries: []float64{1, 5, 10}},
+		},
+	}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meter := provider.Meter("testing")
+	counter, err := meter.Int64Counter("testing.counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Add(context.Background(), 1)
+	histogram, err := meter.Float64Histogram("testing.latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	histogram.Record(context.Background(), 3)
+	// Shutdown flushes all the metrics to the collector.
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case req := <-requestC:
+		expect := otlpMetricRequest{
+			metricNames:     []string{"testing.counter", "testing.latency"},
+			histogramBounds: map[string][]float64{"testing.latency": {1, 5, 10}},
+		}
+		if diff := cmp.Diff(expect, req, cmp.AllowUnexported(otlpMetricRequest{})); diff != "" {
+			t.Fatalf("(-want/+got)\n%s", diff)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expecting the collector to receive the metrics")
+	}
+}
+
+func TestOtelHistogramViewValidate(t *testing.T) {
+	t.Parallel()
+
+	_, err := newOtelMeterProvider(context.Background(), OtelMetricConfig{
+		Exporters: []OtelMetricExporter{OtelMetricExporterNone},
+		HistogramViews: []OtelHistogramView{
+			{InstrumentName: "testing.latency", Boundaries: []float64{10, 5, 1}},
+		},
+	}, func(string) string { return "" })
+	if err == nil {
+		t.Fatal("expecting error for unsorted boundaries")
+	}
+}
+
+func TestRunnerFlushOtelMetric(t *testing.T) {
+	t.Parallel()
+
+	server, requestC := newOTLPMetricCollector(t)
+	err := New(Config{
+		Name:       "testing_flush_otel_metric",
+		Admin:      AdminConfig{Disable: true},
+		OtelTracer: OTelTracerConfig{Disable: true},
+		OtelMetric: OtelMetricConfig{
+			Exporters: []OtelMetricExporter{OtelMetricExporterOTLPHTTP},
+			OTLP: OTLPExporterConfig{
+				Endpoint: server.URL + "/v1/metrics",
+			},
+			// Use a long interval as the program exits before the metrics are pushed periodically.
+			ExportInterval: time.Hour,
+		},
+		DeadlineDuration: time.Second,
+	}).Run(func(ctx context.Context, runner ServiceRunner) error {
+		return Serve("flush-metric", runner, func(ctx Context) error {
+			counter, err := ctx.Meter.Int64Counter("testing.jobs")
+			if err != nil {
+				return err
+			}
+			counter.Add(ctx.Ctx, 1)
+			<-ctx.Ctx.Done()
+			return nil
+		})
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+
+	// The metrics must be pushed before Run returns, so the request should be available immediately.
+	select {
+	case req := <-requestC:
+		if !slices.Contains(req.metricNames, "testing.jobs") {
+			t.Fatalf("expecting testing.jobs metric but got %v", req.metricNames)
+		}
+	default:
+		t.Fatal("expecting the metrics to be pushed before Run returns")
+	}
+}
+
+func TestRegisterOtelGlobal(t *testing.T) {
+	var tracerProvider trace.TracerProvider
+	var meterProvider metric.MeterProvider
+
+	err := New(Config{
+		Name:  "testing_register_otel_global",
+		Admin: AdminConfig{Disable: true},
+		OtelTracer: OTelTracerConfig{
+			Exporter: OTelTraceExporterNone,
+		},
+		OtelMetric: OtelMetricConfig{
+			Exporters: []OtelMetricExporter{OtelMetricExporterNone},
+		},
+		RegisterOtelGlobal: true,
+		DeadlineDuration:   time.Second,
+	}).Run(func(ctx context.Context, runner ServiceRunner) error {
+		return Serve("otel-global", runner, func(ctx Context) error {
+			tracerProvider = ctx.TracerProvider
+			meterProvider = ctx.MeterProvider
+			<-ctx.Ctx.Done()
+			return nil
+		})
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+
+	if tracerProvider == nil || meterProvider == nil {
+		t.Fatal("expecting the providers to be available in the service context")
+	}
+	if otel.GetTracerProvider() != tracerProvider {
+		t.Fatal("expecting the tracer provider to be registered globally")
+	}
+	if otel.GetMeterProvider() != meterProvider {
+		t.Fatal("expecting the meter provider to be registered globally")
+	}
+	fields := otel.GetTextMapPropagator().Fields()
+	if !slices.Contains(fields, "traceparent") || !slices.Contains(fields, "baggage") {
+		t.Fatalf("expecting tracecontext and baggage propagator but got fields %v", fields)
+	}
+}
@@ -0,0 +1,124 @@
+package srun
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	probeStatusOK    = "OK"
+	probeStatusNotOK = "NOT_OK"
+)
+
+// ServiceCriticalityAware defines whether a service is critical for the readiness and liveness of the program. By default, all
+// services are critical. A non-critical service is still reported by the admin server, but it doesn't affect the result.
+//
+// For example, a service that sends analytics events in the background might not be critical, as the program can still serve
+// the requests without it.
+type ServiceCriticalityAware interface {
+	Critical() bool
+}
+
+// ProbeReport is the detailed result of the readiness or liveness probe of the program.
+type ProbeReport struct {
+	// Status is either OK or NOT_OK.
+	Status     string           `json:"status"`
+	Components []ProbeComponent `json:"components"`
+}
+
+// OK returns true if the probe status is OK.
+func (p ProbeReport) OK() bool {
+	return p.Status == probeStatusOK
+}
+
+// ProbeComponent is the probe result of each service inside the runner.
+type ProbeComponent struct {
+	Name string `json:"name"`
+	// State is the lifecycle state of the service.
+	State string `json:"state"`
+	// HealthStatus is the last known health status of the service. The status is empty if the service health is not tracked.
+	HealthStatus string `json:"health_status,omitempty"`
+	Critical     bool   `json:"critical"`
+	// Status is either OK or NOT_OK. The status of a non-critical service doesn't affect the status of the probe.
+	Status string `json:"status"`
+}
+
+// readinessReport returns the readiness of the program. The program is ready only after all services passed Ready, and
+// all critical services are still running and not marked as not ready by UnhealthyActionNotReady.
+func (r *Runner) readinessReport() ProbeReport {
+	report := r.probe(func(svc ServiceSnapshot) bool {
+		if svc.UnhealthyNotReady {
+			return false
+		}
+		// A service that exits from Run without error is treated as ready, as the runner allows a service to finish its job
+		// while waiting for other services.
+		return svc.State == serviceStateRunning.String() ||
+			(svc.State == serviceStateRunExited.String() && svc.LastError == "")
+	})
+	if r.readinessGate() != nil {
+		report.Status = probeStatusNotOK
+	}
+	return report
+}
+
+// readinessGate returns an error when the program is not ready regardless of the readiness of the services, for example
+// when the runner is still starting or is draining before the services are stopped, or when a critical service is marked as
+// not ready by UnhealthyActionNotReady.
+func (r *Runner) readinessGate() error {
+	if state := atomic.LoadInt32(&r.state); state != runnerStateRunning {
+		return fmt.Errorf("runner is not running, the runner state is %s", runnerStateToString(state))
+	}
+	r.servicesMu.RLock()
+	defer r.servicesMu.RUnlock()
+	for _, svc := range r.services {
+		if svc.unhealthyNotReady.Load() && svc.critical() {
+			return fmt.Errorf("service %s is not ready because it is unhealthy", svc.Name())
+		}
+	}
+	return nil
+}
+
+// livenessReport returns the liveness of the program. The program is not live if any of the critical services reports
+// unhealthy status.
+func (r *Runner) livenessReport() ProbeReport {
+	unhealthy := HealthStatus(HealthStatusUhealthy).String()
+	return r.probe(func(svc ServiceSnapshot) bool {
+		return svc.HealthStatus != unhealthy
+	})
+}
+
+// probe builds the probe report by checking all services with the check function.
+func (r *Runner) probe(check func(ServiceSnapshot) bool) ProbeReport {
+	r.servicesMu.RLock()
+	services := r.services
+	r.servicesMu.RUnlock()
+
+	report := ProbeReport{Status: probeStatusOK}
+	for _, svc := range services {
+		snapshot := r.snapshot(svc)
+		component := ProbeComponent{
+			Name:         snapshot.Name,
+			State:        snapshot.State,
+			HealthStatus: snapshot.HealthStatus,
+			Critical:     svc.critical(),
+			Status:       probeStatusOK,
+		}
+		if !check(snapshot) {
+			component.Status = probeStatusNotOK
+			if component.Critical {
+				report.Status = probeStatusNotOK
+			}
+		}
+		report.Components = append(report.Components, component)
+	}
+	return report
+}
+
+// critical returns whether the service is critical for the readiness and liveness of the program.
+func (s *ServiceStateTracker) critical() bool {
+	sca, ok := s.ServiceInitAware.(ServiceCriticalityAware)
+	if !ok {
+		return true
+	}
+	return sca.Critical()
+}
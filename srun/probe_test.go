@@ -0,0 +1,133 @@
+package srun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	_ Healthcheck             = (*serviceWithHealth)(nil)
+	_ ServiceCriticalityAware = (*serviceWithHealth)(nil)
+)
+
+// serviceWithHealth is a service that implements Healthcheck and ServiceCriticalityAware to test the probes.
+type serviceWithHealth struct {
+	*serviceDoNothing
+	status      atomic.Int32
+	notCritical bool
+}
+
+func newServiceWithHealth(name string, critical bool) *serviceWithHealth {
+	s := &serviceWithHealth{
+		serviceDoNothing: &serviceDoNothing{
+			name: name,
+			errC: make(chan error, 1),
+			onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
+				<-ctx.Done()
+				return nil
+			},
+		},
+		notCritical: !critical,
+	}
+	s.status.Store(HealthStatusHealthy)
+	return s
+}
+
+func (s *serviceWithHealth) Health(context.Context) (HealthStatus, error) {
+	return HealthStatus(s.status.Load()), nil
+}
+
+func (s *serviceWithHealth) Critical() bool {
+	return !s.notCritical
+}
+
+func TestProbes(t *testing.T) {
+	t.Parallel()
+
+	critical := newServiceWithHealth("critical", true)
+	nonCritical := newServiceWithHealth("non-critical", false)
+
+	r := New(Config{
+		Name: "testing_probes",
+		Admin: AdminConfig{
+			AdminServerConfig: AdminServerConfig{
+				Address: ":8792",
+			},
+		},
+		Healthcheck:      HealthcheckConfig{Enabled: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second * 4,
+	})
+	if r.readinessReport().OK() {
+		t.Fatal("expecting runner to be not ready before run")
+	}
+
+	get := func(path string) (int, ProbeReport, error) {
+		var report ProbeReport
+		resp, err := http.Get("http://localhost:8792" + path)
+		if err != nil {
+			return 0, report, err
+		}
+		defer resp.Body.Close()
+		err = json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, report, err
+	}
+	expectStatus := func(path string, code int) error {
+		got, report, err := get(path)
+		if err != nil {
+			return err
+		}
+		if got != code {
+			return fmt.Errorf("%s: expecting status code %d but got %d with report %+v", path, code, got, report)
+		}
+		return nil
+	}
+	check := func(ctx context.Context, svc ServiceRunnerAware) {
+		r.healthcheckService.check(ctx, svc)
+	}
+
+	errC := make(chan error, 1)
+	err := r.Run(func(ctx context.Context, runner ServiceRunner) error {
+		if err := runner.Register(critical, nonCritical); err != nil {
+			return err
+		}
+		return Serve("probe-task", runner, func(ctx Context) error {
+			time.Sleep(time.Second)
+			errC <- func() error {
+				if err := expectStatus("/ready", http.StatusOK); err != nil {
+					return err
+				}
+				if err := expectStatus("/health", http.StatusOK); err != nil {
+					return err
+				}
+				// Non-critical service should not affect the liveness.
+				nonCritical.status.Store(HealthStatusUhealthy)
+				check(ctx.Ctx, nonCritical)
+				if err := expectStatus("/health", http.StatusOK); err != nil {
+					return err
+				}
+				critical.status.Store(HealthStatusUhealthy)
+				check(ctx.Ctx, critical)
+				return expectStatus("/health", http.StatusServiceUnavailable)
+			}()
+			<-ctx.Ctx.Done()
+			return nil
+		})
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	if r.readinessReport().OK() {
+		t.Fatal("expecting runner to be not ready after run")
+	}
+}
@@ -0,0 +1,252 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	reloadDefaultTimeout       = time.Minute
+	reloadDefaultWatchInterval = time.Second * 5
+)
+
+var (
+	// errReloadDisabled is thrown when the reload is triggered but the configuration loader is not set.
+	errReloadDisabled = errors.New("reload: config reload is disabled")
+	// errReloadNotRunning is thrown when the reload is triggered while the runner is not in the running state.
+	errReloadNotRunning = errors.New("reload: runner is not running")
+	// errReloadRejected is thrown when one of the services rejects the new configuration.
+	errReloadRejected = errors.New("reload: configuration rejected")
+	// errReloadRollback is thrown when one of the services failed to roll back to the previous configuration.
+	errReloadRollback = errors.New("reload: failed to roll back configuration")
+)
+
+// ServiceReloadAware defines a service that can apply a new configuration without being restarted. The services are reloaded
+// in the dependency order, so a service is reloaded after the services it depends on.
+//
+// The config is the application configuration returned by ReloadConfig.Load, so the service needs to assert the type of the
+// configuration. For example:
+//
+//	func (s *HTTPServer) Reload(ctx context.Context, config any) error {
+//		c, ok := config.(*Config)
+//		if !ok {
+//			return fmt.Errorf("unexpected config type %T", config)
+//		}
+//		return s.setTimeout(c.HTTP.Timeout)
+//	}
+//
+// A service that returns an error must keep its current configuration. The runner then rolls back the services that already
+// reloaded by invoking Reload with the previous configuration in the reverse dependency order.
+type ServiceReloadAware interface {
+	Reload(ctx context.Context, config any) error
+}
+
+// ReloadConfig configures the reload of the application configuration. The reload is triggered by the signal, by the changes
+// of the files, or by Runner.Reload. The reload doesn't restart the program, so it is much lighter than the binary upgrade.
+//
+// The runner configuration is not reloaded, only the services that implement ServiceReloadAware are notified.
+type ReloadConfig struct {
+	// Load loads and validates the new application configuration. The reload is disabled if the function is nil.
+	Load func(ctx context.Context) (any, error) `yaml:"-"`
+	// Config is the current application configuration. The configuration is passed to the services when the runner rolls back
+	// a rejected configuration, and it is replaced by the new configuration after each successful reload.
+	Config any `yaml:"-"`
+	// Signal is the signal to trigger the reload. The default signal is SIGUSR2, as SIGHUP is used by the upgrader.
+	Signal os.Signal `yaml:"-"`
+	// Files is the list of files to watch, the reload is triggered when one of the files is modified. The files are
+	// watched by checking their modification time and size periodically.
+	Files []string `yaml:"files"`
+	// WatchInterval is the interval to check the files. By default, the files are checked every 5 seconds.
+	WatchInterval time.Duration `yaml:"watch-interval"`
+	// Timeout is the timeout to load the configuration and reload all the services. By default, the timeout is one minute.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *ReloadConfig) validate() error {
+	if c.Load == nil {
+		return nil
+	}
+	if c.Config == nil {
+		return errors.New("reload: config cannot be nil, the current config is needed to roll back the services")
+	}
+	if c.WatchInterval < 0 || c.Timeout < 0 {
+		return errors.New("reload: watch interval and timeout cannot be negative")
+	}
+	if c.Signal == nil {
+		c.Signal = syscall.SIGUSR2
+	}
+	if c.WatchInterval == 0 {
+		c.WatchInterval = reloadDefaultWatchInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = reloadDefaultTimeout
+	}
+	return nil
+}
+
+// configReloader holds the state of the configuration reload inside the runner.
+type configReloader struct {
+	// mu ensures only one reload is running at a time.
+	mu sync.Mutex
+	// config is the configuration that currently used by the services.
+	config any
+}
+
+// Reload loads the new application configuration with ReloadConfig.Load and notifies the services that implement
+// ServiceReloadAware in the dependency order. If one of the services rejects the configuration, the services that already
+// reloaded are rolled back to the previous configuration and the error is returned.
+//
+// The services are not notified if the new configuration is equal to the current configuration.
+func (r *Runner) Reload(ctx context.Context) (err error) {
+	if r.config.Reload.Load == nil {
+		return errReloadDisabled
+	}
+	r.reloader.mu.Lock()
+	defer r.reloader.mu.Unlock()
+
+	if state := atomic.LoadInt32(&r.state); state != runnerStateRunning {
+		return fmt.Errorf("%w: runner state is %s", errReloadNotRunning, runnerStateToString(state))
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.config.Reload.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := "success"
+	defer func() {
+		if err != nil {
+			result = "failure"
+			r.logger.Error("Failed to reload configuration", slog.String("error", err.Error()))
+		} else {
+			r.logger.Info("Configuration reloaded", slog.String("result", result), slog.Duration("reload_duration", time.Since(start)))
+		}
+		r.metrics.recordReload(result)
+	}()
+
+	newConfig, err := r.config.Reload.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("reload: failed to load configuration: %w", err)
+	}
+	if reflect.DeepEqual(r.reloader.config, newConfig) {
+		result = "unchanged"
+		return nil
+	}
+	if err := r.reloadServices(ctx, r.reloader.config, newConfig); err != nil {
+		return err
+	}
+	r.reloader.config = newConfig
+	return nil
+}
+
+// reloadServices reloads the services with the new configuration, and rolls back the reloaded services to the old configuration
+// if one of the services rejects the new configuration.
+func (r *Runner) reloadServices(ctx context.Context, oldConfig, newConfig any) error {
+	r.servicesMu.RLock()
+	graph, err := newServiceGraph(slices.Clone(r.services), false)
+	r.servicesMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu       sync.Mutex
+		reloaded = make(map[*ServiceStateTracker]bool)
+	)
+	err = graph.walk(ctx, false, true, func(ctx context.Context, svc *ServiceStateTracker) error {
+		reloader, ok := svc.ServiceInitAware.(ServiceReloadAware)
+		if !ok {
+			return nil
+		}
+		if err := reloader.Reload(ctx, newConfig); err != nil {
+			return fmt.Errorf("%w by service %s: %w", errReloadRejected, svc.Name(), err)
+		}
+		mu.Lock()
+		reloaded[svc] = true
+		mu.Unlock()
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	// Roll back with a new timeout as the reload context might be cancelled because the reload timeout is reached.
+	rollbackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.config.Reload.Timeout)
+	defer cancel()
+	rollbackErr := graph.walk(rollbackCtx, true, false, func(ctx context.Context, svc *ServiceStateTracker) error {
+		if !reloaded[svc] {
+			return nil
+		}
+		if err := svc.ServiceInitAware.(ServiceReloadAware).Reload(ctx, oldConfig); err != nil {
+			return fmt.Errorf("%w of service %s: %w", errReloadRollback, svc.Name(), err)
+		}
+		return nil
+	})
+	return errors.Join(err, rollbackErr)
+}
+
+// newConfigReloadService returns a long running task that reloads the configuration when the program receives the reload signal
+// or when the watched files are modified.
+func (r *Runner) newConfigReloadService() (*LongRunningTask, error) {
+	config := r.config.Reload
+	// Check the files when the task is created, so the modification before the task is running is still detected.
+	stats := statFiles(config.Files)
+	fn := func(ctx Context) error {
+		sigC := make(chan os.Signal, 1)
+		signal.Notify(sigC, config.Signal)
+		defer signal.Stop(sigC)
+
+		var tickC <-chan time.Time
+		if len(config.Files) > 0 {
+			ticker := time.NewTicker(config.WatchInterval)
+			defer ticker.Stop()
+			tickC = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Ctx.Done():
+				return nil
+			case <-sigC:
+				ctx.Logger.Info("Reloading configuration", slog.String("trigger", "signal"))
+			case <-tickC:
+				newStats := statFiles(config.Files)
+				if slices.Equal(stats, newStats) {
+					continue
+				}
+				stats = newStats
+				ctx.Logger.Info("Reloading configuration", slog.String("trigger", "file"))
+			}
+			// The error is already logged by Reload.
+			r.Reload(ctx.Ctx)
+		}
+	}
+	return NewLongRunningTask("srun-config-reloader", fn)
+}
+
+// fileStat is the state of a watched file to detect the file modification.
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+func statFiles(files []string) []fileStat {
+	stats := make([]fileStat, len(files))
+	for idx, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		stats[idx] = fileStat{exists: true, size: info.Size(), modTime: info.ModTime().UnixNano()}
+	}
+	return stats
+}
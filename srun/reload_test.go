@@ -0,0 +1,266 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	_ ServiceReloadAware     = (*serviceWithReload)(nil)
+	_ ServiceDependencyAware = (*serviceWithReload)(nil)
+)
+
+type reloadTestConfig struct {
+	Version int
+	// Reject is the name of the service that rejects the configuration.
+	Reject string
+}
+
+// reloadRecorder records the reload of the services in order.
+type reloadRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *reloadRecorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *reloadRecorder) flush() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// serviceWithReload is a service that records the configuration version when reloaded.
+type serviceWithReload struct {
+	*serviceDoNothing
+	dependsOn []string
+	recorder  *reloadRecorder
+}
+
+func newServiceWithReload(name string, recorder *reloadRecorder, dependsOn ...string) *serviceWithReload {
+	return &serviceWithReload{
+		serviceDoNothing: &serviceDoNothing{
+			name: name,
+			errC: make(chan error, 1),
+			onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
+				<-ctx.Done()
+				return nil
+			},
+		},
+		dependsOn: dependsOn,
+		recorder:  recorder,
+	}
+}
+
+func (s *serviceWithReload) DependsOn() []string {
+	return s.dependsOn
+}
+
+func (s *serviceWithReload) Reload(ctx context.Context, config any) error {
+	c := config.(*reloadTestConfig)
+	if c.Reject == s.Name() {
+		return errors.New("invalid config")
+	}
+	s.recorder.record(fmt.Sprintf("%s:%d", s.Name(), c.Version))
+	return nil
+}
+
+// runReloadTest runs the runner in the background and waits until the runner is running.
+func runReloadTest(t *testing.T, r *Runner, services ...ServiceRunnerAware) <-chan error {
+	t.Helper()
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- r.Run(func(ctx context.Context, runner ServiceRunner) error {
+			return runner.Register(services...)
+		})
+	}()
+	for atomic.LoadInt32(&r.state) != runnerStateRunning {
+		select {
+		case err := <-errC:
+			t.Fatalf("runner exited before running: %v", err)
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	return errC
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	var next atomic.Pointer[reloadTestConfig]
+	loadErr := errors.New("load error")
+	config := Config{
+		Name:             "testing_reload",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second * 3,
+		Reload: ReloadConfig{
+			Config: &reloadTestConfig{Version: 1},
+			Load: func(ctx context.Context) (any, error) {
+				c := next.Load()
+				if c == nil {
+					return nil, loadErr
+				}
+				return c, nil
+			},
+		},
+	}
+
+	recorder := &reloadRecorder{}
+	r := New(config)
+	if err := r.Reload(context.Background()); !errors.Is(err, errReloadNotRunning) {
+		t.Fatalf("expecting error %v but got %v", errReloadNotRunning, err)
+	}
+	errC := runReloadTest(t, r,
+		newServiceWithReload("worker", recorder, "http"),
+		newServiceWithReload("http", recorder, "database"),
+		newServiceWithReload("database", recorder),
+		&serviceDoNothing{name: "no-reload"},
+	)
+
+	tests := []struct {
+		name        string
+		config      *reloadTestConfig
+		expectErr   error
+		expect      []string
+		expectState int
+	}{
+		{
+			name:        "reload in dependency order",
+			config:      &reloadTestConfig{Version: 2},
+			expect:      []string{"database:2", "http:2", "worker:2"},
+			expectState: 2,
+		},
+		{
+			name:        "unchanged config",
+			config:      &reloadTestConfig{Version: 2},
+			expectState: 2,
+		},
+		{
+			name:      "rejected config is rolled back",
+			config:    &reloadTestConfig{Version: 3, Reject: "worker"},
+			expectErr: errReloadRejected,
+			// The services that already reloaded are rolled back in the reverse order.
+			expect:      []string{"database:3", "http:3", "http:2", "database:2"},
+			expectState: 2,
+		},
+		{
+			name:        "load error",
+			expectErr:   loadErr,
+			expectState: 2,
+		},
+	}
+	// The tests are not parallel as the reload changes the state of the runner.
+	for _, test := range tests {
+		next.Store(test.config)
+		err := r.Reload(context.Background())
+		if !errors.Is(err, test.expectErr) {
+			t.Fatalf("%s: expecting error %v but got %v", test.name, test.expectErr, err)
+		}
+		if diff := cmp.Diff(test.expect, recorder.flush()); diff != "" {
+			t.Fatalf("%s: (-want/+got) reload events:\n%s", test.name, diff)
+		}
+		if version := r.reloader.config.(*reloadTestConfig).Version; version != test.expectState {
+			t.Fatalf("%s: expecting current config version %d but got %d", test.name, test.expectState, version)
+		}
+	}
+
+	if err := <-errC; !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+}
+
+func TestReloadDisabled(t *testing.T) {
+	t.Parallel()
+
+	r := New(Config{
+		Name:       "testing_reload_disabled",
+		Admin:      AdminConfig{Disable: true},
+		OtelTracer: OTelTracerConfig{Disable: true},
+		OtelMetric: OtelMetricConfig{Disable: true},
+	})
+	if err := r.Reload(context.Background()); !errors.Is(err, errReloadDisabled) {
+		t.Fatalf("expecting error %v but got %v", errReloadDisabled, err)
+	}
+}
+
+func TestReloadTrigger(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfigFile(t, "config.yaml", "version: 1\n")
+	var loads atomic.Int32
+	config := Config{
+		Name:             "testing_reload_trigger",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second * 3,
+		Reload: ReloadConfig{
+			Config: &reloadTestConfig{Version: 1},
+			Load: func(ctx context.Context) (any, error) {
+				return &reloadTestConfig{Version: int(loads.Add(1)) + 1}, nil
+			},
+			// SIGWINCH is ignored by default, so it is safe to send the signal to the test process.
+			Signal:        syscall.SIGWINCH,
+			Files:         []string{path},
+			WatchInterval: time.Millisecond * 50,
+		},
+	}
+
+	recorder := &reloadRecorder{}
+	r := New(config)
+	errC := runReloadTest(t, r, newServiceWithReload("service", recorder))
+
+	waitReload := func(trigger string, expect []string) {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case <-timeout:
+				t.Fatalf("%s: timeout waiting for the reload", trigger)
+			case <-time.After(time.Millisecond * 10):
+			}
+			recorder.mu.Lock()
+			events := recorder.events
+			recorder.mu.Unlock()
+			if len(events) < len(expect) {
+				continue
+			}
+			if diff := cmp.Diff(expect, recorder.flush()); diff != "" {
+				t.Fatalf("%s: (-want/+got) reload events:\n%s", trigger, diff)
+			}
+			return
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("version: 2\nname: changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitReload("file", []string{"service:2"})
+	// The reloader is already listening to the signal, as the file change is detected after the signal is registered.
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+	waitReload("signal", []string{"service:3"})
+
+	if err := <-errC; !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+}
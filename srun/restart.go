@@ -0,0 +1,200 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	restartDefaultInitialBackoff = time.Second
+	restartDefaultMaxBackoff     = time.Minute
+	restartDefaultMultiplier     = 2
+	restartDefaultJitter         = 0.2
+)
+
+// RestartMode defines when the runner should restart a service that exits from Run.
+type RestartMode int
+
+const (
+	// RestartNever never restarts the service. When the service exits from Run with an error, the runner stops all the services.
+	RestartNever RestartMode = iota
+	// RestartOnFailure restarts the service only when the service exits from Run with an error.
+	RestartOnFailure
+	// RestartAlways restarts the service whenever the service exits from Run, including when the service exits without error.
+	RestartAlways
+)
+
+// String returns the restart mode in string.
+func (r RestartMode) String() string {
+	switch r {
+	case RestartNever:
+		return "NEVER"
+	case RestartOnFailure:
+		return "ON_FAILURE"
+	case RestartAlways:
+		return "ALWAYS"
+	default:
+		return "UNKNOWN_RESTART_MODE"
+	}
+}
+
+// RestartPolicy defines how the runner restarts a service that exits from Run. The restart is delayed using exponential backoff
+// with jitter, so a flaky service won't be restarted in a tight loop.
+type RestartPolicy struct {
+	Mode RestartMode
+	// MaxRestarts is the maximum number of restarts before the runner gives up and stops all the services. Zero means
+	// the service can be restarted without limit.
+	MaxRestarts int
+	// InitialBackoff is the delay before the first restart. By default, the initial backoff is one second.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between restarts, it cannot be less than the initial backoff. By default, the maximum
+	// backoff is one minute, or the initial backoff if it is longer.
+	MaxBackoff time.Duration
+	// Multiplier is the multiplier of the backoff for each restart, it cannot be less than one. By default, the backoff is
+	// doubled for each restart.
+	Multiplier float64
+	// Jitter is the fraction of the backoff that being randomized, the value must be between zero and one. By default,
+	// the backoff is randomized by 20%.
+	Jitter float64
+}
+
+func (r *RestartPolicy) validate() error {
+	if r.Mode < RestartNever || r.Mode > RestartAlways {
+		return fmt.Errorf("invalid restart mode %d", r.Mode)
+	}
+	if r.MaxRestarts < 0 {
+		return errors.New("max restarts cannot be negative")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return errors.New("jitter must be between zero and one")
+	}
+	if r.InitialBackoff < 0 || r.MaxBackoff < 0 {
+		return errors.New("initial backoff and max backoff cannot be negative")
+	}
+	// The backoff must not shrink between restarts.
+	if r.Multiplier != 0 && r.Multiplier < 1 {
+		return errors.New("multiplier cannot be less than one")
+	}
+	if r.InitialBackoff == 0 {
+		r.InitialBackoff = restartDefaultInitialBackoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = max(restartDefaultMaxBackoff, r.InitialBackoff)
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		return errors.New("max backoff cannot be less than initial backoff")
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = restartDefaultMultiplier
+	}
+	if r.Jitter == 0 {
+		r.Jitter = restartDefaultJitter
+	}
+	return nil
+}
+
+// shouldRestart returns true if the service need to be restarted based on the returned error of Run and the number of restarts.
+func (r RestartPolicy) shouldRestart(err error, restarts int) bool {
+	if r.MaxRestarts > 0 && restarts >= r.MaxRestarts {
+		return false
+	}
+	switch r.Mode {
+	case RestartOnFailure:
+		return err != nil
+	case RestartAlways:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before the next restart.
+func (r RestartPolicy) backoff(restarts int) time.Duration {
+	backoff := float64(r.InitialBackoff) * math.Pow(r.Multiplier, float64(restarts))
+	if backoff > float64(r.MaxBackoff) {
+		backoff = float64(r.MaxBackoff)
+	}
+	// Randomize the backoff in the range of [backoff - jitter, backoff + jitter].
+	jitter := backoff * r.Jitter
+	backoff = backoff - jitter + (rand.Float64() * jitter * 2)
+	return time.Duration(backoff)
+}
+
+// ServiceRestartAware defines a service that can be restarted by the runner when the service exits from Run. Without the
+// restart policy, an error from Run stops all the services inside the runner.
+type ServiceRestartAware interface {
+	RestartPolicy() RestartPolicy
+}
+
+// superviseService runs the service and restarts the service based on its restart policy, or when the restart is requested by
+// UnhealthyActionRestart. The function returns the last error of the service when the service should not be restarted anymore.
+func (r *Runner) superviseService(ctx context.Context, svc *ServiceStateTracker) error {
+	policy, hasPolicy := svc.restartPolicy()
+
+	err := svc.Run(ctx)
+	for {
+		// Don't restart the service if the runner or the service is shutting down, as Run is expected to return in this case.
+		if ctx.Err() != nil || svc.getState() != serviceStateRunExited {
+			return err
+		}
+		restarts := svc.Restarts()
+		// The requested restart is not delayed and doesn't follow the restart policy, as the service is stopped on purpose.
+		if svc.restartRequested.Swap(false) {
+			r.logger.Warn(
+				fmt.Sprintf("[Service] %s: restarting unhealthy service", svc.Name()),
+				slog.String("service_name", svc.Name()),
+				slog.Int("restarts", restarts),
+			)
+		} else {
+			if !hasPolicy || !policy.shouldRestart(err, restarts) {
+				return err
+			}
+			backoff := policy.backoff(restarts)
+			attrs := []any{
+				slog.String("service_name", svc.Name()),
+				slog.Int("restarts", restarts),
+				slog.Duration("backoff", backoff),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			r.logger.Warn(fmt.Sprintf("[Service] %s: restarting service", svc.Name()), attrs...)
+
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+		}
+
+		initCtx, cancel := context.WithTimeout(ctx, r.config.Timeout.InitTimeout)
+		errRestart := svc.restart(r.serviceContext(initCtx, svc))
+		cancel()
+		if errRestart != nil {
+			// The service is being stopped while waiting for the backoff, so we should return the previous error.
+			if errors.Is(errRestart, errServiceShuttingDown) {
+				return err
+			}
+			return errors.Join(err, errRestart)
+		}
+		r.metrics.recordRestart(ctx, svc.Name())
+
+		// Wait for the service to be ready in the background so the state of the service is changed to running.
+		go func() {
+			readyCtx, cancel := context.WithTimeout(ctx, r.config.Timeout.ReadyTimeout)
+			defer cancel()
+			if errReady := svc.Ready(readyCtx); errReady != nil {
+				r.logger.Error(
+					fmt.Sprintf("[Service] %s: service is not ready after restart", svc.Name()),
+					slog.String("error", errReady.Error()),
+				)
+			}
+		}()
+		err = svc.runAfterRestart(ctx)
+	}
+}
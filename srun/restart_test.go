@@ -0,0 +1,202 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRestartPolicy(t *testing.T) {
+	t.Parallel()
+
+	errRun := errors.New("run error")
+	tests := []struct {
+		name     string
+		policy   RestartPolicy
+		err      error
+		restarts int
+		expect   bool
+	}{
+		{
+			name:   "never",
+			policy: RestartPolicy{Mode: RestartNever},
+			err:    errRun,
+			expect: false,
+		},
+		{
+			name:   "on failure with error",
+			policy: RestartPolicy{Mode: RestartOnFailure},
+			err:    errRun,
+			expect: true,
+		},
+		{
+			name:   "on failure without error",
+			policy: RestartPolicy{Mode: RestartOnFailure},
+			err:    nil,
+			expect: false,
+		},
+		{
+			name:   "always without error",
+			policy: RestartPolicy{Mode: RestartAlways},
+			err:    nil,
+			expect: true,
+		},
+		{
+			name:     "max restarts reached",
+			policy:   RestartPolicy{Mode: RestartAlways, MaxRestarts: 3},
+			err:      errRun,
+			restarts: 3,
+			expect:   false,
+		},
+		{
+			name:     "unlimited restarts",
+			policy:   RestartPolicy{Mode: RestartOnFailure},
+			err:      errRun,
+			restarts: 100,
+			expect:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			if err := test.policy.validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := test.policy.shouldRestart(test.err, test.restarts); got != test.expect {
+				t.Fatalf("expecting %v but got %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := RestartPolicy{
+		Mode:           RestartOnFailure,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second * 10,
+		Jitter:         0.5,
+	}
+	if err := policy.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		restarts int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{restarts: 0, min: time.Millisecond * 500, max: time.Millisecond * 1500},
+		{restarts: 1, min: time.Second, max: time.Second * 3},
+		{restarts: 2, min: time.Second * 2, max: time.Second * 6},
+		// The backoff is capped by the maximum backoff.
+		{restarts: 10, min: time.Second * 5, max: time.Second * 15},
+	}
+	for _, test := range tests {
+		for range 100 {
+			got := policy.backoff(test.restarts)
+			if got < test.min || got > test.max {
+				t.Fatalf("restarts %d: expecting backoff between %s and %s but got %s", test.restarts, test.min, test.max, got)
+			}
+		}
+	}
+}
+
+func TestRestartPolicyValidate(t *testing.T) {
+	t.Parallel()
+
+	invalid := []RestartPolicy{
+		{Mode: RestartMode(10)},
+		{Mode: RestartOnFailure, MaxRestarts: -1},
+		{Mode: RestartOnFailure, Jitter: 2},
+		{Mode: RestartOnFailure, InitialBackoff: -time.Second},
+		{Mode: RestartOnFailure, MaxBackoff: -time.Second},
+		{Mode: RestartOnFailure, Multiplier: -2},
+		{Mode: RestartOnFailure, Multiplier: 0.5},
+		{Mode: RestartOnFailure, InitialBackoff: time.Minute, MaxBackoff: time.Second},
+	}
+	for _, policy := range invalid {
+		if err := policy.validate(); err == nil {
+			t.Fatalf("expecting error for policy %+v", policy)
+		}
+	}
+}
+
+func TestRunnerRestartService(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		Name:       "testing_restart",
+		Admin:      AdminConfig{Disable: true},
+		OtelTracer: OTelTracerConfig{Disable: true},
+		OtelMetric: OtelMetricConfig{Disable: true},
+	}
+	errFlaky := errors.New("flaky")
+
+	t.Run("restart on failure", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts atomic.Int32
+		conf := config
+		conf.DeadlineDuration = time.Second * 3
+		err := New(conf).Run(func(ctx context.Context, runner ServiceRunner) error {
+			lrt, err := NewLongRunningTask("flaky", func(ctx Context) error {
+				// Fail for the first two attempts and keeps running for the third attempt.
+				if attempts.Add(1) < 3 {
+					time.Sleep(time.Millisecond * 500)
+					return errFlaky
+				}
+				<-ctx.Ctx.Done()
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			lrt.SetRestartPolicy(RestartPolicy{
+				Mode:           RestartOnFailure,
+				InitialBackoff: time.Millisecond * 10,
+			})
+			return runner.Register(lrt)
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if attempts.Load() != 3 {
+			t.Fatalf("expecting 3 attempts but got %d", attempts.Load())
+		}
+	})
+
+	t.Run("max restarts exceeded", func(t *testing.T) {
+		t.Parallel()
+
+		var attempts atomic.Int32
+		conf := config
+		conf.DeadlineDuration = time.Second * 10
+		err := New(conf).Run(func(ctx context.Context, runner ServiceRunner) error {
+			lrt, err := NewLongRunningTask("flaky", func(ctx Context) error {
+				attempts.Add(1)
+				time.Sleep(time.Millisecond * 500)
+				return errFlaky
+			})
+			if err != nil {
+				return err
+			}
+			lrt.SetRestartPolicy(RestartPolicy{
+				Mode:           RestartOnFailure,
+				MaxRestarts:    2,
+				InitialBackoff: time.Millisecond * 10,
+			})
+			return runner.Register(lrt)
+		})
+		if !errors.Is(err, errServiceError) {
+			t.Fatalf("expecting error %v but got %v", errServiceError, err)
+		}
+		if attempts.Load() != 3 {
+			t.Fatalf("expecting 3 attempts but got %d", attempts.Load())
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package srun
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchYears bounds the search of the next activation time, so a schedule that never activates such as '0 0 30 2 *'
+// doesn't loop forever.
+const cronSearchYears = 5
+
+// Schedule is the activation schedule of a ScheduledTask.
+type Schedule interface {
+	// Next returns the next activation time strictly after the given time. The zero time is returned when the schedule
+	// never activates again.
+	Next(time.Time) time.Time
+}
+
+// Every returns a schedule that activates periodically with the interval. For an interval of a second or longer, the
+// activation time is truncated to the second.
+func Every(interval time.Duration) Schedule {
+	return everySchedule{interval: interval}
+}
+
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	if e.interval <= 0 {
+		return time.Time{}
+	}
+	next := t.Add(e.interval)
+	if e.interval >= time.Second {
+		next = next.Truncate(time.Second)
+	}
+	return next
+}
+
+// cronSchedule is the parsed cron expression. Each field is a bitset of the allowed values.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// domAny and dowAny are true when the day of month and the day of week are not restricted. When both of them are
+	// restricted, the day matches if either of them matches.
+	domAny, dowAny bool
+	// location is the time zone of the expression. The location of the given time is used when it is nil.
+	location *time.Location
+}
+
+// ParseCron parses the cron expression into a schedule. The expression has five fields, or six fields when the first field
+// is the second:
+//
+//	┌───────────── second (0-59, optional)
+//	│ ┌─────────── minute (0-59)
+//	│ │ ┌───────── hour (0-23)
+//	│ │ │ ┌─────── day of month (1-31)
+//	│ │ │ │ ┌───── month (1-12 or JAN-DEC)
+//	│ │ │ │ │ ┌─── day of week (0-7 or SUN-SAT, both 0 and 7 are Sunday)
+//	* * * * * *
+//
+// Each field accepts '*', a value, a range 'a-b', a step '*/n', 'a/n' or 'a-b/n', and a comma separated list of them. The
+// descriptors '@yearly', '@annually', '@monthly', '@weekly', '@daily', '@midnight', '@hourly' and '@every <duration>' are
+// also accepted.
+//
+// By default, the expression is evaluated in the time zone of the time given to Next, which is the local time zone for the
+// ScheduledTask. The time zone can be set by prefixing the expression with 'CRON_TZ=<zone>' or 'TZ=<zone>', for example
+// 'CRON_TZ=Asia/Jakarta 0 2 * * *'.
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("cron: expression cannot be empty")
+	}
+
+	var location *time.Location
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		zone, rest, _ := strings.Cut(spec, " ")
+		_, name, _ := strings.Cut(zone, "=")
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("cron: invalid time zone %q: %w", name, err)
+		}
+		location = loc
+		spec = strings.TrimSpace(rest)
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		return parseCronDescriptor(spec, location)
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron: expecting 5 or 6 fields but got %d in %q", len(fields), spec)
+	}
+
+	s := &cronSchedule{location: location}
+	var err error
+	if s.second, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron: invalid second: %w", err)
+	}
+	if s.minute, err = parseCronField(fields[1], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron: invalid minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[2], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron: invalid hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[3], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron: invalid day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[4], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("cron: invalid month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[5], 0, 7, cronWeekdayNames); err != nil {
+		return nil, fmt.Errorf("cron: invalid day of week: %w", err)
+	}
+	// Both 0 and 7 are Sunday.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domAny = fields[3] == "*" || fields[3] == "?"
+	s.dowAny = fields[5] == "*" || fields[5] == "?"
+	return s, nil
+}
+
+func parseCronDescriptor(spec string, location *time.Location) (Schedule, error) {
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, fmt.Errorf("cron: invalid @every duration: %w", err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("cron: @every duration must be positive but got %s", d)
+		}
+		return Every(d), nil
+	}
+
+	var expr string
+	switch spec {
+	case "@yearly", "@annually":
+		expr = "0 0 0 1 1 *"
+	case "@monthly":
+		expr = "0 0 0 1 * *"
+	case "@weekly":
+		expr = "0 0 0 * * 0"
+	case "@daily", "@midnight":
+		expr = "0 0 0 * * *"
+	case "@hourly":
+		expr = "0 0 * * * *"
+	default:
+		return nil, fmt.Errorf("cron: unknown descriptor %q", spec)
+	}
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	schedule.(*cronSchedule).location = location
+	return schedule, nil
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	cronWeekdayNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+// parseCronField parses a comma separated list of values, ranges and steps into a bitset.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		var start, end int
+		switch {
+		case expr == "*" || expr == "?":
+			start, end = min, max
+		default:
+			startStr, endStr, isRange := strings.Cut(expr, "-")
+			var err error
+			if start, err = parseCronValue(startStr, names); err != nil {
+				return 0, err
+			}
+			end = start
+			switch {
+			case isRange:
+				if end, err = parseCronValue(endStr, names); err != nil {
+					return 0, err
+				}
+			case hasStep:
+				// 'a/n' means from a to the maximum value every n.
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is out of range [%d, %d]", part, min, max)
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << i
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return v, nil
+}
+
+// Next returns the next time matching the expression, or the zero time if there is no matching time within the next five
+// years. The returned time is in the location of the given time.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	if s.location != nil {
+		t = t.In(s.location)
+	}
+	zone := t.Location()
+	limit := t.Year() + cronSearchYears
+	t = t.Truncate(time.Second).Add(time.Second)
+
+	for t.Year() <= limit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, zone)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, zone)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, zone)
+			// The next hour might be normalized back to the current hour when the clock is turned back by the daylight
+			// saving time, move it forward by the absolute time instead.
+			if !next.After(t) {
+				next = t.Truncate(time.Hour).Add(time.Hour)
+			}
+			t = next
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		case s.second&(1<<uint(t.Second())) == 0:
+			t = t.Add(time.Second)
+		default:
+			return t.In(loc)
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
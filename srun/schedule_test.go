@@ -0,0 +1,156 @@
+package srun
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	t.Parallel()
+
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		spec   string
+		from   time.Time
+		expect time.Time
+	}{
+		{
+			name:   "every fifteen minutes",
+			spec:   "*/15 * * * *",
+			from:   date(2026, time.January, 1, 10, 7, 30),
+			expect: date(2026, time.January, 1, 10, 15, 0),
+		},
+		{
+			name:   "strictly after the given time",
+			spec:   "0 10 * * *",
+			from:   date(2026, time.January, 1, 10, 0, 0),
+			expect: date(2026, time.January, 2, 10, 0, 0),
+		},
+		{
+			name:   "with seconds",
+			spec:   "*/10 * * * * *",
+			from:   date(2026, time.January, 1, 10, 0, 5),
+			expect: date(2026, time.January, 1, 10, 0, 10),
+		},
+		{
+			name:   "range with step on weekdays",
+			spec:   "0 9-17/4 * * MON-FRI",
+			from:   date(2026, time.January, 2, 18, 0, 0),
+			expect: date(2026, time.January, 5, 9, 0, 0),
+		},
+		{
+			name:   "either day of month or day of week",
+			spec:   "0 0 1,15 * mon",
+			from:   date(2026, time.January, 1, 0, 0, 0),
+			expect: date(2026, time.January, 5, 0, 0, 0),
+		},
+		{
+			name:   "seven is sunday",
+			spec:   "0 0 * * 7",
+			from:   date(2026, time.January, 1, 0, 0, 0),
+			expect: date(2026, time.January, 4, 0, 0, 0),
+		},
+		{
+			name:   "month names",
+			spec:   "0 0 1 JUN,dec *",
+			from:   date(2026, time.June, 1, 0, 0, 0),
+			expect: date(2026, time.December, 1, 0, 0, 0),
+		},
+		{
+			name:   "leap day",
+			spec:   "0 0 29 2 *",
+			from:   date(2026, time.March, 1, 0, 0, 0),
+			expect: date(2028, time.February, 29, 0, 0, 0),
+		},
+		{
+			name: "never",
+			spec: "0 0 30 2 *",
+			from: date(2026, time.January, 1, 0, 0, 0),
+		},
+		{
+			name:   "monthly",
+			spec:   "@monthly",
+			from:   date(2026, time.January, 31, 12, 0, 0),
+			expect: date(2026, time.February, 1, 0, 0, 0),
+		},
+		{
+			name:   "every duration",
+			spec:   "@every 90s",
+			from:   date(2026, time.January, 1, 10, 0, 0).Add(time.Millisecond * 500),
+			expect: date(2026, time.January, 1, 10, 1, 30),
+		},
+		{
+			// 02:00 in Jakarta is 19:00 UTC of the previous day.
+			name:   "time zone",
+			spec:   "CRON_TZ=Asia/Jakarta 0 2 * * *",
+			from:   date(2026, time.January, 1, 0, 0, 0),
+			expect: date(2026, time.January, 1, 19, 0, 0),
+		},
+		{
+			name:   "time zone descriptor",
+			spec:   "TZ=Asia/Jakarta @daily",
+			from:   date(2026, time.January, 1, 0, 0, 0),
+			expect: date(2026, time.January, 1, 17, 0, 0),
+		},
+		{
+			name:   "local time zone of the given time",
+			spec:   "0 2 * * *",
+			from:   time.Date(2026, time.January, 1, 7, 0, 0, 0, jakarta),
+			expect: time.Date(2026, time.January, 2, 2, 0, 0, 0, jakarta),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := ParseCron(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := schedule.Next(test.from)
+			if !got.Equal(test.expect) {
+				t.Fatalf("expecting %s but got %s", test.expect, got)
+			}
+			if !got.IsZero() && got.Location() != test.from.Location() {
+				t.Fatalf("expecting location %s but got %s", test.from.Location(), got.Location())
+			}
+		})
+	}
+}
+
+func TestParseCronError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{name: "empty", spec: ""},
+		{name: "missing fields", spec: "* * * *"},
+		{name: "too many fields", spec: "* * * * * * *"},
+		{name: "out of range", spec: "60 * * * *"},
+		{name: "reversed range", spec: "5-1 * * * *"},
+		{name: "zero step", spec: "*/0 * * * *"},
+		{name: "invalid name", spec: "* * * * MON-"},
+		{name: "invalid time zone", spec: "CRON_TZ=Nowhere/City * * * * *"},
+		{name: "negative every", spec: "@every -1s"},
+		{name: "unknown descriptor", spec: "@fortnightly"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := ParseCron(test.spec); err == nil {
+				t.Fatalf("expecting error for %q", test.spec)
+			}
+		})
+	}
+}
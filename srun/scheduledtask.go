@@ -0,0 +1,566 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// scheduledTaskMaxQueuedRuns is the maximum number of runs waiting for the previous run with OverlapQueue, the next
+	// runs are skipped when the queue is full.
+	scheduledTaskMaxQueuedRuns = 10
+	// scheduledTaskMaxCatchUpRuns is the maximum number of missed runs executed with CatchUpAll.
+	scheduledTaskMaxCatchUpRuns = 100
+)
+
+// errScheduledTaskStopDeadline is returned by the scheduled task if the in-flight runs are not finished within the stop deadline.
+var errScheduledTaskStopDeadline = errors.New("scheduled_task: stop deadline exceeded")
+
+// OverlapPolicy decides what happens when the task is activated while the previous run is still running.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the new run, this is the default policy.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue runs the new run after the previous run is finished. Up to ten runs are queued, and the next runs are
+	// skipped when the queue is full.
+	OverlapQueue
+	// OverlapAllow runs the new run concurrently with the previous run.
+	OverlapAllow
+)
+
+// String returns the overlap policy in string.
+func (o OverlapPolicy) String() string {
+	switch o {
+	case OverlapSkip:
+		return "SKIP"
+	case OverlapQueue:
+		return "QUEUE"
+	case OverlapAllow:
+		return "ALLOW"
+	default:
+		return "UNKNOWN_OVERLAP_POLICY"
+	}
+}
+
+// CatchUpPolicy decides what happens with the runs missed because the program was not running, or because the scheduler
+// woke up late, for example after the machine was suspended.
+type CatchUpPolicy int
+
+const (
+	// CatchUpSkip ignores the missed runs, this is the default policy.
+	CatchUpSkip CatchUpPolicy = iota
+	// CatchUpOnce runs the task once for all the missed runs.
+	CatchUpOnce
+	// CatchUpAll runs the task for each missed run, up to the latest hundred runs. The runs follow the overlap policy, so the
+	// policy should be OverlapQueue or OverlapAllow to not skip the missed runs.
+	CatchUpAll
+)
+
+// String returns the catch-up policy in string.
+func (c CatchUpPolicy) String() string {
+	switch c {
+	case CatchUpSkip:
+		return "SKIP"
+	case CatchUpOnce:
+		return "ONCE"
+	case CatchUpAll:
+		return "ALL"
+	default:
+		return "UNKNOWN_CATCH_UP_POLICY"
+	}
+}
+
+type scheduledTimeKey struct{}
+
+// ScheduledTime returns the activation time of the run from the context passed to the ScheduledTask function. The time can
+// be used to process the data of the period the run belongs to, as the run might be executed later for the missed runs.
+func ScheduledTime(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(scheduledTimeKey{}).(time.Time)
+	return t, ok
+}
+
+// NewScheduledTask creates a task that runs the function based on the schedule. Use ParseCron or Every to create the schedule.
+func NewScheduledTask(name string, schedule Schedule, fn func(ctx Context) error) (*ScheduledTask, error) {
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+	if schedule == nil {
+		return nil, errors.New("schedule cannot be empty")
+	}
+	if fn == nil {
+		return nil, errors.New("task func cannot be empty")
+	}
+	return &ScheduledTask{
+		name:     name,
+		schedule: schedule,
+		fn:       fn,
+	}, nil
+}
+
+var (
+	_ ServiceRunnerAware        = (*ScheduledTask)(nil)
+	_ ServiceShutdownPhaseAware = (*ScheduledTask)(nil)
+	_ ServiceStopTimeoutAware   = (*ScheduledTask)(nil)
+)
+
+// ScheduledTask runs a function periodically or based on a cron expression, like a cron job inside the program. An error
+// returned by the function is logged and recorded, but it doesn't stop the task, so the task keeps running on the next
+// activation.
+//
+// Each run is traced with a span and recorded in the 'srun.scheduled_task.runs' and 'srun.scheduled_task.run.duration'
+// metrics. When the task is stopped, no new runs are started and the task waits for the in-flight runs until the stop
+// deadline before cancelling their context.
+//
+// Implements ServiceRunnerAware interface.
+type ScheduledTask struct {
+	name     string
+	schedule Schedule
+	fn       func(ctx Context) error
+	iCtx     Context
+	tracer   trace.Tracer
+	metrics  *scheduledTaskMetrics
+
+	overlapPolicy OverlapPolicy
+	catchUpPolicy CatchUpPolicy
+	// lastRunFunc returns the activation time of the last run before the program started, to catch-up the missed runs.
+	lastRunFunc func(ctx context.Context) (time.Time, error)
+	runTimeout  time.Duration
+	// shutdownPhase and stopTimeout control how the runner stops the task.
+	shutdownPhase ShutdownPhase
+	stopTimeout   time.Duration
+
+	mu sync.Mutex
+	// running is the number of in-flight runs, and queued is the activation time of the runs waiting with OverlapQueue.
+	running  int
+	queued   []time.Time
+	stopping bool
+	wg       sync.WaitGroup
+
+	// readyC is closed when the task starts scheduling, and doneC is closed when Run returns. Both channels are created
+	// in Init as the task might be restarted.
+	readyC chan struct{}
+	doneC  chan struct{}
+	// stopC passes the stop context to Run, so Run can wait for the in-flight runs until the stop deadline.
+	stopC chan context.Context
+}
+
+// Name returns the name of the scheduled task.
+func (s *ScheduledTask) Name() string {
+	return s.name
+}
+
+// SetOverlapPolicy sets what happens when the task is activated while the previous run is still running. By default, the
+// new run is skipped.
+//
+// The overlap policy must be set before the task is registered to the runner.
+func (s *ScheduledTask) SetOverlapPolicy(policy OverlapPolicy) {
+	s.overlapPolicy = policy
+}
+
+// SetCatchUpPolicy sets what happens with the missed runs. By default, the missed runs are ignored.
+//
+// The lastRun function returns the activation time of the last run, usually stored by the task in a database, and it is
+// called once when the task starts to find the runs missed while the program was not running. The function can be nil, so
+// only the runs missed by a late wake-up of the scheduler are caught-up.
+//
+// The catch-up policy must be set before the task is registered to the runner.
+func (s *ScheduledTask) SetCatchUpPolicy(policy CatchUpPolicy, lastRun func(ctx context.Context) (time.Time, error)) {
+	s.catchUpPolicy = policy
+	s.lastRunFunc = lastRun
+}
+
+// SetRunTimeout sets the timeout of each run. By default, the run is only cancelled when the task is stopped.
+//
+// The run timeout must be set before the task is registered to the runner.
+func (s *ScheduledTask) SetRunTimeout(timeout time.Duration) {
+	s.runTimeout = timeout
+}
+
+// SetShutdownPhase sets the shutdown phase of the task. By default, the task is stopped in ShutdownPhaseDefault.
+//
+// The shutdown phase must be set before the task is registered to the runner.
+func (s *ScheduledTask) SetShutdownPhase(phase ShutdownPhase) {
+	s.shutdownPhase = phase
+}
+
+// ShutdownPhase returns the shutdown phase of the task.
+func (s *ScheduledTask) ShutdownPhase() ShutdownPhase {
+	return s.shutdownPhase
+}
+
+// SetStopTimeout sets the maximum duration to wait for the in-flight runs when the task is stopped. By default, the task is
+// only bounded by the timeout of its shutdown phase.
+//
+// The stop timeout must be set before the task is registered to the runner.
+func (s *ScheduledTask) SetStopTimeout(timeout time.Duration) {
+	s.stopTimeout = timeout
+}
+
+// StopTimeout returns the stop timeout of the task.
+func (s *ScheduledTask) StopTimeout() time.Duration {
+	return s.stopTimeout
+}
+
+// Init prepares the tracer and the metrics of the task.
+func (s *ScheduledTask) Init(ctx Context) error {
+	s.iCtx = ctx
+	if s.iCtx.Logger == nil {
+		s.iCtx.Logger = slog.Default()
+	}
+	s.tracer = ctx.Tracer
+	if s.tracer == nil {
+		s.tracer = tracenoop.NewTracerProvider().Tracer("")
+	}
+	meter := ctx.Meter
+	if meter == nil {
+		meter = metricnoop.NewMeterProvider().Meter("")
+	}
+	metrics, err := newScheduledTaskMetrics(meter)
+	if err != nil {
+		return err
+	}
+	s.metrics = metrics
+
+	s.mu.Lock()
+	s.running = 0
+	s.queued = nil
+	s.stopping = false
+	s.mu.Unlock()
+	s.readyC = make(chan struct{})
+	s.doneC = make(chan struct{})
+	s.stopC = make(chan context.Context)
+	return nil
+}
+
+// Run schedules the task until the task is stopped or the context is cancelled.
+func (s *ScheduledTask) Run(ctx context.Context) error {
+	defer close(s.doneC)
+	// runsCtx is the parent context of all runs, it is cancelled when the task is stopped after the in-flight runs are
+	// finished or the stop deadline is reached.
+	runsCtx, cancelRuns := context.WithCancel(ctx)
+	defer cancelRuns()
+
+	close(s.readyC)
+	// The last run is looked-up in the background so a slow lookup doesn't hold the task from being stopped. The lookup
+	// context is cancelled as soon as the task is stopping.
+	lookupCtx, cancelLookup := context.WithCancel(runsCtx)
+	defer cancelLookup()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.catchUpFromLastRun(lookupCtx, runsCtx)
+	}()
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	var (
+		next   time.Time
+		timerC <-chan time.Time
+	)
+	// schedule sets the timer to the next activation time. The timer channel is left nil when the schedule never activates
+	// again, so the task only waits to be stopped.
+	schedule := func(now time.Time) {
+		next = s.schedule.Next(now)
+		if next.IsZero() {
+			timerC = nil
+			s.iCtx.Logger.Warn(fmt.Sprintf("[ScheduledTask] %s: schedule has no next activation time", s.name))
+			return
+		}
+		timer.Reset(time.Until(next))
+		timerC = timer.C
+	}
+	schedule(time.Now())
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.setStopping()
+			cancelLookup()
+			cancelRuns()
+			s.wg.Wait()
+			return nil
+		case stopCtx := <-s.stopC:
+			cancelLookup()
+			return s.stop(stopCtx, cancelRuns)
+		case <-timerC:
+			now := time.Now()
+			// Collect the activation times passed since the timer is set, there are more than one activation time when the
+			// scheduler wakes up late.
+			due, missed := s.dueRuns(next, now, scheduledTaskMaxCatchUpRuns)
+			if len(due) < scheduledTaskMaxCatchUpRuns {
+				due = append([]time.Time{next}, due...)
+			}
+			s.catchUp(runsCtx, due, missed)
+			schedule(now)
+		}
+	}
+}
+
+// Ready waits until the task starts scheduling.
+func (s *ScheduledTask) Ready(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.readyC:
+		return nil
+	}
+}
+
+// Stop stops scheduling new runs and waits for the in-flight runs to finish. When the context deadline is reached, the
+// context of the in-flight runs is cancelled and the function returns without waiting for the runs to exit.
+func (s *ScheduledTask) Stop(ctx context.Context) error {
+	select {
+	case <-s.doneC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.stopC <- ctx:
+	}
+	// Block until Run exits, the runner has the ability to timeout the stop request.
+	<-s.doneC
+	return nil
+}
+
+// stop waits for the in-flight runs until the stop deadline, the queued runs are dropped.
+func (s *ScheduledTask) stop(ctx context.Context, cancelRuns context.CancelFunc) error {
+	s.setStopping()
+	waitC := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(waitC)
+	}()
+	select {
+	case <-waitC:
+		return nil
+	case <-ctx.Done():
+		cancelRuns()
+		return errScheduledTaskStopDeadline
+	}
+}
+
+func (s *ScheduledTask) setStopping() {
+	s.mu.Lock()
+	s.stopping = true
+	s.queued = nil
+	s.mu.Unlock()
+}
+
+// catchUpFromLastRun catches-up the runs missed between the last run and now. Only the lookup of the last run uses the lookup
+// context, the caught-up runs use the runs context so they are stopped like the other runs.
+func (s *ScheduledTask) catchUpFromLastRun(lookupCtx, runsCtx context.Context) {
+	if s.catchUpPolicy == CatchUpSkip || s.lastRunFunc == nil {
+		return
+	}
+	lastRun, err := s.lastRunFunc(lookupCtx)
+	// The lookup is cancelled because the task is stopping, so there is nothing to catch-up.
+	if lookupCtx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.iCtx.Logger.Error(
+			fmt.Sprintf("[ScheduledTask] %s: failed to get the last run, missed runs are not caught-up", s.name),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if lastRun.IsZero() {
+		return
+	}
+	due, missed := s.dueRuns(lastRun, time.Now(), scheduledTaskMaxCatchUpRuns)
+	// The latest due run is the one the task would have run regularly, the runs before it are the missed runs.
+	if missed > 0 {
+		missed--
+	}
+	s.catchUp(runsCtx, due, missed)
+}
+
+// catchUp triggers the due runs based on the catch-up policy. The latest due run is the regular run, while the runs
+// before it are the missed runs.
+func (s *ScheduledTask) catchUp(ctx context.Context, due []time.Time, missed int) {
+	if len(due) == 0 {
+		return
+	}
+	if missed > 0 {
+		s.iCtx.Logger.Warn(
+			fmt.Sprintf("[ScheduledTask] %s: missed %d runs", s.name, missed),
+			slog.String("task_name", s.name),
+			slog.String("catch_up_policy", s.catchUpPolicy.String()),
+		)
+	}
+	if s.catchUpPolicy != CatchUpAll {
+		s.trigger(ctx, due[len(due)-1])
+		return
+	}
+	for _, scheduled := range due {
+		s.trigger(ctx, scheduled)
+	}
+}
+
+// dueRuns returns the latest activation times after the given time until now, up to the limit, and the number of all
+// activation times in the period.
+func (s *ScheduledTask) dueRuns(after, now time.Time, limit int) ([]time.Time, int) {
+	due := newRingBuffer[time.Time](limit)
+	var count int
+	for t := s.schedule.Next(after); !t.IsZero() && !t.After(now); t = s.schedule.Next(t) {
+		due.push(t)
+		count++
+	}
+	return due.list(), count
+}
+
+// trigger starts the run based on the overlap policy.
+func (s *ScheduledTask) trigger(ctx context.Context, scheduled time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.stopping:
+		return
+	case s.running == 0 || s.overlapPolicy == OverlapAllow:
+		s.running++
+		s.wg.Add(1)
+		go s.execute(ctx, scheduled)
+	case s.overlapPolicy == OverlapQueue && len(s.queued) < scheduledTaskMaxQueuedRuns:
+		s.queued = append(s.queued, scheduled)
+	default:
+		s.metrics.recordSkipped(s.name)
+		s.iCtx.Logger.Warn(
+			fmt.Sprintf("[ScheduledTask] %s: skipping run, the previous run is still running", s.name),
+			slog.String("task_name", s.name),
+			slog.Time("scheduled_time", scheduled),
+		)
+	}
+}
+
+// execute runs the task, and continues with the queued runs if there are any.
+func (s *ScheduledTask) execute(ctx context.Context, scheduled time.Time) {
+	defer s.wg.Done()
+	for {
+		s.runOnce(ctx, scheduled)
+
+		s.mu.Lock()
+		if len(s.queued) == 0 || s.stopping || ctx.Err() != nil {
+			s.running--
+			s.mu.Unlock()
+			return
+		}
+		scheduled = s.queued[0]
+		s.queued = s.queued[1:]
+		s.mu.Unlock()
+	}
+}
+
+// runOnce runs the task function once with the run timeout, and records the result to the span and the metrics.
+func (s *ScheduledTask) runOnce(ctx context.Context, scheduled time.Time) {
+	ctx = context.WithValue(ctx, scheduledTimeKey{}, scheduled)
+	if s.runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.runTimeout)
+		defer cancel()
+	}
+	ctx, span := s.tracer.Start(
+		ctx,
+		"srun.scheduled_task.run",
+		trace.WithAttributes(
+			attribute.String("task_name", s.name),
+			attribute.String("scheduled_time", scheduled.Format(time.RFC3339)),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := s.safeRun(ctx)
+	result := "success"
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result = "timeout"
+	default:
+		result = "failure"
+	}
+	s.metrics.recordRun(s.name, result, start)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.iCtx.Logger.Error(
+			fmt.Sprintf("[ScheduledTask] %s: run failed", s.name),
+			slog.String("task_name", s.name),
+			slog.String("result", result),
+			slog.Time("scheduled_time", scheduled),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// safeRun runs the task function and recovers the panic, so a panic in a run doesn't crash the program.
+func (s *ScheduledTask) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errPanic, r)
+		}
+	}()
+	return s.fn(Context{
+		Ctx:            ctx,
+		Logger:         s.iCtx.Logger,
+		Meter:          s.iCtx.Meter,
+		Tracer:         s.iCtx.Tracer,
+		MeterProvider:  s.iCtx.MeterProvider,
+		TracerProvider: s.iCtx.TracerProvider,
+		HealthNotifier: s.iCtx.HealthNotifier,
+	})
+}
+
+// scheduledTaskMetrics is the metrics of the scheduled task runs.
+type scheduledTaskMetrics struct {
+	// runs counts the runs by their result, including the skipped runs.
+	runs        metric.Int64Counter
+	runDuration metric.Float64Histogram
+}
+
+func newScheduledTaskMetrics(meter metric.Meter) (*scheduledTaskMetrics, error) {
+	var (
+		m   scheduledTaskMetrics
+		err error
+		e   error
+	)
+	m.runs, e = meter.Int64Counter(
+		"srun.scheduled_task.runs",
+		metric.WithDescription("The number of scheduled task runs by their result."),
+	)
+	err = errors.Join(err, e)
+	m.runDuration, e = meter.Float64Histogram(
+		"srun.scheduled_task.run.duration",
+		metric.WithDescription("The duration of scheduled task runs."),
+		metric.WithUnit("s"),
+	)
+	err = errors.Join(err, e)
+	return &m, err
+}
+
+func (m *scheduledTaskMetrics) recordRun(name, result string, start time.Time) {
+	if m == nil {
+		return
+	}
+	opt := serviceAttributes(name, attribute.String("result", result))
+	m.runs.Add(context.Background(), 1, opt)
+	m.runDuration.Record(context.Background(), time.Since(start).Seconds(), opt)
+}
+
+func (m *scheduledTaskMetrics) recordSkipped(name string) {
+	if m == nil {
+		return
+	}
+	m.runs.Add(context.Background(), 1, serviceAttributes(name, attribute.String("result", "skipped")))
+}
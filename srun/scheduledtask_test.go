@@ -0,0 +1,363 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScheduledTaskOverlap(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		policy OverlapPolicy
+		// expectConcurrent is the maximum number of concurrent runs, and expectRuns is the number of runs after three
+		// activations while the first run is still running.
+		expectConcurrent int32
+		expectRuns       int32
+	}{
+		{policy: OverlapSkip, expectConcurrent: 1, expectRuns: 1},
+		{policy: OverlapQueue, expectConcurrent: 1, expectRuns: 3},
+		{policy: OverlapAllow, expectConcurrent: 3, expectRuns: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			t.Parallel()
+
+			var running, maxRunning, runs atomic.Int32
+			releaseC := make(chan struct{})
+			task, err := NewScheduledTask("overlap", Every(time.Hour), func(ctx Context) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					current := maxRunning.Load()
+					if n <= current || maxRunning.CompareAndSwap(current, n) {
+						break
+					}
+				}
+				runs.Add(1)
+				<-releaseC
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			task.SetOverlapPolicy(test.policy)
+			if err := task.Init(Context{}); err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Now()
+			for i := 0; i < 3; i++ {
+				task.trigger(context.Background(), now.Add(time.Duration(i)*time.Hour))
+			}
+			waitUntil(t, "the runs to start", func() bool {
+				return maxRunning.Load() == test.expectConcurrent
+			})
+			close(releaseC)
+			task.wg.Wait()
+
+			if got := maxRunning.Load(); got != test.expectConcurrent {
+				t.Fatalf("expecting %d concurrent runs but got %d", test.expectConcurrent, got)
+			}
+			if got := runs.Load(); got != test.expectRuns {
+				t.Fatalf("expecting %d runs but got %d", test.expectRuns, got)
+			}
+		})
+	}
+}
+
+func TestScheduledTaskCatchUp(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		policy   CatchUpPolicy
+		interval time.Duration
+		// lastRunAgo is the duration since the last run, while expectFirst and expectLast are the range of the activations
+		// after the last run expected to be caught-up.
+		lastRunAgo  time.Duration
+		expectFirst int
+		expectLast  int
+	}{
+		{
+			// The last run is five and a half hours ago, so five hourly runs are missed.
+			name:       "skip",
+			policy:     CatchUpSkip,
+			interval:   time.Hour,
+			lastRunAgo: time.Hour*5 + time.Minute*30,
+		},
+		{
+			name:        "once",
+			policy:      CatchUpOnce,
+			interval:    time.Hour,
+			lastRunAgo:  time.Hour*5 + time.Minute*30,
+			expectFirst: 5,
+			expectLast:  5,
+		},
+		{
+			name:        "all",
+			policy:      CatchUpAll,
+			interval:    time.Hour,
+			lastRunAgo:  time.Hour*5 + time.Minute*30,
+			expectFirst: 1,
+			expectLast:  5,
+		},
+		{
+			// The last run is a day ago, so there are more minutely runs missed than the catch-up limit.
+			name:        "once beyond the limit",
+			policy:      CatchUpOnce,
+			interval:    time.Minute,
+			lastRunAgo:  time.Hour*24 + time.Second*30,
+			expectFirst: 1440,
+			expectLast:  1440,
+		},
+		{
+			name:        "all beyond the limit",
+			policy:      CatchUpAll,
+			interval:    time.Minute,
+			lastRunAgo:  time.Hour*24 + time.Second*30,
+			expectFirst: 1440 - scheduledTaskMaxCatchUpRuns + 1,
+			expectLast:  1440,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			lastRun := time.Now().Add(-test.lastRunAgo)
+			var expect []time.Time
+			for i := test.expectFirst; i > 0 && i <= test.expectLast; i++ {
+				expect = append(expect, lastRun.Add(time.Duration(i)*test.interval).Truncate(time.Second))
+			}
+
+			var (
+				mu        sync.Mutex
+				scheduled []time.Time
+			)
+			task, err := NewScheduledTask("catch-up", Every(test.interval), func(ctx Context) error {
+				st, ok := ScheduledTime(ctx.Ctx)
+				if !ok {
+					return errors.New("scheduled time not found")
+				}
+				mu.Lock()
+				scheduled = append(scheduled, st)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Allow the runs to overlap as the queue can't hold all of the missed runs, so the order of the runs is not
+			// guaranteed.
+			task.SetOverlapPolicy(OverlapAllow)
+			task.SetCatchUpPolicy(test.policy, func(ctx context.Context) (time.Time, error) {
+				return lastRun, nil
+			})
+			if err := task.Init(Context{}); err != nil {
+				t.Fatal(err)
+			}
+			errC := make(chan error, 1)
+			go func() {
+				errC <- task.Run(context.Background())
+			}()
+			if err := task.Ready(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			waitUntil(t, "the missed runs", func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(scheduled) == len(expect)
+			})
+			if err := task.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errC; err != nil {
+				t.Fatal(err)
+			}
+			slices.SortFunc(scheduled, func(a, b time.Time) int {
+				return a.Compare(b)
+			})
+			if diff := cmp.Diff(expect, scheduled); diff != "" {
+				t.Fatalf("(-want/+got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("stop waits for the caught-up run", func(t *testing.T) {
+		t.Parallel()
+
+		startedC := make(chan struct{})
+		errC := make(chan error, 1)
+		task, err := NewScheduledTask("catch-up", Every(time.Hour), func(ctx Context) error {
+			close(startedC)
+			// Keep running after the stop is started, the run must not be cancelled before the stop deadline.
+			time.Sleep(time.Millisecond * 300)
+			errC <- ctx.Ctx.Err()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.SetCatchUpPolicy(CatchUpOnce, func(ctx context.Context) (time.Time, error) {
+			return time.Now().Add(-time.Hour * 2), nil
+		})
+		if err := task.Init(Context{}); err != nil {
+			t.Fatal(err)
+		}
+		runErrC := make(chan error, 1)
+		go func() {
+			runErrC <- task.Run(context.Background())
+		}()
+		<-startedC
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		if err := task.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-runErrC; err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errC; err != nil {
+			t.Fatalf("expecting the caught-up run to finish before cancelled, but got %v", err)
+		}
+	})
+
+	t.Run("stop while looking-up the last run", func(t *testing.T) {
+		t.Parallel()
+
+		lookupC := make(chan struct{})
+		task, err := NewScheduledTask("catch-up", Every(time.Hour), func(ctx Context) error {
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.SetCatchUpPolicy(CatchUpOnce, func(ctx context.Context) (time.Time, error) {
+			close(lookupC)
+			<-ctx.Done()
+			return time.Time{}, ctx.Err()
+		})
+		if err := task.Init(Context{}); err != nil {
+			t.Fatal(err)
+		}
+		errC := make(chan error, 1)
+		go func() {
+			errC <- task.Run(context.Background())
+		}()
+		<-lookupC
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		start := time.Now()
+		if err := task.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errC; err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expecting the last run lookup to be cancelled on stop, but stopped in %s", elapsed)
+		}
+	})
+}
+
+func TestScheduledTaskStop(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// runDuration is how long the run ignores the cancellation of its context.
+		runDuration time.Duration
+		expectErr   error
+	}{
+		{name: "in-flight run finished", runDuration: time.Millisecond * 50},
+		{name: "stop deadline exceeded", runDuration: time.Second, expectErr: errScheduledTaskStopDeadline},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			startedC := make(chan struct{}, 1)
+			task, err := NewScheduledTask("stop", Every(time.Millisecond*10), func(ctx Context) error {
+				select {
+				case startedC <- struct{}{}:
+				default:
+				}
+				time.Sleep(test.runDuration)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := task.Init(Context{}); err != nil {
+				t.Fatal(err)
+			}
+			errC := make(chan error, 1)
+			go func() {
+				errC <- task.Run(context.Background())
+			}()
+			<-startedC
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+			defer cancel()
+			if err := task.Stop(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errC; !errors.Is(err, test.expectErr) {
+				t.Fatalf("expecting error %v but got %v", test.expectErr, err)
+			}
+			// Stopping the stopped task returns immediately.
+			if err := task.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestScheduledTaskRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	errC := make(chan error, 1)
+	task, err := NewScheduledTask("timeout", Every(time.Millisecond*10), func(ctx Context) error {
+		<-ctx.Ctx.Done()
+		select {
+		case errC <- ctx.Ctx.Err():
+		default:
+		}
+		return ctx.Ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.SetRunTimeout(time.Millisecond * 20)
+
+	r := New(Config{
+		Name:             "testing_scheduled_task",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Millisecond * 500,
+	})
+	err = r.Run(func(ctx context.Context, runner ServiceRunner) error {
+		return runner.Register(task)
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+	select {
+	case err := <-errC:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expecting error %v but got %v", context.DeadlineExceeded, err)
+		}
+	default:
+		t.Fatal("expecting the run to be timed out")
+	}
+}
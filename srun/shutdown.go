@@ -0,0 +1,174 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const telemetryShutdownDefaultTimeout = time.Second * 30
+
+// ShutdownPhase defines when a service is stopped in the shutdown process. The runner stops the services phase by phase, and
+// the next phase only starts after all services in the previous phase are stopped.
+type ShutdownPhase int
+
+const (
+	// ShutdownPhaseDefault is the phase of services that don't define their shutdown phase, for example the background
+	// workers and the resource controllers.
+	ShutdownPhaseDefault ShutdownPhase = iota
+	// ShutdownPhaseIngress is the phase of services that receive traffic from outside of the program, for example http and
+	// gRPC servers. The services are stopped first to prevent incoming traffic before the other services are stopped.
+	ShutdownPhaseIngress
+	// ShutdownPhaseTelemetry is the phase of services that send the telemetry data of the program. The services are stopped
+	// last with their own timeout, so the telemetry data of the whole shutdown process can still be flushed even though the
+	// graceful period is already passed.
+	ShutdownPhaseTelemetry
+)
+
+// shutdownPhases is the order of the shutdown phases.
+var shutdownPhases = []ShutdownPhase{
+	ShutdownPhaseIngress,
+	ShutdownPhaseDefault,
+	ShutdownPhaseTelemetry,
+}
+
+func (s ShutdownPhase) String() string {
+	switch s {
+	case ShutdownPhaseDefault:
+		return "DEFAULT"
+	case ShutdownPhaseIngress:
+		return "INGRESS"
+	case ShutdownPhaseTelemetry:
+		return "TELEMETRY"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ServiceShutdownPhaseAware defines the shutdown phase of a service. Services that don't implement the interface are stopped
+// in ShutdownPhaseDefault.
+//
+// Inside a phase, the services are still stopped by following the reverse of the dependency graph. But the phase always takes
+// precedence, so a service in ShutdownPhaseIngress is stopped before the services it depends on in other phases.
+type ServiceShutdownPhaseAware interface {
+	ShutdownPhase() ShutdownPhase
+}
+
+// ServiceStopTimeoutAware defines the maximum duration for a service to stop. The runner stops waiting for the service once the
+// timeout is reached and continue to stop the other services, so a slow service doesn't consume the time of the other services.
+//
+// The timeout is bounded by the timeout of the shutdown phase, which is ShutdownGracefulPeriod for ShutdownPhaseIngress and
+// ShutdownPhaseDefault, and TelemetryShutdownTimeout for ShutdownPhaseTelemetry.
+type ServiceStopTimeoutAware interface {
+	StopTimeout() time.Duration
+}
+
+// stopServices stops all the services phase by phase. The ingress and default phases share the graceful period, while the
+// telemetry phase always has its own timeout. The cause is used to cancel the run context of the services.
+func (r *Runner) stopServices(graph *serviceGraph, cause error) error {
+	ctxGraceful, cancelGraceful := context.WithTimeout(context.Background(), r.config.Timeout.ShutdownGracefulPeriod)
+	defer cancelGraceful()
+
+	var err error
+	start := time.Now()
+	for _, phase := range shutdownPhases {
+		ctx, errTimeout := ctxGraceful, errGracefulPeriodTimeout
+		if phase == ShutdownPhaseTelemetry {
+			// Record the shutdown duration before the telemetry services are stopped, so the metric is still exported.
+			r.metrics.recordShutdown(start)
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(context.Background(), r.config.Timeout.TelemetryShutdownTimeout)
+			defer cancel()
+			errTimeout = errTelemetryShutdownTimeout
+		}
+		// Skip the phase if the graceful period is already passed in the previous phase, the error is already recorded. The
+		// run context of the services is still cancelled, so the services have the chance to exit.
+		if ctx.Err() != nil {
+			r.cancelRuns(phase, cause)
+			continue
+		}
+
+		stopErrC := make(chan error, 1)
+		// Stop the services by following the reverse of the dependency graph because we don't want to kill the services
+		// randomly. A service will only be stopped after all services that depend on it are stopped.
+		go func() {
+			stopErrC <- graph.walk(ctx, true, false, func(ctx context.Context, svc *ServiceStateTracker) error {
+				if svc.shutdownPhase() != phase {
+					return nil
+				}
+				return r.stopService(ctx, svc, cause)
+			})
+		}()
+		select {
+		case <-ctx.Done():
+			r.logger.Error("Shutdown phase timeout reached", slog.String("shutdown_phase", phase.String()))
+			err = errors.Join(err, errTimeout)
+			// The services in the phase that are not stopped yet are skipped by the graph walk.
+			r.cancelRuns(phase, cause)
+		case errStop := <-stopErrC:
+			if errStop != nil {
+				err = errors.Join(err, errStop)
+			}
+		}
+	}
+	return err
+}
+
+// cancelRuns cancels the run context of all services in the phase without waiting for them to stop. It is used when the
+// services are not stopped because the timeout of the phase is reached.
+func (r *Runner) cancelRuns(phase ShutdownPhase, cause error) {
+	for _, svc := range r.services {
+		if svc.shutdownPhase() == phase && svc.cancelRun != nil {
+			svc.cancelRun(cause)
+		}
+	}
+}
+
+// stopService cancels the run context and stops the service with the stop timeout of the service. The function doesn't wait for
+// the service to be stopped once the timeout is reached.
+func (r *Runner) stopService(ctx context.Context, svc *ServiceStateTracker, cause error) error {
+	if svc.cancelRun != nil {
+		svc.cancelRun(cause)
+	}
+	if timeout, ok := svc.stopTimeout(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	defer r.metrics.recordStop(svc.Name(), start)
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- svc.Stop(ctx)
+	}()
+	select {
+	case <-ctx.Done():
+		r.logger.Error(fmt.Sprintf("[Service] %s: stop timeout reached", svc.Name()))
+		return fmt.Errorf("%w: %s", errServiceStopTimeout, svc.Name())
+	case err := <-errC:
+		return err
+	}
+}
+
+// shutdownPhase returns the shutdown phase of the service.
+func (s *ServiceStateTracker) shutdownPhase() ShutdownPhase {
+	sspa, ok := s.ServiceInitAware.(ServiceShutdownPhaseAware)
+	if !ok {
+		return ShutdownPhaseDefault
+	}
+	return sspa.ShutdownPhase()
+}
+
+// stopTimeout returns the stop timeout of the service, the timeout is only valid if it is more than zero.
+func (s *ServiceStateTracker) stopTimeout() (time.Duration, bool) {
+	ssta, ok := s.ServiceInitAware.(ServiceStopTimeoutAware)
+	if !ok {
+		return 0, false
+	}
+	timeout := ssta.StopTimeout()
+	return timeout, timeout > 0
+}
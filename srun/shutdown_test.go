@@ -0,0 +1,169 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestShutdownPhases(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		Name:             "testing_shutdown_phases",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second,
+	}
+
+	var (
+		mu      sync.Mutex
+		stopped []string
+	)
+	newTask := func(name string, phase ShutdownPhase) *LongRunningTask {
+		lrt := newLRT(t, name, func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			mu.Lock()
+			stopped = append(stopped, name)
+			mu.Unlock()
+			return nil
+		})
+		lrt.SetShutdownPhase(phase)
+		return lrt
+	}
+
+	err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+		// Register the services in the opposite order of the phases, so the services would be stopped in the wrong order
+		// without the shutdown phases.
+		return runner.Register(
+			newTask("ingress", ShutdownPhaseIngress),
+			newTask("worker", ShutdownPhaseDefault),
+			newTask("telemetry", ShutdownPhaseTelemetry),
+		)
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+	if diff := cmp.Diff([]string{"ingress", "worker", "telemetry"}, stopped); diff != "" {
+		t.Fatalf("(-want/+got)\n%s", diff)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		Name:             "testing_stop_timeout",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second,
+		Timeout: TimeoutConfig{
+			ShutdownGracefulPeriod:   time.Second * 3,
+			TelemetryShutdownTimeout: time.Second * 3,
+		},
+	}
+
+	t.Run("service stop timeout", func(t *testing.T) {
+		t.Parallel()
+
+		var workerStopped atomic.Bool
+		worker := newLRT(t, "worker", func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			workerStopped.Store(true)
+			return nil
+		})
+		slow := newLRT(t, "slow", func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			time.Sleep(time.Second * 5)
+			return nil
+		})
+		slow.SetStopTimeout(time.Millisecond * 500)
+
+		start := time.Now()
+		err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+			// The slow service is stopped first as it is registered last.
+			return runner.Register(worker, slow)
+		})
+		if errors.Is(err, errGracefulPeriodTimeout) {
+			t.Fatalf("expecting the slow service to not consume the graceful period, got %v", err)
+		}
+		if !workerStopped.Load() {
+			t.Fatal("expecting the worker to be stopped")
+		}
+		if elapsed := time.Since(start); elapsed > config.DeadlineDuration+config.Timeout.ShutdownGracefulPeriod {
+			t.Fatalf("expecting the slow service to be timed out, but run for %s", elapsed)
+		}
+	})
+
+	t.Run("telemetry flush window", func(t *testing.T) {
+		t.Parallel()
+
+		var flushed atomic.Bool
+		telemetry := newLRT(t, "telemetry", func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			// Simulate flushing the telemetry data.
+			time.Sleep(time.Millisecond * 500)
+			flushed.Store(true)
+			return nil
+		})
+		telemetry.SetShutdownPhase(ShutdownPhaseTelemetry)
+		slow := newLRT(t, "slow", func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			time.Sleep(time.Second * 5)
+			return nil
+		})
+
+		err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+			return runner.Register(telemetry, slow)
+		})
+		if !errors.Is(err, errGracefulPeriodTimeout) {
+			t.Fatalf("expecting error %v but got %v", errGracefulPeriodTimeout, err)
+		}
+		if !flushed.Load() {
+			t.Fatal("expecting the telemetry to be flushed after the graceful period is passed")
+		}
+	})
+
+	t.Run("skipped phase is cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		var workerCancelled, cancelledBeforeTelemetry atomic.Bool
+		// The slow ingress service consumes the whole graceful period, so the default phase is skipped.
+		slow := newLRT(t, "slow-ingress", func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			time.Sleep(time.Second * 5)
+			return nil
+		})
+		slow.SetShutdownPhase(ShutdownPhaseIngress)
+		worker := newLRT(t, "worker", func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			workerCancelled.Store(true)
+			return nil
+		})
+		telemetry := newLRT(t, "telemetry", func(ctx Context) error {
+			<-ctx.Ctx.Done()
+			// Give the worker the time to observe the cancellation.
+			time.Sleep(time.Millisecond * 100)
+			cancelledBeforeTelemetry.Store(workerCancelled.Load())
+			return nil
+		})
+		telemetry.SetShutdownPhase(ShutdownPhaseTelemetry)
+
+		err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+			return runner.Register(telemetry, worker, slow)
+		})
+		if !errors.Is(err, errGracefulPeriodTimeout) {
+			t.Fatalf("expecting error %v but got %v", errGracefulPeriodTimeout, err)
+		}
+		if !cancelledBeforeTelemetry.Load() {
+			t.Fatal("expecting the run context of the skipped phase to be cancelled before the telemetry phase")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package srun
+
+import (
+	"time"
+)
+
+// ServiceSnapshot is the point-in-time information of a service inside the runner. The snapshot is used to introspect the
+// state of the services in a live process.
+type ServiceSnapshot struct {
+	Name string `json:"name"`
+	// State is the lifecycle state of the service, for example INITIATING, RUNNING or SHUTTING DOWN.
+	State string `json:"state"`
+	// Types is the list of types of the service, for example internal or long_running.
+	Types []string `json:"types"`
+	// StartTime is the last time the service is being run. The start time is nil if the service is never run.
+	StartTime *time.Time `json:"start_time,omitempty"`
+	// LastError is the last error returned from the service Run.
+	LastError string `json:"last_error,omitempty"`
+	// Restarts is the number of restarts of the service based on its restart policy.
+	Restarts int `json:"restarts"`
+	// HealthStatus is the last known health status of the service. The status is empty if the service health is not tracked
+	// by the healthcheck service.
+	HealthStatus string `json:"health_status,omitempty"`
+	// HealthHistory is the latest healthcheck results of the service, ordered from the oldest result.
+	HealthHistory []HealthcheckResult `json:"health_history,omitempty"`
+	// UnhealthyNotReady is true when the service marks the program as not ready because of UnhealthyActionNotReady.
+	UnhealthyNotReady bool `json:"unhealthy_not_ready,omitempty"`
+	// Services is the snapshot of the services inside a service that wraps several services, for example ConcurrentServices.
+	Services []ServiceSnapshot `json:"services,omitempty"`
+}
+
+// Services returns the snapshot of all services registered to the runner, ordered by their registration.
+func (r *Runner) Services() []ServiceSnapshot {
+	r.servicesMu.RLock()
+	services := r.services
+	r.servicesMu.RUnlock()
+
+	snapshots := make([]ServiceSnapshot, len(services))
+	for idx, svc := range services {
+		snapshots[idx] = r.snapshot(svc)
+	}
+	return snapshots
+}
+
+func (r *Runner) snapshot(svc *ServiceStateTracker) ServiceSnapshot {
+	snapshot := svc.snapshot()
+	if r.healthcheckService != nil {
+		if status, ok := r.healthcheckService.status(svc.Name()); ok {
+			snapshot.HealthStatus = status.String()
+			snapshot.HealthHistory = r.healthcheckService.history(svc.Name())
+		}
+	}
+	if cs, ok := svc.ServiceInitAware.(*ConcurrentServices); ok {
+		for _, s := range cs.services {
+			snapshot.Services = append(snapshot.Services, r.snapshot(s))
+		}
+	}
+	return snapshot
+}
+
+// snapshot returns the snapshot of the service tracked by the tracker.
+func (s *ServiceStateTracker) snapshot() ServiceSnapshot {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+
+	snapshot := ServiceSnapshot{
+		Name:     s.Name(),
+		State:    s.state.String(),
+		Types:    make([]string, len(s.svcTypes)),
+		Restarts: s.restarts,
+
+		UnhealthyNotReady: s.unhealthyNotReady.Load(),
+	}
+	if !s.startTime.IsZero() {
+		startTime := s.startTime
+		snapshot.StartTime = &startTime
+	}
+	for idx, svcType := range s.svcTypes {
+		snapshot.Types[idx] = serviceTypeToString(svcType)
+	}
+	if s.lastErr != nil {
+		snapshot.LastError = s.lastErr.Error()
+	}
+	return snapshot
+}
@@ -0,0 +1,140 @@
+package srun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServicesSnapshot(t *testing.T) {
+	t.Parallel()
+
+	config := Config{
+		Name: "testing_snapshot",
+		Admin: AdminConfig{
+			AdminServerConfig: AdminServerConfig{
+				Address: ":8791",
+			},
+		},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second * 3,
+	}
+
+	type snapshotResult struct {
+		snapshots []ServiceSnapshot
+		response  struct {
+			Services []ServiceSnapshot `json:"services"`
+		}
+		err error
+	}
+	resultC := make(chan snapshotResult, 1)
+
+	err := New(config).Run(func(ctx context.Context, runner ServiceRunner) error {
+		return Serve("snapshot-task", runner, func(ctx Context) error {
+			// Wait until all services are running before taking the snapshot.
+			time.Sleep(time.Second)
+
+			var result snapshotResult
+			result.snapshots = runner.Services()
+
+			resp, err := http.Get("http://localhost:8791/services")
+			if err != nil {
+				result.err = err
+				resultC <- result
+				return nil
+			}
+			defer resp.Body.Close()
+			result.err = json.NewDecoder(resp.Body).Decode(&result.response)
+			resultC <- result
+
+			<-ctx.Ctx.Done()
+			return nil
+		})
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+
+	result := <-resultC
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+
+	check := func(t *testing.T, snapshots []ServiceSnapshot) {
+		t.Helper()
+		if len(snapshots) != 2 {
+			t.Fatalf("expecting 2 services but got %d", len(snapshots))
+		}
+		admin, task := snapshots[0], snapshots[1]
+		if admin.Name != "srun-http-admin-server" || admin.Types[0] != "internal" {
+			t.Fatalf("unexpected admin snapshot %+v", admin)
+		}
+		if task.Name != "snapshot-task" || task.State != serviceStateRunning.String() {
+			t.Fatalf("unexpected task snapshot %+v", task)
+		}
+		if len(task.Types) != 2 || task.Types[0] != "user" || task.Types[1] != "long_running" {
+			t.Fatalf("unexpected task types %v", task.Types)
+		}
+		if task.StartTime == nil || task.StartTime.IsZero() {
+			t.Fatal("expecting start time to be set")
+		}
+	}
+	t.Run("api", func(t *testing.T) {
+		check(t, result.snapshots)
+	})
+	t.Run("admin endpoint", func(t *testing.T) {
+		check(t, result.response.Services)
+	})
+}
+
+func TestServiceSnapshotLastError(t *testing.T) {
+	t.Parallel()
+
+	errRun := errors.New("run error")
+	tracker := newServiceStateTracker(&serviceDoNothing{
+		errC: make(chan error, 1),
+		onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
+			return errRun
+		},
+	}, slog.Default())
+	if err := tracker.Init(Context{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Run(context.Background()); !errors.Is(err, errRun) {
+		t.Fatalf("expecting error %v but got %v", errRun, err)
+	}
+
+	snapshot := tracker.snapshot()
+	if snapshot.State != serviceStateRunExited.String() {
+		t.Fatalf("expecting state %s but got %s", serviceStateRunExited, snapshot.State)
+	}
+	if snapshot.LastError != errRun.Error() {
+		t.Fatalf("expecting last error %s but got %s", errRun, snapshot.LastError)
+	}
+}
+
+func TestServiceSnapshotNeverRun(t *testing.T) {
+	t.Parallel()
+
+	tracker := newServiceStateTracker(&serviceDoNothing{errC: make(chan error, 1)}, slog.Default())
+	snapshot := tracker.snapshot()
+	if snapshot.StartTime != nil {
+		t.Fatalf("expecting no start time but got %s", snapshot.StartTime)
+	}
+	out, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["start_time"]; ok {
+		t.Fatalf("expecting start_time to be omitted but got %s", out)
+	}
+}
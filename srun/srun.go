@@ -9,7 +9,9 @@ import (
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -37,6 +39,7 @@ const (
 	runnerStateRunning
 	runnerStateShuttingDown
 	runnerStateStopped
+	runnerStateDraining
 )
 
 func runnerStateToString(state int32) string {
@@ -53,6 +56,8 @@ func runnerStateToString(state int32) string {
 		return "SHUTTING_DOWN"
 	case runnerStateStopped:
 		return "STOPPED"
+	case runnerStateDraining:
+		return "DRAINING"
 	default:
 		return "UNKNOWN_STATE"
 	}
@@ -97,12 +102,43 @@ const (
 	serviceTypeUser
 )
 
+func serviceTypeToString(svcType int) string {
+	switch svcType {
+	case serviceTypeInternal:
+		return "internal"
+	case serviceTypeLongRunning:
+		return "long_running"
+	case serviceTypeConcurrent:
+		return "concurrent"
+	case serviceTypeUser:
+		return "user"
+	default:
+		return "unknown"
+	}
+}
+
+// serviceTypesOf returns the types of the service based on the concrete type of the service.
+func serviceTypesOf(svc ServiceInitAware, owner int) []int {
+	svcTypes := []int{owner}
+	switch svc.(type) {
+	case *LongRunningTask:
+		svcTypes = append(svcTypes, serviceTypeLongRunning)
+	case *ConcurrentServices:
+		svcTypes = append(svcTypes, serviceTypeConcurrent)
+	}
+	return svcTypes
+}
+
 var (
 	// errReceivingExitSignal being thrown when the signal.Notify receives a signal of termination/interrupt.
 	errReceivingExitSginal         = errors.New("receiving exit signal")
 	errServiceRunnerAlreadyRunning = errors.New("service runner is already running")
 	errServiceShuttingDown         = errors.New("service is in shutting down state")
 	errGracefulPeriodTimeout       = errors.New("graceful-period timeout")
+	// errTelemetryShutdownTimeout thrown when the telemetry services are not stopped within the telemetry shutdown timeout.
+	errTelemetryShutdownTimeout = errors.New("telemetry shutdown timeout")
+	// errServiceStopTimeout thrown when a service is not stopped within its stop timeout.
+	errServiceStopTimeout = errors.New("service stop timeout reached")
 	// errRunDeadlineTimeout being thrown when 'SRUN_DEADLINE' is being set and the runner has run beyond the deadline duration.
 	errRunDeadlineTimeout = errors.New("run deadline timeout reached")
 	// errServiceInitTimeout is the timeout for initing the service.
@@ -123,6 +159,10 @@ var (
 	errUnhealthyService  = errors.New("healthcheck: service is not healthy")
 	errInvalidStateOrder = errors.New("service is not in a desired state")
 	errAllServicesExited = errors.New("all services exited")
+	// errServiceDependencyCycle is thrown when the dependencies between services forming a cycle.
+	errServiceDependencyCycle = errors.New("service dependency cycle detected")
+	// errServiceDependencyNotFound is thrown when a service depends on a service that is not registered to the runner.
+	errServiceDependencyNotFound = errors.New("service dependency not found")
 )
 
 // Context holds runner context including all objects that belong to the runner. For example we can pass logger and otel meter
@@ -136,6 +176,10 @@ type Context struct {
 	// You need to pass/inject the meter object to another function/struct to use this meter.
 	Meter  metric.Meter
 	Tracer trace.Tracer
+	// MeterProvider and TracerProvider are the open telemetry providers of the Meter and Tracer. The providers can be used to
+	// create additional named meters and tracers, or to be passed to the third-party instrumentation libraries.
+	MeterProvider  metric.MeterProvider
+	TracerProvider trace.TracerProvider
 	// HealthNotifier is the healthcheck notifier to notify the health check service about the current status of the service.
 	//
 	// Please NOTE that the notifier will always be nil for ServiceInitAware as we don't track the state of init aware service thus
@@ -180,6 +224,8 @@ type RunInfo interface {
 // ServiceUpgraderAware defines service that aware with the existence of an upgrader in the service runner.
 // The service then delegates the setup of net.Listener to the upgrader because the upgrader need to pass all
 // file descriptors to the new process.
+//
+// Please use ServiceListenersAware if the service requires multiple listeners or packet connections.
 type ServiceUpgraderAware interface {
 	RequiredListener() (network, addr string)
 	RegisterListener(listener net.Listener)
@@ -206,6 +252,8 @@ type ServiceRunner interface {
 	Register(services ...ServiceRunnerAware) error
 	Context() Context
 	Admin() AdminItf
+	// Services returns the snapshot of all services registered to the runner.
+	Services() []ServiceSnapshot
 }
 
 // Registrar implements ServiceRunner.
@@ -224,6 +272,11 @@ func (r *Registrar) Context() Context {
 	return r.context
 }
 
+// Services returns the snapshot of all services registered to the runner.
+func (r *Registrar) Services() []ServiceSnapshot {
+	return r.runner.Services()
+}
+
 // Admin returns AdminItf interface because we want to reuse the adminHTTPServer struct and use it
 // externally.
 func (r *Registrar) Admin() AdminItf {
@@ -241,9 +294,11 @@ func newRegistrar(r *Runner) *Registrar {
 		context: Context{
 			// Assign a new logger from the default logger(we have configured this before), so each logger will have default attributes
 			// called 'logger_scope' to tell the scope of the logger.
-			Logger: slog.Default().With(slog.String("logger_scope", r.config.Name)),
-			Meter:  r.otelMeter,
-			Tracer: r.otelTracer,
+			Logger:         slog.Default().With(slog.String("logger_scope", r.config.Name)),
+			Meter:          r.otelMeter,
+			Tracer:         r.otelTracer,
+			MeterProvider:  r.otelMeterProvider,
+			TracerProvider: r.otelTracerProvider,
 		},
 	}
 }
@@ -255,14 +310,23 @@ type Runner struct {
 	// state is the current state of runner.
 	state int32
 	// Services is the list of objects that can be controlled by the runner.
-	services []*ServiceStateTracker
+	services   []*ServiceStateTracker
+	servicesMu sync.RWMutex
 
 	ctx context.Context
 	// logger is the default slog.Logger with group for runner. We will use this logger
 	// to log instead of the global slog.
 	logger *slog.Logger
+	// logLevels controls the level of the default logger in runtime.
+	logLevels *logLevelController
+	// logFiles is the list of log files of the logger sinks, the files are reopened when the program receives the reopen signal.
+	logFiles []*logFile
 	// upgrader instance to allow the program to self-upgrade using cloudflare/tableflip.
 	upgrader *upgrader
+	// reloader holds the state of the configuration reload.
+	reloader configReloader
+	// systemd is the integration with systemd, it is nil if the program is not started by systemd.
+	systemd *systemd
 	// adminServer instance to allow the program to expose several important endpoints for program diagnostics.
 	adminServer *adminHTTPServer
 
@@ -270,8 +334,15 @@ type Runner struct {
 	otelTracer trace.Tracer
 	// otelMeter is open telemetry meter instance to collect metrics in application.
 	otelMeter metric.Meter
+	// otelMeterProvider and otelTracerProvider are the providers of otelMeter and otelTracer.
+	otelMeterProvider  metric.MeterProvider
+	otelTracerProvider trace.TracerProvider
 	// healthcheckService provide healthchecks for all services and multiplex the check notification.
 	healthcheckService *HealthcheckService
+	// shutdown gracefully shuts down the program with the cause, the function is set when the runner is running.
+	shutdown context.CancelCauseFunc
+	// metrics is the lifecycle metrics of the runner and its services.
+	metrics *runnerMetrics
 }
 
 // Error is a helper function that returns functions that satisfy srun.Run. The helper function can be used to easily wrap an error when
@@ -304,33 +375,57 @@ func New(config Config) *Runner {
 	if err := conf.Validate(); err != nil {
 		panic(err)
 	}
-	setDefaultSlog(conf.Logger)
+	logLevels, logFiles, err := setDefaultSlog(conf.Logger)
+	if err != nil {
+		panic(err)
+	}
 
 	var (
 		upg *upgrader
-		err error
 		ctx = context.Background()
 	)
+	sd, err := newSystemd(config.Systemd, os.Getenv)
+	if err != nil {
+		panic(err)
+	}
 
 	if config.Upgrader.SelfUpgrade {
-		pidFile := fmt.Sprintf("%s.pid", config.Name)
-		upg, err = newUpgrader(pidFile, syscall.SIGHUP)
+		pidFile := config.Upgrader.PIDFileName
+		if pidFile == "" {
+			pidFile = fmt.Sprintf("%s.pid", config.Name)
+		}
+		upg, err = newUpgrader(pidFile, conf.Upgrader.Timeout, syscall.SIGHUP)
 		if err != nil {
 			panic(err)
 		}
+		upg.systemd = sd
 		// Use the upgrader context as the base context, so if the upgrade exits, the runner will
 		// also exit.
 		ctx = upg.Context()
 	}
 
-	meter, meterLrt, err := newOtelMetricMeterAndProviderService(config.OtelMetric)
+	// Pass the program information to the open telemetry, so the telemetry data is identified with the program.
+	config.OtelMetric.serviceName, config.OtelMetric.serviceVersion = config.Name, config.Version
+	config.OtelTracer.serviceName, config.OtelTracer.serviceVersion = config.Name, config.Version
+	// Load the metric exporters from the environment variables as the admin server needs to know whether the prometheus
+	// exporter is used.
+	if !config.OtelMetric.Disable {
+		if err := config.OtelMetric.loadEnv(os.Getenv); err != nil {
+			panic(err)
+		}
+		conf.Admin.AdminServerConfig.prometheusHandlerDisabled = !config.OtelMetric.prometheusEnabled()
+	}
+	meter, meterProvider, meterLrt, err := newOtelMetricMeterAndProviderService(config.OtelMetric, config.Timeout.TelemetryShutdownTimeout)
 	if err != nil {
 		panic(err)
 	}
-	tracer, tracerLrt, err := newOTelTracerService(config.OtelTracer)
+	tracer, tracerProvider, tracerLrt, err := newOTelTracerService(config.OtelTracer, config.Timeout.TelemetryShutdownTimeout)
 	if err != nil {
 		panic(err)
 	}
+	if config.RegisterOtelGlobal {
+		registerOtelGlobal(tracerProvider, meterProvider)
+	}
 
 	r := &Runner{
 		serviceName: config.Name,
@@ -338,10 +433,31 @@ func New(config Config) *Runner {
 		ctx:         ctx,
 		// Assign a new logger from the default logger(we have configured this before), so each logger will have default attributes
 		// called 'logger_scope' to tell the scope of the logger.
-		logger:     slog.Default().With(slog.String("logger_scope", "service_runner")),
-		upgrader:   upg,
-		otelMeter:  meter,
-		otelTracer: tracer,
+		logger:             slog.Default().With(slog.String("logger_scope", "service_runner")),
+		logLevels:          logLevels,
+		logFiles:           logFiles,
+		upgrader:           upg,
+		systemd:            sd,
+		otelMeter:          meter,
+		otelMeterProvider:  meterProvider,
+		otelTracer:         tracer,
+		otelTracerProvider: tracerProvider,
+	}
+	r.reloader.config = conf.Reload.Config
+	r.metrics, err = newRunnerMetrics(meter)
+	if err != nil {
+		panic(err)
+	}
+	if upg != nil {
+		upg.metrics = r.metrics
+	}
+	if sd != nil {
+		sd.logger = r.logger
+	}
+	if !config.OtelMetric.Disable && !config.OtelMetric.DisableRuntimeMetrics {
+		if err := registerRuntimeMetrics(meter); err != nil {
+			panic(err)
+		}
 	}
 	if err := r.registerDefaultServices(tracerLrt, meterLrt); err != nil {
 		panic(err)
@@ -355,6 +471,25 @@ func (r *Runner) register(services ...ServiceRunnerAware) error {
 		return errors.New("register called with no service provided")
 	}
 
+	// Wrap ALL services using ServiceState tracker as we need to track the status/state of all services.
+	trackers := make([]*ServiceStateTracker, len(services))
+	for idx, svc := range services {
+		if sra, ok := svc.(ServiceRestartAware); ok {
+			policy := sra.RestartPolicy()
+			if err := policy.validate(); err != nil {
+				return fmt.Errorf("service %s: %w", svc.Name(), err)
+			}
+		}
+		trackers[idx] = newServiceStateTracker(svc, r.logger)
+		trackers[idx].metrics = r.metrics
+		trackers[idx].svcTypes = serviceTypesOf(svc, serviceTypeUser)
+	}
+	// Check the dependencies of the services before doing anything else, so we can detect cycle as early as possible. The
+	// missing dependencies are allowed here because they might be registered later, and we will check them again before run.
+	if _, err := newServiceGraph(append(slices.Clip(r.services), trackers...), true); err != nil {
+		return err
+	}
+
 	for _, svc := range services {
 		// Register the service to the healthcheck service so it is aware of the number of services and consumers.
 		if r.healthcheckService != nil {
@@ -364,12 +499,12 @@ func (r *Runner) register(services ...ServiceRunnerAware) error {
 		}
 		// Check if the upgrader is initiated and service is upgrade aware. We need to override the service so we could pass listener that
 		// created by the upgrader.
+		upgradeAware, ok := svc.(ServiceUpgraderAware)
+		if !ok {
+			continue
+		}
+		network, addr := upgradeAware.RequiredListener()
 		if r.upgrader != nil {
-			upgradeAware, ok := svc.(ServiceUpgraderAware)
-			if !ok {
-				continue
-			}
-			network, addr := upgradeAware.RequiredListener()
 			listener, err := r.upgrader.createListener(network, addr)
 			if err != nil {
 				return err
@@ -377,13 +512,30 @@ func (r *Runner) register(services ...ServiceRunnerAware) error {
 			// Put the created listener from the upgrader to the service. This way, we can transfer the listener file descriptor
 			// of the service when upgrade happen.
 			upgradeAware.RegisterListener(listener)
+			continue
+		}
+		// Without the upgrader, only pass the listener if systemd passes the socket to the program. Otherwise, the service
+		// creates the listener by itself.
+		if listener, ok := r.systemd.activatedListener(network, addr); ok {
+			upgradeAware.RegisterListener(listener)
 		}
-		// Wrap ALL services using ServiceState tracker as we need to track the status/state of all services.
-		r.services = append(r.services, newServiceStateTracker(svc, r.logger))
 	}
+	r.servicesMu.Lock()
+	r.services = append(r.services, trackers...)
+	r.servicesMu.Unlock()
 	return nil
 }
 
+// registerInternal registers the services that owned by the runner. The internal services are always at the bottom of the stack.
+func (r *Runner) registerInternal(svc ServiceRunnerAware) {
+	tracker := newServiceStateTracker(svc, r.logger)
+	tracker.svcTypes = serviceTypesOf(svc, serviceTypeInternal)
+	tracker.metrics = r.metrics
+	r.servicesMu.Lock()
+	r.services = append(r.services, tracker)
+	r.servicesMu.Unlock()
+}
+
 func (r *Runner) registerDefaultServices(otelTracerProvider, otelMeterProvider *LongRunningTask) error {
 	var err error
 	// If the length of the admin configuration is not disabled, then we should always register
@@ -400,26 +552,64 @@ func (r *Runner) registerDefaultServices(otelTracerProvider, otelMeterProvider *
 		if err != nil {
 			return err
 		}
+		adminServer.setServicesFunc(r.Services)
+		adminServer.setProbeReportFuncs(r.readinessReport, r.livenessReport)
+		adminServer.setReadinessGateFunc(r.readinessGate)
+		adminServer.setLogLevelController(r.logLevels)
+		if r.upgrader != nil {
+			adminServer.setUpgrader(r.upgrader)
+		}
 		r.adminServer = adminServer
-		r.services = append(r.services, newServiceStateTracker(adminServer, r.logger))
+		r.registerInternal(adminServer)
 	}
 	// If the healthcheck is not disabled, then we should spawn a healthcheck service.
 	if r.config.Healthcheck.Enabled {
 		hcs := newHealthcheckService(r.config.Healthcheck)
-		r.services = append(r.services, newServiceStateTracker(hcs, r.logger))
+		hcs.actions = r
+		r.registerInternal(hcs)
 		r.healthcheckService = hcs
+		if r.adminServer != nil {
+			r.adminServer.setHealthHistoryFunc(hcs.transitionHistory)
+		}
 	}
 	// If the opentelemetry is not disabled, then start the open telemetry process using the long running task.
 	if otelTracerProvider != nil {
-		r.services = append(r.services, newServiceStateTracker(otelTracerProvider, r.logger))
+		r.registerInternal(otelTracerProvider)
 	}
 	// If the metric provider is not nil then we should listen to the shutdown event and shutdown the provider properly.
 	if otelMeterProvider != nil {
-		r.services = append(r.services, newServiceStateTracker(otelMeterProvider, r.logger))
+		r.registerInternal(otelMeterProvider)
+	}
+	// Reopen the log files on signal, so the log files can be rotated by external tools.
+	if len(r.logFiles) > 0 {
+		var logFileReopener *LongRunningTask
+		logFileReopener, err = newLogFileReopenService(r.logFiles, r.config.Logger.ReopenSignal)
+		if err != nil {
+			return err
+		}
+		r.registerInternal(logFileReopener)
+	}
+	// Reload the configuration on signal or file changes if the configuration loader is set.
+	if r.config.Reload.Load != nil {
+		var configReloader *LongRunningTask
+		configReloader, err = r.newConfigReloadService()
+		if err != nil {
+			return err
+		}
+		r.registerInternal(configReloader)
+	}
+	// Notify systemd periodically if the systemd watchdog is enabled for the program.
+	if r.systemd != nil && r.systemd.watchdogInterval > 0 {
+		var watchdog *LongRunningTask
+		watchdog, err = r.newSystemdWatchdogService()
+		if err != nil {
+			return err
+		}
+		r.registerInternal(watchdog)
 	}
 	// Listen to the upgrader to upgrade the binary using SIGHUP.
 	if r.upgrader != nil {
-		r.services = append(r.services, newServiceStateTracker(r.upgrader, r.logger))
+		r.registerInternal(r.upgrader)
 	}
 	return err
 }
@@ -429,13 +619,14 @@ func (r *Runner) registerDefaultServices(otelTracerProvider, otelMeterProvider *
 // Please NOTE that the run function should not block, otherwise  the runner can't execute other services that registered in the runner.
 func (r *Runner) Run(run func(ctx context.Context, runner ServiceRunner) error) (returnedErr error) {
 	r.logger.Info(fmt.Sprintf("Running program: %s", r.serviceName))
-	var (
-		readyTimeout            = r.config.Timeout.ReadyTimeout
-		gracefulShutdownTimeout = r.config.Timeout.ShutdownGracefulPeriod
-	)
 
+	atomic.StoreInt32(&r.state, runnerStateInitiating)
 	// Set the state of the service runner to run/not running and catch panic to enrich the error.
 	defer func() {
+		atomic.StoreInt32(&r.state, runnerStateStopped)
+		// Ensure all metrics are pushed before the runner exits, as a short-lived program might never be scraped.
+		r.flushOtelMetric()
+
 		var stackTrace []byte
 		v := recover()
 		if v != nil {
@@ -478,6 +669,7 @@ func (r *Runner) Run(run func(ctx context.Context, runner ServiceRunner) error)
 	// Create a context signal to catch interupt/termination signal for the program. And use the context as the parent context for everything.
 	ctxSignal, ctxSignalCancel := context.WithCancelCause(parentCtx)
 	defer ctxSignalCancel(nil)
+	r.shutdown = ctxSignalCancel
 	signalC := make(chan os.Signal, 1)
 	signal.Notify(
 		signalC,
@@ -504,10 +696,23 @@ func (r *Runner) Run(run func(ctx context.Context, runner ServiceRunner) error)
 		return nil
 	}
 
+	// Build the dependency graph of the services. We are checking the graph again here because the missing dependencies
+	// are allowed when the services are registered.
+	graph, err := newServiceGraph(r.services, false)
+	if err != nil {
+		returnedErr = err
+		return
+	}
+
+	// Run the services with a context that is not cancelled by the exit signal. The run context of each service is cancelled
+	// when the service is stopped, so the services are still serving while the program is draining.
+	ctxService, ctxServiceCancel := context.WithCancelCause(context.WithoutCancel(ctxSignal))
+	defer ctxServiceCancel(nil)
+
 	runErrC := make(chan error, len(r.services))
-	// Start the service with FIFO, as we want to ensure the service at the bottom of the stack will be always
-	// ready to start. For example, this behavior is beneficial when we start http/gRPC server after we are
-	// connected to all dependencies.
+	// Start the services by following the dependency graph, as we want to ensure the service at the bottom of the stack will be always
+	// ready to start. For services without declared dependencies, this means the services are started with FIFO. For example, this
+	// behavior is beneficial when we start http/gRPC server after we are connected to all dependencies.
 	//
 	// Imagine the services stack looked like this:
 	//	|-------------------|
@@ -517,90 +722,30 @@ func (r *Runner) Run(run func(ctx context.Context, runner ServiceRunner) error)
 	//	|-------------------|
 	//
 	// The resource controller will connects all databases and service dependencies first, then start the http-server
-	// and then grpc-server last.
-	for _, service := range r.services {
-		svc := service
-		if ctxSignal.Err() != nil {
-			returnedErr = ctxSignal.Err()
-			return
-		}
-		// Init the service.
-		initCtx, cancel := context.WithTimeout(ctxSignal, r.config.Timeout.InitTimeout)
-		go func() {
-			initContext := Context{
-				Ctx: initCtx,
-				// Assign a new logger from the default logger(we have configured this before), so each logger will have default attributes
-				// called 'logger_scope' to tell the scope of the logger.
-				Logger:         slog.Default().With(slog.String("logger_scope", svc.Name())),
-				Meter:          r.otelMeter,
-				Tracer:         r.otelTracer,
-				HealthNotifier: &HealthcheckNotifier{noop: true},
-			}
-			if r.healthcheckService != nil {
-				initContext.HealthNotifier = r.healthcheckService.notifiers[svc]
-			}
-			err := svc.Init(initContext)
-			runErrC <- err
-		}()
-		select {
-		case <-initCtx.Done():
-			cancel()
-			return errServiceInitTimeout
-		case err := <-runErrC:
-			cancel()
-			if err != nil {
-				return err
-			}
-		}
-		// Run the service.
-		go func(s *ServiceStateTracker) {
-			err := s.Run(ctxSignal)
-			runErrC <- err
-		}(svc)
-
-		// Check whether the service is in ready state or not. We use backoff, because sometimes the goroutines is not scheduled
-		// yet, thus lead to wrong result.
-		readyC := make(chan error, 1)
-		// Create a timeout for service readiness as we don't want to wait for too long for unresponsive service.
-		readyTimeoutCtx, cancelReady := context.WithTimeout(ctxSignal, readyTimeout)
-		defer cancelReady()
-		// Spawn a goroutine to wait for the ready notification. At this stage, there is no guarantee that Run() is not yet returned
-		// so ready will immediately return if Run() already exited.
-		go func() {
-			err := svc.Ready(readyTimeoutCtx)
-			readyC <- err
-			return
-		}()
-
-		// Wait for the service to be ready before starting the next service.
-		select {
-		case <-readyTimeoutCtx.Done():
-			cancelReady()
-			returnedErr = context.Cause(readyTimeoutCtx)
-			returnedErr = errors.Join(returnedErr, errServiceReadyTimeout)
-			return
-		case err := <-readyC:
-			if err != nil {
-				returnedErr = errors.Join(err, context.Cause(readyTimeoutCtx))
-				return
-			}
-		}
-
-		// Don't do any healthcheck if the healthcheck service is disabled.
-		if r.healthcheckService == nil {
-			continue
-		}
-		// Do a firstround of healthcheck after the service is ready as we want to understand the health status of each service.
-		status, err := r.healthcheckService.check(context.Background(), svc)
-		if err != nil {
-			returnedErr = err
-			// TODO: return a healthcheck error
-			return
-		}
-		if status <= HealthStatusUhealthy {
-			returnedErr = fmt.Errorf("%w with name %s. Status: %s", errUnhealthyService, svc.Name(), status)
-			return
-		}
+	// and then grpc-server last. But if both http-server and grpc-server only depend on the resource-controller, then both
+	// of them will be started concurrently after the resource-controller is ready.
+	atomic.StoreInt32(&r.state, runnerStateStarting)
+	returnedErr = graph.walk(ctxSignal, false, true, func(ctx context.Context, svc *ServiceStateTracker) error {
+		return r.startService(ctx, ctxService, svc, runErrC)
+	})
+	if returnedErr != nil {
+		return
+	}
+	// The graph walk will skip the rest of the services if the context is cancelled, so we need to check whether the context is
+	// cancelled before all services started.
+	if ctxSignal.Err() != nil {
+		returnedErr = context.Cause(ctxSignal)
+		return
+	}
+	atomic.StoreInt32(&r.state, runnerStateRunning)
+	// Tell systemd that the program is ready before telling the upgrader, so systemd tracks the new process as the main process
+	// before the parent process exits.
+	r.systemd.ready()
+	r.systemd.closeUnused()
+	// Tell the upgrader that all services are ready and healthy, so the parent process can exit if the program is started by an
+	// upgrade. This way, the parent process keeps serving if the services of the new process are failed to start.
+	if r.upgrader != nil {
+		r.upgrader.servicesReady()
 	}
 
 	var exitCause error
@@ -653,13 +798,24 @@ func (r *Runner) Run(run func(ctx context.Context, runner ServiceRunner) error)
 	}
 	// Put the exitCause as the returnedErr as any other error shoud be appended to the returnedErr.
 	returnedErr = exitCause
+	// Tell systemd that the program is stopping, unless the program exits because the new process already took over.
+	if !errors.Is(exitCause, errUpgrade) {
+		r.systemd.notify("STOPPING=1")
+	}
+	// Drain the services before stopping them. In the drain phase, the program is marked as not ready while the services
+	// are still serving, so the load balancer has the time to stop sending new requests to the program.
+	//
+	// There is nothing to drain when all services already exited or one of the services failed, so the services are
+	// stopped immediately.
+	if !errors.Is(exitCause, errAllServicesExited) && !errors.Is(exitCause, errServiceError) {
+		atomic.StoreInt32(&r.state, runnerStateDraining)
+		r.drain()
+	}
+	atomic.StoreInt32(&r.state, runnerStateShuttingDown)
 	// Don't forget to stop all the services to ensure we are not leaking any resources behind.
-	// We put the defer on-top for of triggering the run becauase we want to ensure if something
-	// bad happen in the run function, we will still stop all the services.
 	//
 	// We need to stop all the services in LIFO order to ensure we prevent incoming traffic in
 	// case of a service registering a http/gRPC server at the bottom of the service stack.
-	// This actually match with what defer did. Defered functions will be executed from bottom.
 	//
 	// Imagine the services stack looked like this, the same with the one started above:
 	//	|-------------------|
@@ -671,33 +827,111 @@ func (r *Runner) Run(run func(ctx context.Context, runner ServiceRunner) error)
 	// Then the grpc-server will stopped first, then http-server. And after all traffic is stopped then
 	// the resource-controller will be stopped after ensuring all connections are dropped/finished.
 	//
-	// We stopped the services inside a goroutine to ensure there are no blockers in the shutdown process
-	// and we will wait until the graceful period timeout.
-	stopErrC := make(chan error)
-	ctxTimeout, cancel := context.WithTimeout(context.Background(), gracefulShutdownTimeout)
+	// On top of the order, the services are stopped phase by phase. Please see ShutdownPhase for more information.
+	if err := r.stopServices(graph, exitCause); err != nil {
+		returnedErr = errors.Join(returnedErr, err)
+	}
+	return
+}
+
+// startService initiates, runs and waits for the service to be ready. The run context is used to run the service because the
+// context passed to the function is only valid during the start of the services.
+func (r *Runner) startService(ctx, runCtx context.Context, svc *ServiceStateTracker, runErrC chan<- error) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	// Create the listeners before the service is initiated, so the service can use the listeners in Init.
+	if err := r.registerListeners(svc); err != nil {
+		return err
+	}
+	// Init the service.
+	initCtx, cancel := context.WithTimeout(ctx, r.config.Timeout.InitTimeout)
 	defer cancel()
-	// Invoke a goroutine and stop the services sequentially because we don't want to kill the services randomly.
+
+	initStart := time.Now()
+	initErrC := make(chan error, 1)
 	go func() {
-		var err error
-		for i := len(r.services); i > 0; i-- {
-			errStop := r.services[i-1].Stop(ctxTimeout)
-			if errStop != nil {
-				err = errors.Join(err, errStop)
-			}
+		initErrC <- svc.Init(r.serviceContext(initCtx, svc))
+	}()
+	select {
+	case <-initCtx.Done():
+		return errServiceInitTimeout
+	case err := <-initErrC:
+		r.metrics.recordInit(svc.Name(), initStart)
+		if err != nil {
+			return err
 		}
-		stopErrC <- err
+	}
+	// Run the service and restart the service if needed. Each service has its own run context, so the runner can cancel
+	// the services one by one when stopping them.
+	runCtx, svc.cancelRun = context.WithCancelCause(runCtx)
+	go func() {
+		runErrC <- r.superviseService(runCtx, svc)
+	}()
+
+	// Check whether the service is in ready state or not. We use backoff, because sometimes the goroutines is not scheduled
+	// yet, thus lead to wrong result.
+	readyC := make(chan error, 1)
+	// Create a timeout for service readiness as we don't want to wait for too long for unresponsive service.
+	readyTimeoutCtx, cancelReady := context.WithTimeout(ctx, r.config.Timeout.ReadyTimeout)
+	defer cancelReady()
+	// Spawn a goroutine to wait for the ready notification. At this stage, there is no guarantee that Run() is not yet returned
+	// so ready will immediately return if Run() already exited.
+	readyStart := time.Now()
+	go func() {
+		readyC <- svc.Ready(readyTimeoutCtx)
 	}()
 
+	// Wait for the service to be ready before starting the next service.
 	select {
-	case <-ctxTimeout.Done():
-		returnedErr = errors.Join(returnedErr, errGracefulPeriodTimeout)
-		return
-	case err := <-stopErrC:
+	case <-readyTimeoutCtx.Done():
+		return errors.Join(context.Cause(readyTimeoutCtx), errServiceReadyTimeout)
+	case err := <-readyC:
+		r.metrics.recordReady(svc.Name(), readyStart)
 		if err != nil {
-			returnedErr = errors.Join(returnedErr, err)
+			return errors.Join(err, context.Cause(readyTimeoutCtx))
 		}
-		return
 	}
+
+	// Don't do any healthcheck if the healthcheck service is disabled.
+	if r.healthcheckService == nil {
+		return nil
+	}
+	// Do a firstround of healthcheck after the service is ready as we want to understand the health status of each service.
+	sra, ok := svc.ServiceInitAware.(ServiceRunnerAware)
+	if !ok {
+		return nil
+	}
+	status, err := r.healthcheckService.check(ctx, sra)
+	if err != nil {
+		// TODO: return a healthcheck error
+		return err
+	}
+	if status <= HealthStatusUhealthy {
+		return fmt.Errorf("%w with name %s. Status: %s", errUnhealthyService, svc.Name(), status)
+	}
+	return nil
+}
+
+// serviceContext creates the runner Context for the service.
+func (r *Runner) serviceContext(ctx context.Context, svc *ServiceStateTracker) Context {
+	svcCtx := Context{
+		Ctx: ctx,
+		// Assign a new logger from the default logger(we have configured this before), so each logger will have default attributes
+		// called 'logger_scope' to tell the scope of the logger.
+		Logger:         slog.Default().With(slog.String("logger_scope", svc.Name())),
+		Meter:          r.otelMeter,
+		Tracer:         r.otelTracer,
+		MeterProvider:  r.otelMeterProvider,
+		TracerProvider: r.otelTracerProvider,
+		HealthNotifier: &HealthcheckNotifier{noop: true},
+	}
+	if r.healthcheckService != nil {
+		if notifier, ok := r.healthcheckService.notifiers[svc.ServiceInitAware]; ok {
+			svcCtx.HealthNotifier = notifier
+		}
+	}
+	return svcCtx
 }
 
 // MustRun exit the program using os.Exit when it stops. The function determine the error using the internal isError
@@ -754,6 +988,20 @@ type ServiceStateTracker struct {
 	stopMu  sync.Mutex
 	stateMu sync.RWMutex
 	state   serviceState
+	// restarts is the number of restarts of the service based on its restart policy.
+	restarts int
+	// startTime is the last time the service is being run.
+	startTime time.Time
+	// lastErr is the last error returned by the service Run.
+	lastErr error
+	// cancelRun cancels the run context of the service, the function is set when the service is started.
+	cancelRun context.CancelCauseFunc
+	// restartRequested is true when the service is stopped to be restarted by UnhealthyActionRestart.
+	restartRequested atomic.Bool
+	// unhealthyNotReady is true when the service marks the program as not ready by UnhealthyActionNotReady.
+	unhealthyNotReady atomic.Bool
+	// metrics records the lifecycle metrics of the service, the metrics is nil if the service is not registered to the runner.
+	metrics *runnerMetrics
 	logger  *slog.Logger
 	// svcTypes stores the type of services. The types is a slice because we might want to record the
 	// servie to several categories.
@@ -797,6 +1045,20 @@ func (s *ServiceStateTracker) Name() string {
 	return s.ServiceInitAware.Name()
 }
 
+// dependsOn returns the dependencies of the service and whether the service declares its dependencies.
+func (s *ServiceStateTracker) dependsOn() ([]string, bool) {
+	sda, ok := s.ServiceInitAware.(ServiceDependencyAware)
+	if !ok {
+		return nil, false
+	}
+	return sda.DependsOn(), true
+}
+
+// isType returns true if the service is marked with the service type.
+func (s *ServiceStateTracker) isType(svcType int) bool {
+	return slices.Contains(s.svcTypes, svcType)
+}
+
 func (s *ServiceStateTracker) State() serviceState {
 	s.stateMu.RLock()
 	defer s.stateMu.RUnlock()
@@ -831,12 +1093,81 @@ func (s *ServiceStateTracker) Run(ctx context.Context) error {
 	}
 
 	s.setState(serviceStateStarting)
+	return s.run(ctx, sra)
+}
+
+func (s *ServiceStateTracker) run(ctx context.Context, sra ServiceRunnerAware) error {
+	s.stateMu.Lock()
+	s.startTime = time.Now()
+	s.stateMu.Unlock()
+
 	err := sra.Run(ctx)
+	if err != nil {
+		s.stateMu.Lock()
+		s.lastErr = err
+		s.stateMu.Unlock()
+	}
 	s.setState(serviceStateRunExited)
 	s.runErrC <- err
 	return err
 }
 
+// Restarts returns the number of restarts of the service.
+func (s *ServiceStateTracker) Restarts() int {
+	s.stateMu.RLock()
+	defer s.stateMu.RUnlock()
+	return s.restarts
+}
+
+// restartPolicy returns the restart policy of the service and whether the service has restart policy.
+func (s *ServiceStateTracker) restartPolicy() (RestartPolicy, bool) {
+	sra, ok := s.ServiceInitAware.(ServiceRestartAware)
+	if !ok {
+		return RestartPolicy{}, false
+	}
+	policy := sra.RestartPolicy()
+	if err := policy.validate(); err != nil || policy.Mode == RestartNever {
+		return RestartPolicy{}, false
+	}
+	return policy, true
+}
+
+// restart re-initiates the service after Run is returned and marks the service as starting. The restart is guarded by the
+// stop mutex, so we won't restart a service that being stopped.
+//
+// Please NOTE that the function doesn't invoke Run, the caller need to invoke runAfterRestart to run the service.
+func (s *ServiceStateTracker) restart(ctx Context) error {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+
+	if s.getState() != serviceStateRunExited {
+		return errServiceShuttingDown
+	}
+	// Drain the previous Run error as nobody is waiting for it, otherwise the next Run will be blocked when sending the error.
+	select {
+	case <-s.runErrC:
+	default:
+	}
+	if err := s.Init(ctx); err != nil {
+		return err
+	}
+
+	s.stateMu.Lock()
+	s.restarts++
+	s.stateMu.Unlock()
+	s.setState(serviceStateStarting)
+	return nil
+}
+
+// runAfterRestart runs the service after it being restarted.
+func (s *ServiceStateTracker) runAfterRestart(ctx context.Context) error {
+	sra, ok := s.ServiceInitAware.(ServiceRunnerAware)
+	if !ok {
+		panic(fmt.Sprintf("service %s is not a runner aware service", s.ServiceInitAware.Name()))
+	}
+	return s.run(ctx, sra)
+}
+
 func (s *ServiceStateTracker) Ready(ctx context.Context) error {
 	sra, ok := s.ServiceInitAware.(ServiceRunnerAware)
 	if !ok {
@@ -934,6 +1265,7 @@ func (s *ServiceStateTracker) setState(state serviceState) {
 
 	s.state = state
 	s.logger.Info(fmt.Sprintf("[Service] %s: %s", s.Name(), s.state))
+	s.metrics.recordStateTransition(s.Name(), state)
 }
 
 func (s *ServiceStateTracker) getState() serviceState {
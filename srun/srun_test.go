@@ -649,15 +649,22 @@ level=INFO msg="[Service] a_service: STOPPED" logger_scope=service_runner
 			},
 		})
 		err := s.Run(func(ctx context.Context, runner ServiceRunner) error {
+			logged := make(chan struct{})
 			sdn := &serviceDoNothing{
 				name: "a_service",
 				errC: make(chan error, 1),
 				onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
 					sdn.logger.Info("this is a log")
+					close(logged)
 					// Give time for the runner to invoke Ready() so the log order is deterministic.
 					time.Sleep(time.Second)
 					return nil
 				},
+				// Wait for the log before the service is ready, so the log is always written before the RUNNING state.
+				onReady: func(ctx context.Context, sdn *serviceDoNothing) error {
+					<-logged
+					return nil
+				},
 			}
 			return runner.Register(sdn)
 		})
@@ -701,15 +708,12 @@ func TestSrunKill(t *testing.T) {
 	}
 	defer os.Remove(testBinary)
 
-	// Move to tempdir for the test.
-	if err := os.Chdir(testTmpDir); err != nil {
-		t.Fatal(err)
-	}
-
 	for _, signal := range signals {
 		sig := signal
 		t.Run(sig.String(), func(t *testing.T) {
 			runCmd := exec.Command(testBinary)
+			// Run the program inside the tempdir, changing the working directory of the test affects the other parallel tests.
+			runCmd.Dir = testTmpDir
 			if err := runCmd.Start(); err != nil {
 				t.Fatal(err)
 			}
@@ -0,0 +1,310 @@
+package srun
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// systemdListenFDsStart is the first file descriptor passed by systemd socket activation, see sd_listen_fds(3).
+	systemdListenFDsStart = 3
+	// systemdNotifyTimeout is the timeout to send the notification, so the program is not blocked when systemd doesn't
+	// receive the notification.
+	systemdNotifyTimeout = time.Second
+)
+
+// SystemdConfig configures the integration with systemd. The integration is enabled automatically when the program is
+// started by systemd, which means one of the NOTIFY_SOCKET, LISTEN_FDS or WATCHDOG_USEC environment variables is set:
+//
+//   - The sockets passed via LISTEN_FDS are used for the listeners that required by the services, instead of creating
+//     new listeners.
+//   - READY=1 is sent after all services passed Ready, and STOPPING=1 is sent when the graceful shutdown begins.
+//   - RELOADING=1 is sent when the program is upgrading, the new process sends READY=1 with its PID as the MAINPID.
+//   - WATCHDOG=1 is sent periodically as long as the program is healthy.
+type SystemdConfig struct {
+	// Disable disables the integration with systemd even though the program is started by systemd.
+	Disable bool `yaml:"disable"`
+}
+
+// systemd integrates the runner with systemd via sd_notify and socket activation. All methods are safe to be called with
+// nil systemd, so the callers don't need to check whether the integration is enabled.
+type systemd struct {
+	// notifySocket is the unix datagram socket to send the notification to systemd.
+	notifySocket string
+	// watchdogInterval is the interval to send WATCHDOG=1, which is half of the watchdog timeout.
+	watchdogInterval time.Duration
+	logger           *slog.Logger
+
+	// mu guards the activated sockets as the services are started concurrently.
+	mu        sync.Mutex
+	activated []*systemdSocket
+}
+
+// systemdSocket is a socket passed by systemd socket activation.
+type systemdSocket struct {
+	// name is the name of the socket from LISTEN_FDNAMES.
+	name       string
+	listener   net.Listener
+	packetConn net.PacketConn
+	// used is true if the socket is already given to a service.
+	used bool
+}
+
+func (s *systemdSocket) addr() net.Addr {
+	if s.listener != nil {
+		return s.listener.Addr()
+	}
+	return s.packetConn.LocalAddr()
+}
+
+// newSystemd creates the systemd integration from the environment variables set by systemd. The function returns nil if
+// the integration is disabled or the program is not started by systemd.
+func newSystemd(config SystemdConfig, getenv func(string) string) (*systemd, error) {
+	if config.Disable {
+		return nil, nil
+	}
+	s := &systemd{
+		notifySocket: getenv("NOTIFY_SOCKET"),
+		logger:       slog.Default(),
+	}
+	pid := strconv.Itoa(os.Getpid())
+	// The watchdog is only meant for the process in WATCHDOG_PID if the variable is set.
+	if usec := getenv("WATCHDOG_USEC"); usec != "" && (getenv("WATCHDOG_PID") == "" || getenv("WATCHDOG_PID") == pid) {
+		n, err := strconv.ParseInt(usec, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("systemd: invalid WATCHDOG_USEC %q", usec)
+		}
+		s.watchdogInterval = time.Duration(n) * time.Microsecond / 2
+	}
+	count, names, err := systemdListenFDs(getenv)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*os.File, count)
+	for idx := range files {
+		fd := systemdListenFDsStart + idx
+		syscall.CloseOnExec(fd)
+		files[idx] = os.NewFile(uintptr(fd), names[idx])
+	}
+	if err := s.activate(files); err != nil {
+		return nil, err
+	}
+	if s.notifySocket == "" && s.watchdogInterval == 0 && len(s.activated) == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// systemdListenFDs returns the number of sockets passed by systemd socket activation and their names. The sockets are ignored
+// if they are not passed to the current process, for example when the process is started by an upgrade.
+func systemdListenFDs(getenv func(string) string) (int, []string, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return 0, nil, nil
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return 0, nil, fmt.Errorf("systemd: invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+	names := make([]string, count)
+	if fdNames := getenv("LISTEN_FDNAMES"); fdNames != "" {
+		copy(names, strings.Split(fdNames, ":"))
+	}
+	for idx := range names {
+		if names[idx] == "" {
+			names[idx] = fmt.Sprintf("LISTEN_FD_%d", systemdListenFDsStart+idx)
+		}
+	}
+	return count, names, nil
+}
+
+// activate converts the files passed by systemd to listeners and packet connections. The files are closed as the listeners
+// and the packet connections hold the duplicates of the file descriptors.
+func (s *systemd) activate(files []*os.File) error {
+	var err error
+	for _, f := range files {
+		socket := &systemdSocket{name: f.Name()}
+		sotype, errSockopt := syscall.GetsockoptInt(int(f.Fd()), syscall.SOL_SOCKET, syscall.SO_TYPE)
+		switch {
+		case errSockopt != nil:
+			err = errSockopt
+		case sotype == syscall.SOCK_DGRAM:
+			socket.packetConn, err = net.FilePacketConn(f)
+		default:
+			socket.listener, err = net.FileListener(f)
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("systemd: invalid socket %s: %w", socket.name, err)
+		}
+		s.activated = append(s.activated, socket)
+	}
+	return nil
+}
+
+// activatedListener returns the listener passed by systemd that matches the network and the address.
+func (s *systemd) activatedListener(network, addr string) (net.Listener, bool) {
+	if socket := s.take(network, addr, false); socket != nil {
+		return socket.listener, true
+	}
+	return nil, false
+}
+
+// listen returns the listener passed by systemd if available, otherwise creates a new listener.
+func (s *systemd) listen(network, addr string) (net.Listener, error) {
+	if listener, ok := s.activatedListener(network, addr); ok {
+		return listener, nil
+	}
+	return net.Listen(network, addr)
+}
+
+// listenPacket returns the packet connection passed by systemd if available, otherwise creates a new packet connection.
+func (s *systemd) listenPacket(network, addr string) (net.PacketConn, error) {
+	if socket := s.take(network, addr, true); socket != nil {
+		return socket.packetConn, nil
+	}
+	return net.ListenPacket(network, addr)
+}
+
+// take marks the socket that matches the request as used and returns it.
+func (s *systemd) take(network, addr string, packet bool) *systemdSocket {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, socket := range s.activated {
+		if socket.used || (socket.packetConn != nil) != packet || !systemdAddrMatch(network, addr, socket.addr()) {
+			continue
+		}
+		socket.used = true
+		s.logger.Info(
+			"Using socket from systemd socket activation",
+			slog.String("name", socket.name),
+			slog.String("network", network),
+			slog.String("address", socket.addr().String()),
+		)
+		return socket
+	}
+	return nil
+}
+
+// systemdAddrMatch returns true if the requested network and address match the address of the socket passed by systemd.
+// The unspecified addresses are treated equal, so ':8080' matches the socket of 'ListenStream=8080' which listens on '[::]:8080'.
+func systemdAddrMatch(network, address string, addr net.Addr) bool {
+	if strings.TrimRight(network, "46") != addr.Network() {
+		return false
+	}
+	if isUnixNetwork(network) {
+		return address == addr.String()
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	socketHost, socketPort, err := net.SplitHostPort(addr.String())
+	if err != nil || port != socketPort {
+		return false
+	}
+	ip, socketIP := net.ParseIP(host), net.ParseIP(socketHost)
+	if host == "" || (ip != nil && ip.IsUnspecified()) {
+		return socketIP != nil && socketIP.IsUnspecified()
+	}
+	return ip != nil && ip.Equal(socketIP)
+}
+
+// closeUnused closes the sockets passed by systemd that are not used by any service.
+func (s *systemd) closeUnused() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, socket := range s.activated {
+		if socket.used {
+			continue
+		}
+		s.logger.Warn(
+			"Closing unused socket from systemd socket activation",
+			slog.String("name", socket.name),
+			slog.String("address", socket.addr().String()),
+		)
+		if socket.listener != nil {
+			socket.listener.Close()
+		} else {
+			socket.packetConn.Close()
+		}
+	}
+}
+
+// notify sends the state to systemd, see sd_notify(3). The error is logged as the program should keep running even though
+// systemd is not reachable.
+func (s *systemd) notify(states ...string) {
+	if s == nil || s.notifySocket == "" {
+		return
+	}
+	if err := s.send(strings.Join(states, "\n")); err != nil {
+		s.logger.Warn("Failed to notify systemd", slog.String("state", strings.Join(states, " ")), slog.String("error", err.Error()))
+	}
+}
+
+func (s *systemd) send(state string) error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: s.notifySocket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(systemdNotifyTimeout))
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// ready tells systemd that the program is ready. The PID of the current process is sent as the main PID, so systemd tracks
+// the new process after an upgrade.
+func (s *systemd) ready() {
+	s.notify("READY=1", fmt.Sprintf("MAINPID=%d", os.Getpid()))
+}
+
+// upgrading tells systemd that the program is upgrading. The new process is allowed to send the watchdog notification, as
+// WATCHDOG_PID still refers to the current process.
+func (s *systemd) upgrading() {
+	if s == nil {
+		return
+	}
+	if s.watchdogInterval > 0 {
+		os.Unsetenv("WATCHDOG_PID")
+	}
+	s.notify("RELOADING=1")
+}
+
+// newSystemdWatchdogService returns a long running task that sends WATCHDOG=1 to systemd as long as the program is live. The
+// notification is skipped when one of the critical services is unhealthy, so systemd restarts the program after the watchdog
+// timeout is reached.
+func (r *Runner) newSystemdWatchdogService() (*LongRunningTask, error) {
+	if r.systemd == nil || r.systemd.watchdogInterval == 0 {
+		return nil, errors.New("systemd: watchdog is not enabled")
+	}
+	return NewLongRunningTask("srun-systemd-watchdog", func(ctx Context) error {
+		ticker := time.NewTicker(r.systemd.watchdogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Ctx.Done():
+				return nil
+			case <-ticker.C:
+				if report := r.livenessReport(); !report.OK() {
+					ctx.Logger.Warn("Skipping systemd watchdog notification, the program is not healthy")
+					continue
+				}
+				r.systemd.notify("WATCHDOG=1")
+			}
+		}
+	})
+}
@@ -0,0 +1,304 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewSystemd(t *testing.T) {
+	t.Parallel()
+
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name   string
+		config SystemdConfig
+		env    map[string]string
+		expect *systemd
+		err    bool
+	}{
+		{
+			name:   "not started by systemd",
+			expect: nil,
+		},
+		{
+			name:   "disabled",
+			config: SystemdConfig{Disable: true},
+			env:    map[string]string{"NOTIFY_SOCKET": "/run/systemd/notify"},
+			expect: nil,
+		},
+		{
+			name:   "notify socket",
+			env:    map[string]string{"NOTIFY_SOCKET": "@/org/freedesktop/systemd1/notify"},
+			expect: &systemd{notifySocket: "@/org/freedesktop/systemd1/notify"},
+		},
+		{
+			name:   "watchdog",
+			env:    map[string]string{"WATCHDOG_USEC": "30000000", "WATCHDOG_PID": pid},
+			expect: &systemd{watchdogInterval: time.Second * 15},
+		},
+		{
+			name:   "watchdog of another process",
+			env:    map[string]string{"WATCHDOG_USEC": "30000000", "WATCHDOG_PID": "1"},
+			expect: nil,
+		},
+		{
+			name: "invalid watchdog",
+			env:  map[string]string{"WATCHDOG_USEC": "30s"},
+			err:  true,
+		},
+		{
+			name:   "sockets of another process",
+			env:    map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "2"},
+			expect: nil,
+		},
+		{
+			name: "invalid sockets",
+			env:  map[string]string{"LISTEN_PID": pid, "LISTEN_FDS": "two"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := newSystemd(test.config, func(key string) string {
+				return test.env[key]
+			})
+			if (err != nil) != test.err {
+				t.Fatalf("expecting error %t but got %v", test.err, err)
+			}
+			if (s == nil) != (test.expect == nil) {
+				t.Fatalf("expecting systemd %v but got %v", test.expect, s)
+			}
+			if s == nil {
+				return
+			}
+			if s.notifySocket != test.expect.notifySocket {
+				t.Fatalf("expecting notify socket %s but got %s", test.expect.notifySocket, s.notifySocket)
+			}
+			if s.watchdogInterval != test.expect.watchdogInterval {
+				t.Fatalf("expecting watchdog interval %v but got %v", test.expect.watchdogInterval, s.watchdogInterval)
+			}
+		})
+	}
+}
+
+func TestSystemdListenFDs(t *testing.T) {
+	t.Parallel()
+
+	count, names, err := systemdListenFDs(func(key string) string {
+		return map[string]string{
+			"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+			"LISTEN_FDS":     "3",
+			"LISTEN_FDNAMES": "http:grpc",
+		}[key]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("expecting 3 sockets but got %d", count)
+	}
+	if diff := cmp.Diff([]string{"http", "grpc", "LISTEN_FD_5"}, names); diff != "" {
+		t.Fatalf("(-want/+got)\n%s", diff)
+	}
+}
+
+func TestSystemdAddrMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		network string
+		address string
+		addr    net.Addr
+		expect  bool
+	}{
+		{network: "tcp", address: ":8080", addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}, expect: true},
+		{network: "tcp4", address: "0.0.0.0:8080", addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}, expect: true},
+		{network: "tcp", address: "127.0.0.1:8080", addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}, expect: true},
+		{network: "tcp", address: "127.0.0.1:8080", addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}, expect: false},
+		{network: "tcp", address: ":8080", addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}, expect: false},
+		{network: "tcp", address: ":8081", addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}, expect: false},
+		{network: "udp", address: ":8080", addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}, expect: false},
+		{network: "udp6", address: "[::1]:53", addr: &net.UDPAddr{IP: net.IPv6loopback, Port: 53}, expect: true},
+		{network: "unix", address: "/run/app.sock", addr: &net.UnixAddr{Name: "/run/app.sock", Net: "unix"}, expect: true},
+		{network: "unix", address: "/run/app.sock", addr: &net.UnixAddr{Name: "/run/app.sock", Net: "unixgram"}, expect: false},
+		{network: "unix", address: "/run/other.sock", addr: &net.UnixAddr{Name: "/run/app.sock", Net: "unix"}, expect: false},
+	}
+	for _, test := range tests {
+		if got := systemdAddrMatch(test.network, test.address, test.addr); got != test.expect {
+			t.Errorf("%s %s with %s %s: expecting %t but got %t", test.network, test.address, test.addr.Network(), test.addr, test.expect, got)
+		}
+	}
+}
+
+func TestSystemdActivate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unixListener, err := net.Listen("unix", filepath.Join(dir, "stream.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the socket file when the listener is closed, as the socket is still used by the duplicated file descriptor.
+	unixListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	unixgramConn, err := net.ListenPacket("unixgram", filepath.Join(dir, "packet.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pass the duplicated file descriptors as systemd does, and close the original sockets.
+	var files []*os.File
+	for _, socket := range []interface{ File() (*os.File, error) }{
+		tcpListener.(*net.TCPListener),
+		udpConn.(*net.UDPConn),
+		unixListener.(*net.UnixListener),
+		unixgramConn.(*net.UnixConn),
+	} {
+		f, err := socket.File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	tcpListener.Close()
+	udpConn.Close()
+	unixListener.Close()
+	unixgramConn.Close()
+
+	s := &systemd{logger: slog.Default()}
+	if err := s.activate(files); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.activated) != 4 {
+		t.Fatalf("expecting 4 activated sockets but got %d", len(s.activated))
+	}
+
+	if _, ok := s.activatedListener("udp", udpConn.LocalAddr().String()); ok {
+		t.Fatal("expecting the packet connection to not be used as a listener")
+	}
+	listener, ok := s.activatedListener("tcp", tcpListener.Addr().String())
+	if !ok {
+		t.Fatal("expecting the activated tcp listener")
+	}
+	defer listener.Close()
+	if _, ok := s.activatedListener("tcp", tcpListener.Addr().String()); ok {
+		t.Fatal("expecting the activated tcp listener to be used only once")
+	}
+	conn, err := s.listenPacket("udp", udpConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.LocalAddr().String() != udpConn.LocalAddr().String() {
+		t.Fatalf("expecting the activated udp connection %s but got %s", udpConn.LocalAddr(), conn.LocalAddr())
+	}
+	unixListener, err = s.listen("unix", filepath.Join(dir, "stream.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unixListener.Close()
+
+	// The activated listener accepts the connection.
+	go func() {
+		c, err := net.Dial("tcp", tcpListener.Addr().String())
+		if err == nil {
+			c.Close()
+		}
+	}()
+	c, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// The unixgram connection is not used, so it is closed.
+	s.closeUnused()
+	if _, err := s.activated[3].packetConn.WriteTo([]byte("test"), unixgramConn.LocalAddr()); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expecting the unused connection to be closed but got %v", err)
+	}
+}
+
+// TestSystemdNotify uses a local unix datagram socket as the systemd notify socket. The test is not parallel as it sets the
+// environment variables of the program.
+func TestSystemdNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "200000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	// Receive the states in the background as the notification is blocked when the socket buffer is full.
+	statesC := make(chan []string, 1)
+	go func() {
+		var states []string
+		buff := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buff)
+			if err != nil {
+				statesC <- states
+				return
+			}
+			states = append(states, string(buff[:n]))
+		}
+	}()
+
+	err = New(Config{
+		Name:             "testing_systemd",
+		Admin:            AdminConfig{Disable: true},
+		OtelTracer:       OTelTracerConfig{Disable: true},
+		OtelMetric:       OtelMetricConfig{Disable: true},
+		DeadlineDuration: time.Second,
+	}).Run(func(ctx context.Context, runner ServiceRunner) error {
+		return runner.Register(&serviceDoNothing{
+			errC: make(chan error, 1),
+			onRun: func(ctx context.Context, sdn *serviceDoNothing) error {
+				<-ctx.Done()
+				return nil
+			},
+		})
+	})
+	if !errors.Is(err, errRunDeadlineTimeout) {
+		t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+	}
+
+	// Stop receiving the states after all the states are received.
+	time.Sleep(time.Millisecond * 100)
+	conn.SetReadDeadline(time.Now())
+	states := <-statesC
+	ready := slices.Index(states, fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+	if ready == -1 {
+		t.Fatalf("expecting READY=1 but got %q", states)
+	}
+	if !slices.Contains(states[ready:], "WATCHDOG=1") {
+		t.Fatalf("expecting WATCHDOG=1 after the program is ready but got %q", states)
+	}
+	// The watchdog notification is still sent until the watchdog service is stopped, which happens after STOPPING=1.
+	if !slices.Contains(states[ready:], "STOPPING=1") {
+		t.Fatalf("expecting STOPPING=1 after the program is ready but got %q", states)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/albertwidi/pkg/srun"
+)
+
+func main() {
+	srun.New(srun.Config{
+		Name: "upgrade",
+		Admin: srun.AdminConfig{
+			AdminServerConfig: srun.AdminServerConfig{
+				Address: os.Getenv("UPGRADE_ADMIN_ADDRESS"),
+				Token:   "secret",
+			},
+		},
+		OtelTracer: srun.OTelTracerConfig{
+			Disable: true,
+		},
+		OtelMetric: srun.OtelMetricConfig{
+			Disable: true,
+		},
+		Upgrader: srun.UpgraderConfig{
+			SelfUpgrade: true,
+			PIDFileName: os.Getenv("UPGRADE_PID_FILE"),
+			Timeout:     time.Second * 10,
+		},
+		Logger: srun.LoggerConfig{
+			Format: "json",
+			Level:  slog.LevelInfo,
+		},
+	}).MustRun(run())
+}
+
+func run() func(context.Context, srun.ServiceRunner) error {
+	return func(ctx context.Context, sr srun.ServiceRunner) error {
+		return sr.Register(&service{
+			failFile: os.Getenv("UPGRADE_FAIL_FILE"),
+			socket:   os.Getenv("UPGRADE_SOCKET"),
+			stopC:    make(chan struct{}),
+		})
+	}
+}
+
+// service is not ready if the fail file exists, so the test can simulate a new binary that fails to be ready.
+type service struct {
+	failFile  string
+	socket    string
+	listeners []srun.ServiceListener
+	stopC     chan struct{}
+}
+
+func (s *service) RequiredListeners() []srun.ListenerRequest {
+	return []srun.ListenerRequest{
+		{Network: "udp", Address: "127.0.0.1:0"},
+		{Network: "unix", Address: s.socket, FileMode: 0o600},
+	}
+}
+
+func (s *service) RegisterListeners(listeners []srun.ServiceListener) {
+	s.listeners = listeners
+}
+
+func (s *service) Name() string {
+	return "upgrade-service"
+}
+
+func (s *service) Init(ctx srun.Context) error {
+	return nil
+}
+
+func (s *service) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-s.stopC:
+	}
+	for _, l := range s.listeners {
+		if l.Listener != nil {
+			l.Listener.Close()
+		}
+		if l.PacketConn != nil {
+			l.PacketConn.Close()
+		}
+	}
+	return nil
+}
+
+func (s *service) Ready(ctx context.Context) error {
+	if _, err := os.Stat(s.failFile); err == nil {
+		return errors.New("service is not ready")
+	}
+	return nil
+}
+
+func (s *service) Stop(ctx context.Context) error {
+	close(s.stopC)
+	return nil
+}
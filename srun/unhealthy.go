@@ -0,0 +1,139 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// unhealthyDefaultThreshold is the default number of consecutive unhealthy results before the unhealthy action is taken.
+const unhealthyDefaultThreshold = 3
+
+// errUnhealthyShutdown is the exit cause of the program when a service with UnhealthyActionShutdown stays unhealthy.
+var errUnhealthyShutdown = errors.New("healthcheck: shutting down because the service is unhealthy")
+
+// UnhealthyAction is the action taken by the runner when a service reports HealthStatusUhealthy for a number of consecutive
+// checks. The action lets the program heal itself without an external orchestrator, for example in a virtual machine.
+type UnhealthyAction int
+
+const (
+	// UnhealthyActionNone only logs and broadcasts the unhealthy status of the service.
+	UnhealthyActionNone UnhealthyAction = iota
+	// UnhealthyActionRestart stops the service and runs it again. The service is re-initiated the same way as the restart
+	// by RestartPolicy, so the service must be able to be initiated again after it is stopped.
+	UnhealthyActionRestart
+	// UnhealthyActionNotReady marks the program as not ready in the admin /ready endpoint until the service is not unhealthy
+	// anymore, so the load balancer stops sending new requests to the program.
+	UnhealthyActionNotReady
+	// UnhealthyActionShutdown gracefully shuts down the program, so the process supervisor can start a new process.
+	UnhealthyActionShutdown
+)
+
+// String returns the unhealthy action in string.
+func (u UnhealthyAction) String() string {
+	switch u {
+	case UnhealthyActionNone:
+		return "NONE"
+	case UnhealthyActionRestart:
+		return "RESTART"
+	case UnhealthyActionNotReady:
+		return "NOT_READY"
+	case UnhealthyActionShutdown:
+		return "SHUTDOWN"
+	default:
+		return "UNKNOWN_UNHEALTHY_ACTION"
+	}
+}
+
+// unhealthyActionHandler takes the unhealthy action of the services, the handler is implemented by the runner.
+type unhealthyActionHandler interface {
+	// handleUnhealthy takes the action after the service is unhealthy for the number of consecutive checks.
+	handleUnhealthy(serviceName string, action UnhealthyAction)
+	// handleRecovered reverts the action after the service is not unhealthy anymore.
+	handleRecovered(serviceName string, action UnhealthyAction)
+}
+
+var _ unhealthyActionHandler = (*Runner)(nil)
+
+func (r *Runner) handleUnhealthy(serviceName string, action UnhealthyAction) {
+	r.logger.Warn(
+		fmt.Sprintf("[Service] %s: service is unhealthy, taking action %s", serviceName, action),
+		slog.String("service_name", serviceName),
+		slog.String("action", action.String()),
+	)
+	switch action {
+	case UnhealthyActionRestart:
+		svc, ok := r.service(serviceName)
+		if !ok {
+			r.logger.Error(fmt.Sprintf("[Service] %s: only the registered services can be restarted", serviceName))
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), r.config.Timeout.ShutdownGracefulPeriod)
+		defer cancel()
+		if err := svc.requestRestart(ctx); err != nil {
+			r.logger.Error(
+				fmt.Sprintf("[Service] %s: failed to restart unhealthy service", serviceName),
+				slog.String("error", err.Error()),
+			)
+		}
+	case UnhealthyActionNotReady:
+		if svc, ok := r.service(serviceName); ok {
+			svc.setUnhealthyNotReady(true)
+		}
+	case UnhealthyActionShutdown:
+		if r.shutdown != nil {
+			r.shutdown(fmt.Errorf("%w: %s", errUnhealthyShutdown, serviceName))
+		}
+	}
+}
+
+func (r *Runner) handleRecovered(serviceName string, action UnhealthyAction) {
+	if action != UnhealthyActionNotReady {
+		return
+	}
+	if svc, ok := r.service(serviceName); ok {
+		svc.setUnhealthyNotReady(false)
+		r.logger.Info(fmt.Sprintf("[Service] %s: service is recovered, marking the service as ready", serviceName))
+	}
+}
+
+// service returns the service registered to the runner by its name. The services inside a service that wraps several services,
+// for example ConcurrentServices, are not returned.
+func (r *Runner) service(name string) (*ServiceStateTracker, bool) {
+	r.servicesMu.RLock()
+	defer r.servicesMu.RUnlock()
+	for _, svc := range r.services {
+		if svc.Name() == name {
+			return svc, true
+		}
+	}
+	return nil, false
+}
+
+// requestRestart stops the running service so the runner restarts it, regardless of the restart policy of the service. The
+// service is not marked as shutting down, so the runner knows the service is expected to be run again.
+func (s *ServiceStateTracker) requestRestart(ctx context.Context) error {
+	sra, ok := s.ServiceInitAware.(ServiceRunnerAware)
+	if !ok {
+		panic(fmt.Sprintf("service %s is not a runner aware service", s.ServiceInitAware.Name()))
+	}
+
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+
+	if state := s.getState(); state != serviceStateRunning {
+		return fmt.Errorf("[restart] %w: expecting %s state but got %s", errInvalidStateOrder, serviceStateRunning, state)
+	}
+	s.restartRequested.Store(true)
+	if err := sra.Stop(ctx); err != nil {
+		s.restartRequested.Store(false)
+		return err
+	}
+	return nil
+}
+
+// setUnhealthyNotReady marks the service as not ready because of its unhealthy status.
+func (s *ServiceStateTracker) setUnhealthyNotReady(notReady bool) {
+	s.unhealthyNotReady.Store(notReady)
+}
@@ -0,0 +1,243 @@
+package srun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	_ Healthcheck                   = (*serviceUnhealthy)(nil)
+	_ ServiceHealthcheckPolicyAware = (*serviceUnhealthy)(nil)
+)
+
+// serviceUnhealthy is a service that reports unhealthy status on demand. The service can be initiated again after it is
+// stopped, so it can be restarted by the runner.
+type serviceUnhealthy struct {
+	policy    HealthcheckPolicy
+	unhealthy atomic.Bool
+	inits     atomic.Int32
+
+	mu    sync.Mutex
+	stopC chan struct{}
+}
+
+func (s *serviceUnhealthy) Name() string {
+	return "unhealthy-service"
+}
+
+func (s *serviceUnhealthy) Init(ctx Context) error {
+	s.inits.Add(1)
+	s.mu.Lock()
+	s.stopC = make(chan struct{})
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *serviceUnhealthy) Run(ctx context.Context) error {
+	s.mu.Lock()
+	stopC := s.stopC
+	s.mu.Unlock()
+	select {
+	case <-ctx.Done():
+	case <-stopC:
+	}
+	return nil
+}
+
+func (s *serviceUnhealthy) Ready(ctx context.Context) error {
+	return nil
+}
+
+func (s *serviceUnhealthy) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	close(s.stopC)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *serviceUnhealthy) Health(ctx context.Context) (HealthStatus, error) {
+	if s.unhealthy.Load() {
+		return HealthStatusUhealthy, errors.New("unhealthy")
+	}
+	return HealthStatusHealthy, nil
+}
+
+func (s *serviceUnhealthy) HealthcheckPolicy() HealthcheckPolicy {
+	return s.policy
+}
+
+func TestServiceHealthStatusObserveUnhealthy(t *testing.T) {
+	t.Parallel()
+
+	status := newServiceHealthStatus("test", HealthcheckPolicy{}, 0)
+	tests := []struct {
+		result    HealthStatus
+		act       bool
+		recovered bool
+	}{
+		{result: HealthStatusUhealthy},
+		// The degraded status resets the consecutive unhealthy results, but it is not a recovery as no action is taken.
+		{result: HealthStatusDegarded},
+		{result: HealthStatusUhealthy},
+		{result: HealthStatusUhealthy, act: true},
+		// The action is taken again after the next consecutive unhealthy results.
+		{result: HealthStatusUhealthy},
+		{result: HealthStatusUhealthy, act: true},
+		{result: HealthStatusHealthy, recovered: true},
+		{result: HealthStatusHealthy},
+	}
+	for idx, test := range tests {
+		act, recovered := status.observeUnhealthy(HealthcheckResult{Status: test.result}, 2)
+		if act != test.act || recovered != test.recovered {
+			t.Fatalf("check %d: expecting act %t and recovered %t but got %t and %t", idx, test.act, test.recovered, act, recovered)
+		}
+	}
+}
+
+func TestUnhealthyActions(t *testing.T) {
+	t.Parallel()
+
+	// run runs the unhealthy service with the action, and calls the test function after the program is ready. The admin server
+	// is enabled with the readiness function if the function is not nil.
+	run := func(t *testing.T, action UnhealthyAction, readinessFunc func() error, test func(r *Runner, svc *serviceUnhealthy)) (*Runner, error) {
+		t.Helper()
+
+		admin := AdminConfig{Disable: true}
+		if readinessFunc != nil {
+			admin = AdminConfig{AdminServerConfig: AdminServerConfig{Address: "127.0.0.1:0", ReadinessFunc: readinessFunc}}
+		}
+		r := New(Config{
+			Name:             "testing_unhealthy_" + action.String(),
+			Admin:            admin,
+			OtelTracer:       OTelTracerConfig{Disable: true},
+			OtelMetric:       OtelMetricConfig{Disable: true},
+			Healthcheck:      HealthcheckConfig{Enabled: true},
+			DeadlineDuration: time.Second * 3,
+		})
+		svc := &serviceUnhealthy{
+			policy: HealthcheckPolicy{
+				Interval:           time.Millisecond * 20,
+				UnhealthyAction:    action,
+				UnhealthyThreshold: 2,
+			},
+		}
+		err := r.Run(func(ctx context.Context, runner ServiceRunner) error {
+			if err := runner.Register(svc); err != nil {
+				return err
+			}
+			// Probe the program after the services are registered, as the registration is not concurrently safe.
+			go func() {
+				waitUntil(t, "the program to be ready", func() bool {
+					return r.readinessReport().OK()
+				})
+				test(r, svc)
+			}()
+			return nil
+		})
+		return r, err
+	}
+
+	t.Run("restart", func(t *testing.T) {
+		t.Parallel()
+
+		r, err := run(t, UnhealthyActionRestart, nil, func(r *Runner, svc *serviceUnhealthy) {
+			svc.unhealthy.Store(true)
+			waitUntil(t, "the service to be restarted", func() bool {
+				return svc.inits.Load() > 1
+			})
+			svc.unhealthy.Store(false)
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		idx := slices.IndexFunc(r.Services(), func(s ServiceSnapshot) bool { return s.Name == "unhealthy-service" })
+		if restarts := r.Services()[idx].Restarts; restarts == 0 {
+			t.Fatal("expecting the unhealthy service to be restarted")
+		}
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		t.Parallel()
+
+		var recovered atomic.Bool
+		_, err := run(t, UnhealthyActionNotReady, nil, func(r *Runner, svc *serviceUnhealthy) {
+			svc.unhealthy.Store(true)
+			waitUntil(t, "the program to be not ready", func() bool {
+				return !r.readinessReport().OK()
+			})
+			svc.unhealthy.Store(false)
+			waitUntil(t, "the program to be ready again", func() bool {
+				return r.readinessReport().OK()
+			})
+			recovered.Store(true)
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if !recovered.Load() {
+			t.Fatal("expecting the program to be ready after the service is recovered")
+		}
+	})
+
+	t.Run("not ready with readiness func", func(t *testing.T) {
+		t.Parallel()
+
+		// ready returns whether the admin /ready endpoint responds OK, the readiness function always returns OK so the
+		// endpoint only fails because of the unhealthy action.
+		ready := func(r *Runner) bool {
+			rec := httptest.NewRecorder()
+			r.adminServer.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			return rec.Code == http.StatusOK
+		}
+		var recovered atomic.Bool
+		_, err := run(t, UnhealthyActionNotReady, func() error { return nil }, func(r *Runner, svc *serviceUnhealthy) {
+			svc.unhealthy.Store(true)
+			waitUntil(t, "the /ready endpoint to fail", func() bool {
+				return !ready(r)
+			})
+			svc.unhealthy.Store(false)
+			waitUntil(t, "the /ready endpoint to be OK again", func() bool {
+				return ready(r)
+			})
+			recovered.Store(true)
+		})
+		if !errors.Is(err, errRunDeadlineTimeout) {
+			t.Fatalf("expecting error %v but got %v", errRunDeadlineTimeout, err)
+		}
+		if !recovered.Load() {
+			t.Fatal("expecting the /ready endpoint to be OK after the service is recovered")
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := run(t, UnhealthyActionShutdown, nil, func(r *Runner, svc *serviceUnhealthy) {
+			svc.unhealthy.Store(true)
+		})
+		if !errors.Is(err, errUnhealthyShutdown) {
+			t.Fatalf("expecting error %v but got %v", errUnhealthyShutdown, err)
+		}
+	})
+}
+
+// waitUntil waits until the condition is true, and fails the test if the condition is not true within five seconds.
+func waitUntil(t *testing.T, desc string, fn func() bool) {
+	t.Helper()
+	timeout := time.After(time.Second * 5)
+	for !fn() {
+		select {
+		case <-timeout:
+			t.Errorf("timeout waiting for %s", desc)
+			return
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
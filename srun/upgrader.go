@@ -2,42 +2,116 @@ package srun
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/cloudflare/tableflip"
 )
 
+const (
+	upgradeDefaultTimeout = time.Minute
+	// upgradeGenerationEnv is the environment variable to pass the generation of the program to the new process.
+	upgradeGenerationEnv = "SRUN_UPGRADE_GENERATION"
+)
+
+var (
+	// errUpgraderDisabled is thrown when the upgrade is triggered but the self-upgrade is disabled.
+	errUpgraderDisabled = errors.New("upgrade: self-upgrade is disabled")
+	// errUpgradeNotReady is thrown when the upgrade is triggered before all services are ready.
+	errUpgradeNotReady = errors.New("upgrade: program is not ready yet")
+	// errUpgradeInProgress is thrown when the upgrade is triggered while another upgrade is in progress.
+	errUpgradeInProgress = errors.New("upgrade: another upgrade is in progress")
+)
+
 var _ ServiceRunnerAware = (*upgrader)(nil)
 
 type UpgraderConfig struct {
 	// SelfUpgrade defines whether the binary is allowed to be upgraded with SIGHUP or not.
-	SelfUpgrade bool
+	SelfUpgrade bool `yaml:"self-upgrade"`
 	// PIDFileName is an optional name for the PIDFile to do a self-upgrade. By default we will use
-	// the build information for the pid file.
-	PIDFileName string
+	// the service name for the pid file.
+	PIDFileName string `yaml:"pid-file-name"`
+	// Timeout is the maximum duration to wait for the new process to be ready. The new process is killed and the current
+	// process keeps serving if the timeout is reached. By default, the timeout is one minute.
+	Timeout time.Duration `yaml:"timeout"`
 }
 
 // upgrader provides the ability to self-upgrade the Go program.
+//
+// The new process only tells the current process that it is ready after all of its services are ready and healthy, so the
+// current process keeps serving if the new process crashes or fails to be ready.
 type upgrader struct {
 	// pidFile is the file that stores pid number for the program to hot-reload.
 	pidFile string
 	// upgrader is tableflip upgrader instance to invoke upgrade when upgrade signal
 	// is invoked.
 	upgrader *tableflip.Upgrader
+	logger   *slog.Logger
+	metrics  *runnerMetrics
+	// systemd is notified when upgrading, and provides the sockets passed by systemd to the listeners.
+	systemd *systemd
 
-	readyErr         error
 	ctxUpgrade       context.Context
 	ctxUpgradeCancel context.CancelCauseFunc
 
-	sigC   chan os.Signal
-	stopC  chan struct{}
-	readyC chan struct{}
+	sigC  chan os.Signal
+	stopC chan struct{}
+	// runC is closed when the upgrader is running.
+	runC chan struct{}
+	// servicesReadyC is closed when all services in the runner are ready.
+	servicesReadyC    chan struct{}
+	servicesReadyOnce sync.Once
 
 	mu      sync.Mutex
 	running bool
+
+	// generation is the number of upgrades that lead to the current process, the first process is the generation zero.
+	generation int
+	// parentPID is the PID of the process that started the current process by an upgrade.
+	parentPID int
+	// statusMu guards the listeners and the upgrade state below.
+	statusMu    sync.Mutex
+	listeners   []upgradeListener
+	inProgress  bool
+	lastUpgrade *upgradeResult
+}
+
+// upgradeStatus is the status of the upgrader returned by GET /upgrade/status.
+type upgradeStatus struct {
+	Generation int    `json:"generation"`
+	PID        int    `json:"pid"`
+	ParentPID  int    `json:"parent_pid,omitempty"`
+	PIDFile    string `json:"pid_file"`
+	// Listeners is the list of listeners and packet connections created via the upgrader, they are passed to the new process
+	// when upgrading.
+	Listeners   []upgradeListener `json:"listeners"`
+	InProgress  bool              `json:"in_progress"`
+	LastUpgrade *upgradeResult    `json:"last_upgrade,omitempty"`
+}
+
+// upgradeListener is a listener created via the upgrader.
+type upgradeListener struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	// Inherited is true if the listener is inherited from the parent process.
+	Inherited bool `json:"inherited"`
+}
+
+// upgradeResult is the result of an upgrade that triggered by the current process.
+type upgradeResult struct {
+	// Trigger is the source of the upgrade, for example 'signal' or 'admin'.
+	Trigger   string    `json:"trigger"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Duration  string    `json:"duration"`
 }
 
 // newUpgrader creates a new upgrader, the upgrader will create a PIDFILE based on
@@ -45,9 +119,10 @@ type upgrader struct {
 //
 // It is possible to use multiple signal for upgrade process, but usually
 // SIGHUP is used for upgrade signal.
-func newUpgrader(pidFile string, signals ...os.Signal) (*upgrader, error) {
+func newUpgrader(pidFile string, timeout time.Duration, signals ...os.Signal) (*upgrader, error) {
 	upg, err := tableflip.New(tableflip.Options{
-		PIDFile: pidFile,
+		PIDFile:        pidFile,
+		UpgradeTimeout: timeout,
 	})
 	if err != nil {
 		return nil, err
@@ -61,14 +136,22 @@ func newUpgrader(pidFile string, signals ...os.Signal) (*upgrader, error) {
 	// other components to indicates the context is cancelled because of an upgrade.
 	ctx, cancel := context.WithCancelCause(context.Background())
 
-	return &upgrader{
+	u := &upgrader{
+		pidFile:          pidFile,
 		upgrader:         upg,
+		logger:           slog.Default(),
 		ctxUpgrade:       ctx,
 		ctxUpgradeCancel: cancel,
 		sigC:             c,
 		stopC:            make(chan struct{}),
-		readyC:           make(chan struct{}, 1),
-	}, nil
+		runC:             make(chan struct{}),
+		servicesReadyC:   make(chan struct{}),
+	}
+	if upg.HasParent() {
+		u.parentPID = os.Getppid()
+		u.generation, _ = strconv.Atoi(os.Getenv(upgradeGenerationEnv))
+	}
+	return u, nil
 }
 
 // Context returns the upgrade context so other components can listen to the upgrader context as well.
@@ -97,20 +180,22 @@ func (u *upgrader) Running() bool {
 	return u.running
 }
 
-func (u *upgrader) Init(Context) error {
+func (u *upgrader) Init(ctx Context) error {
+	u.logger = ctx.Logger
 	return nil
 }
 
+// servicesReady marks all services in the runner as ready, so the upgrader can tell the parent process that the upgrade is
+// finished.
+func (u *upgrader) servicesReady() {
+	u.servicesReadyOnce.Do(func() {
+		close(u.servicesReadyC)
+	})
+}
+
 func (u *upgrader) Run(ctx context.Context) error {
-	if err := u.upgrader.Ready(); err != nil {
-		// Mark the ready error as the same error as we might want to throw the error early.
-		u.readyErr = err
-		return err
-	}
 	u.setRunning(true)
-	// Mark the upgrader as ready as we the tableflip upgrader is also ready.
-	u.readyC <- struct{}{}
-
+	close(u.runC)
 	defer func() {
 		u.setRunning(false)
 		// Ensure that the context is cancelled so it's not leaking. It's okay if the function
@@ -118,6 +203,28 @@ func (u *upgrader) Run(ctx context.Context) error {
 		u.ctxUpgradeCancel(nil)
 	}()
 
+	// Wait until all services are ready before marking the tableflip upgrader as ready. The upgrader is started before the other
+	// services, and the parent process exits once the upgrader is ready.
+	select {
+	case <-u.servicesReadyC:
+	case <-ctx.Done():
+		u.upgrader.Stop()
+		return nil
+	case <-u.stopC:
+		u.upgrader.Stop()
+		return nil
+	}
+	if err := u.upgrader.Ready(); err != nil {
+		return err
+	}
+	if u.upgrader.HasParent() {
+		u.logger.Info(
+			"Upgrade completed, the program is ready to replace the previous process",
+			slog.Int("generation", u.generation),
+			slog.Int("parent_pid", u.parentPID),
+		)
+	}
+
 	for {
 		select {
 		case <-u.upgrader.Exit():
@@ -125,13 +232,13 @@ func (u *upgrader) Run(ctx context.Context) error {
 			return nil
 
 		case <-u.sigC: // Wait until the signal is coming.
-			err := u.upgrader.Upgrade()
-			if err != nil {
-				return err
+			if err := u.begin(); err != nil {
+				u.logger.Warn("Ignoring upgrade signal", slog.String("error", err.Error()))
+				continue
 			}
-			<-u.upgrader.Exit()
-			u.ctxUpgradeCancel(errUpgrade)
-			return nil
+			// The upgrader exits via the exit channel above if the upgrade succeeded. Otherwise, the current process keeps
+			// serving as the new process is failed to be ready.
+			u.upgrade("signal")
 
 		case <-ctx.Done():
 			u.upgrader.Stop()
@@ -145,11 +252,12 @@ func (u *upgrader) Run(ctx context.Context) error {
 }
 
 func (u *upgrader) Ready(ctx context.Context) error {
-	if u.readyErr != nil {
-		return u.readyErr
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-u.runC:
+		return nil
 	}
-	<-u.readyC
-	return nil
 }
 
 func (u *upgrader) Stop(ctx context.Context) error {
@@ -157,6 +265,8 @@ func (u *upgrader) Stop(ctx context.Context) error {
 		return nil
 	}
 	close(u.stopC)
+	// Interrupt the upgrade in progress, so the runner doesn't need to wait for the new process.
+	u.upgrader.Stop()
 	return nil
 }
 
@@ -165,5 +275,140 @@ func (u *upgrader) PIDFile() string {
 }
 
 func (u *upgrader) createListener(network, addr string) (net.Listener, error) {
-	return u.upgrader.Listen(network, addr)
+	inherited := true
+	listener, err := u.upgrader.ListenWithCallback(network, addr, func(network, addr string) (net.Listener, error) {
+		inherited = false
+		return u.systemd.listen(network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.addListener(network, addr, inherited)
+	return listener, nil
+}
+
+func (u *upgrader) createPacketConn(network, addr string) (net.PacketConn, error) {
+	inherited := true
+	conn, err := u.upgrader.ListenPacketWithCallback(network, addr, func(network, addr string) (net.PacketConn, error) {
+		inherited = false
+		return u.systemd.listenPacket(network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.addListener(network, addr, inherited)
+	return conn, nil
+}
+
+func (u *upgrader) addListener(network, addr string, inherited bool) {
+	u.statusMu.Lock()
+	defer u.statusMu.Unlock()
+	u.listeners = append(u.listeners, upgradeListener{Network: network, Address: addr, Inherited: inherited})
+}
+
+// begin marks the upgrade as in progress, so only one upgrade is running at a time. The upgrade must be started by calling
+// upgrade after begin returns nil.
+func (u *upgrader) begin() error {
+	select {
+	case <-u.servicesReadyC:
+	default:
+		return errUpgradeNotReady
+	}
+	u.statusMu.Lock()
+	defer u.statusMu.Unlock()
+	if u.inProgress {
+		return errUpgradeInProgress
+	}
+	u.inProgress = true
+	return nil
+}
+
+// upgrade starts the new process and waits until the new process is ready. The current process exits once the upgrade
+// succeeded, and keeps serving if the upgrade failed.
+func (u *upgrader) upgrade(trigger string) error {
+	start := time.Now()
+	u.logger.Info("Upgrading program", slog.String("trigger", trigger), slog.Int("generation", u.generation+1))
+	// The new process inherits the environment variables of the current process.
+	os.Setenv(upgradeGenerationEnv, strconv.Itoa(u.generation+1))
+	u.systemd.upgrading()
+	err := u.upgrader.Upgrade()
+	if err != nil {
+		// Tell systemd that the current process is ready again, as the new process is failed to take over.
+		u.systemd.ready()
+	}
+	u.finish(trigger, start, err)
+	return err
+}
+
+// finish records the result of the upgrade.
+func (u *upgrader) finish(trigger string, start time.Time, err error) {
+	result := upgradeResult{
+		Trigger:   trigger,
+		Result:    "success",
+		StartedAt: start,
+		Duration:  time.Since(start).String(),
+	}
+	if err != nil {
+		result.Result = "failure"
+		result.Error = err.Error()
+		u.logger.Error(
+			"Failed to upgrade program, the current process keeps serving",
+			slog.String("error", err.Error()),
+			slog.Duration("upgrade_duration", time.Since(start)),
+		)
+	} else {
+		u.logger.Info("New process is ready, exiting the current process", slog.Duration("upgrade_duration", time.Since(start)))
+	}
+	u.metrics.recordUpgrade(result.Result, start)
+
+	u.statusMu.Lock()
+	defer u.statusMu.Unlock()
+	u.inProgress = false
+	u.lastUpgrade = &result
+}
+
+// triggerUpgrade starts the upgrade in the background.
+func (u *upgrader) triggerUpgrade(trigger string) error {
+	if err := u.begin(); err != nil {
+		return err
+	}
+	go u.upgrade(trigger)
+	return nil
+}
+
+func (u *upgrader) status() upgradeStatus {
+	u.statusMu.Lock()
+	defer u.statusMu.Unlock()
+	return upgradeStatus{
+		Generation:  u.generation,
+		PID:         os.Getpid(),
+		ParentPID:   u.parentPID,
+		PIDFile:     u.pidFile,
+		Listeners:   slices.Clone(u.listeners),
+		InProgress:  u.inProgress,
+		LastUpgrade: u.lastUpgrade,
+	}
+}
+
+// Upgrade upgrades the binary with the same mechanism as SIGHUP, and waits until the new process is ready. The current process
+// exits after the upgrade succeeded, while the current process keeps serving and the error is returned if the upgrade failed.
+//
+// The function returns when the context is cancelled, but the upgrade is still running in the background.
+func (r *Runner) Upgrade(ctx context.Context) error {
+	if r.upgrader == nil {
+		return errUpgraderDisabled
+	}
+	if err := r.upgrader.begin(); err != nil {
+		return err
+	}
+	errC := make(chan error, 1)
+	go func() {
+		errC <- r.upgrader.upgrade("api")
+	}()
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case err := <-errC:
+		return err
+	}
 }
@@ -2,12 +2,23 @@ package srun
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 // TestUpgrader for testing, because we cannot use tableflip to ensure the upgrader is running correctly.
@@ -49,12 +60,9 @@ func (tg *TestUpgrader) PIDFile() string {
 func TestUpgraderStop(t *testing.T) {
 	t.Parallel()
 
-	pidFile := "testdata.pid"
-	t.Cleanup(func() {
-		os.Remove(pidFile)
-	})
-
-	u, err := newUpgrader(pidFile, syscall.SIGHUP)
+	// Use the absolute path as the working directory might be changed by other tests.
+	pidFile := filepath.Join(t.TempDir(), "testdata.pid")
+	u, err := newUpgrader(pidFile, time.Second, syscall.SIGHUP)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,6 +94,20 @@ func TestUpgraderStop(t *testing.T) {
 			t.Fatal("runner is not running")
 		}
 	}
+	// The tableflip upgrader writes the PID file when it is ready, and it should only be ready after all services are ready.
+	if _, err := os.Stat(pidFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expecting the pid file to not exist before the services are ready, but got %v", err)
+	}
+	u.servicesReady()
+	for checkCount = 0; ; checkCount++ {
+		if _, err := os.Stat(pidFile); err == nil {
+			break
+		}
+		if checkCount == maxCheckCount {
+			t.Fatal("expecting the pid file to be written after the services are ready")
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
 	cancel()
 
 	time.Sleep(time.Millisecond * 300)
@@ -94,3 +116,247 @@ func TestUpgraderStop(t *testing.T) {
 		t.Fatal("upgrader is still running")
 	}
 }
+
+func TestUpgrade(t *testing.T) {
+	t.Parallel()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTmpDir := t.TempDir()
+	testBinary := filepath.Join(testTmpDir, "upgrade")
+	pidFile := filepath.Join(testTmpDir, "upgrade.pid")
+	failFile := filepath.Join(testTmpDir, "fail")
+	logFile := filepath.Join(testTmpDir, "upgrade.log")
+	socket := filepath.Join(testTmpDir, "upgrade.sock")
+	// Reserve a free port for the admin server.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminAddress := ln.Addr().String()
+	ln.Close()
+
+	cmd := exec.Command("go", "build", "-o", testBinary, filepath.Join(wd, "testdata", "upgradeprog.go"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	// Write the logs to a file, as the new process inherits the stdout of the current process.
+	logOut, err := os.Create(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logOut.Close()
+
+	readPID := func() int {
+		out, err := os.ReadFile(pidFile)
+		if err != nil {
+			return 0
+		}
+		pid, _ := strconv.Atoi(string(out))
+		return pid
+	}
+	waitFor := func(desc string, fn func() bool) {
+		t.Helper()
+		timeout := time.After(time.Second * 15)
+		for !fn() {
+			select {
+			case <-timeout:
+				logs, _ := os.ReadFile(logFile)
+				t.Fatalf("timeout waiting for %s, logs:\n%s", desc, logs)
+			case <-time.After(time.Millisecond * 100):
+			}
+		}
+	}
+
+	runCmd := exec.Command(testBinary)
+	runCmd.Dir = testTmpDir
+	runCmd.Env = append(
+		os.Environ(),
+		"UPGRADE_PID_FILE="+pidFile,
+		"UPGRADE_FAIL_FILE="+failFile,
+		"UPGRADE_SOCKET="+socket,
+		"UPGRADE_ADMIN_ADDRESS="+adminAddress,
+	)
+	runCmd.Stdout = logOut
+	runCmd.Stderr = logOut
+	if err := runCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() {
+		errC <- runCmd.Wait()
+	}()
+	t.Cleanup(func() {
+		runCmd.Process.Kill()
+		if pid := readPID(); pid != 0 && pid != runCmd.Process.Pid {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	})
+	waitFor("the program to be ready", func() bool {
+		return readPID() == runCmd.Process.Pid
+	})
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expecting the unix socket permission %v but got %v", os.FileMode(0o600), perm)
+	}
+
+	// The new process fails to be ready, so the current process should keep serving.
+	if err := os.WriteFile(failFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the upgrade to fail", func() bool {
+		logs, _ := os.ReadFile(logFile)
+		return strings.Contains(string(logs), "Failed to upgrade program")
+	})
+	select {
+	case err := <-errC:
+		t.Fatalf("expecting the program to keep serving after the failed upgrade, but exited with %v", err)
+	case <-time.After(time.Millisecond * 500):
+	}
+	if pid := readPID(); pid != runCmd.Process.Pid {
+		t.Fatalf("expecting the pid file to contain the current process %d but got %d", runCmd.Process.Pid, pid)
+	}
+
+	// The new process is ready, so the current process should exit.
+	if err := os.Remove(failFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errC:
+		if err != nil {
+			t.Fatalf("expecting the program to exit without error after upgraded, but got %v", err)
+		}
+	case <-time.After(time.Second * 15):
+		t.Fatal("timeout waiting for the program to exit after upgraded")
+	}
+	pid := readPID()
+	if pid == runCmd.Process.Pid {
+		t.Fatal("expecting the pid file to contain the new process")
+	}
+	waitFor("the new process to log its generation", func() bool {
+		logs, _ := os.ReadFile(logFile)
+		for _, line := range strings.Split(string(logs), "\n") {
+			if strings.Contains(line, "Upgrade completed") && strings.Contains(line, `"generation":1`) {
+				return true
+			}
+		}
+		return false
+	})
+
+	// Upgrade the new process again via the admin server, the admin server listener is passed to the new process.
+	upgradeURL := "http://" + adminAddress + "/upgrade"
+	resp, err := http.Post(upgradeURL, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expecting status code %d without token but got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	req, err := http.NewRequest(http.MethodPost, upgradeURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expecting status code %d but got %d", http.StatusAccepted, resp.StatusCode)
+	}
+
+	var status upgradeStatus
+	waitFor("the second upgrade", func() bool {
+		resp, err := http.Get("http://" + adminAddress + "/upgrade/status")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		status = upgradeStatus{}
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			return false
+		}
+		// Wait until the status is served by the newest process, as the previous process might still serve the request.
+		return status.Generation == 2 && status.PID == readPID()
+	})
+	if status.ParentPID != pid {
+		t.Fatalf("expecting parent pid %d but got %d", pid, status.ParentPID)
+	}
+	want := []upgradeListener{
+		{Network: "tcp", Address: adminAddress, Inherited: true},
+		{Network: "udp", Address: "127.0.0.1:0", Inherited: true},
+		{Network: "unix", Address: socket, Inherited: true},
+	}
+	if diff := cmp.Diff(want, status.Listeners); diff != "" {
+		t.Fatalf("(-want/+got) listeners:\n%s", diff)
+	}
+	if _, err := os.Stat(socket); err != nil {
+		t.Fatalf("expecting the unix socket to exist after upgraded, but got %v", err)
+	}
+	if err := syscall.Kill(status.PID, syscall.SIGTERM); err != nil {
+		t.Fatalf("expecting the new process to be running, but got %v", err)
+	}
+}
+
+func TestUpgraderBegin(t *testing.T) {
+	t.Parallel()
+
+	// Create the upgrader without tableflip, as the tableflip upgrader can only be created once.
+	u := &upgrader{
+		pidFile:        "testing.pid",
+		logger:         slog.Default(),
+		servicesReadyC: make(chan struct{}),
+		generation:     2,
+		parentPID:      1,
+		listeners:      []upgradeListener{{Network: "tcp", Address: ":8080", Inherited: true}},
+	}
+	if err := u.begin(); !errors.Is(err, errUpgradeNotReady) {
+		t.Fatalf("expecting error %v but got %v", errUpgradeNotReady, err)
+	}
+	u.servicesReady()
+	if err := u.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.begin(); !errors.Is(err, errUpgradeInProgress) {
+		t.Fatalf("expecting error %v but got %v", errUpgradeInProgress, err)
+	}
+	if !u.status().InProgress {
+		t.Fatal("expecting the upgrade to be in progress")
+	}
+
+	start := time.Now()
+	u.finish("admin", start, errors.New("child exited"))
+	want := upgradeStatus{
+		Generation: 2,
+		PID:        os.Getpid(),
+		ParentPID:  1,
+		PIDFile:    "testing.pid",
+		Listeners:  []upgradeListener{{Network: "tcp", Address: ":8080", Inherited: true}},
+		LastUpgrade: &upgradeResult{
+			Trigger:   "admin",
+			Result:    "failure",
+			Error:     "child exited",
+			StartedAt: start,
+		},
+	}
+	if diff := cmp.Diff(want, u.status(), cmpopts.IgnoreFields(upgradeResult{}, "Duration")); diff != "" {
+		t.Fatalf("(-want/+got) upgrade status:\n%s", diff)
+	}
+	// The next upgrade can be started after the previous upgrade is finished.
+	if err := u.begin(); err != nil {
+		t.Fatal(err)
+	}
+}